@@ -0,0 +1,167 @@
+package api
+
+import (
+	"container/list"
+	"io/fs"
+	"sync"
+	"time"
+)
+
+// defaultAssetBudget is the size of the asset cache, when `ASSET_CACHE_SIZE` isn't set (64mb)
+const defaultAssetBudget int64 = 64 << 20
+
+// assetStore is a thread-safe LRU cache of assets, bounded by a byte budget.
+//
+// It also stores which assets are fingerprinted (from Vite's manifest)
+type assetStore struct {
+	mu     sync.Mutex
+	budget int64                    // The max amount of bytes stored
+	size   int64                    // The amount of bytes stored
+	items  map[string]*list.Element // Elements are *assetEntry
+	order  *list.List               // The most recently used asset is at the front
+	hits   uint64                   // The amount of Gets that found the asset
+	misses uint64                   // The amount of Gets that didn't
+
+	files        fs.FS // Where the assets and manifest are read from
+	manifestPath string
+	manifestMod  time.Time
+	loaded       bool            // If the manifest has been loaded
+	hashed       map[string]bool // Fingerprinted assets
+}
+
+type assetEntry struct {
+	name  string
+	asset *AssetCache
+}
+
+// newAssetStore creates an assetStore, limited by budget (in bytes)
+func newAssetStore(budget int64, files fs.FS, manifestPath string) *assetStore {
+	return &assetStore{
+		budget:       budget,
+		items:        map[string]*list.Element{},
+		order:        list.New(),
+		files:        files,
+		manifestPath: manifestPath,
+		hashed:       map[string]bool{},
+	}
+}
+
+// size is the amount of bytes an asset uses in the cache
+func (asset *AssetCache) size() int64 {
+	return int64(len(asset.File.Content) + len(asset.GZip) + len(asset.Brotli))
+}
+
+// isStale checks if the file has been modified since it was cached
+func (asset *AssetCache) isStale(files fs.FS, path string) bool {
+	info, err := fs.Stat(files, path)
+	if err != nil {
+		return true
+	}
+
+	return !info.ModTime().Equal(asset.FileInfo.ModTime()) || info.Size() != asset.FileInfo.Size()
+}
+
+// Get gets an asset and marks it as recently used
+func (store *assetStore) Get(name string) (*AssetCache, bool) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	elem, ok := store.items[name]
+	if !ok {
+		store.misses++
+		return nil, false
+	}
+
+	store.hits++
+	store.order.MoveToFront(elem)
+	return elem.Value.(*assetEntry).asset, true
+}
+
+// Put adds (or replaces) an asset, then removes the least recently used assets until it's within budget.
+//
+// Assets bigger than the budget aren't stored
+func (store *assetStore) Put(name string, asset *AssetCache) bool {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	store.remove(name)
+
+	size := asset.size()
+	if size > store.budget {
+		return false
+	}
+
+	store.items[name] = store.order.PushFront(&assetEntry{name: name, asset: asset})
+	store.size += size
+
+	for store.size > store.budget {
+		oldest := store.order.Back()
+		store.remove(oldest.Value.(*assetEntry).name)
+	}
+
+	return true
+}
+
+// remove removes an asset, the lock must be held
+func (store *assetStore) remove(name string) {
+	elem, ok := store.items[name]
+	if !ok {
+		return
+	}
+
+	store.size -= elem.Value.(*assetEntry).asset.size()
+	store.order.Remove(elem)
+	delete(store.items, name)
+}
+
+// Stats gets the amount of cache hits and misses, and the amount of bytes stored
+func (store *assetStore) Stats() (hits, misses uint64, size int64) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	return store.hits, store.misses, store.size
+}
+
+// Len is the amount of cached assets
+func (store *assetStore) Len() int {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	return len(store.items)
+}
+
+// IsHashed checks if an asset is fingerprinted
+func (store *assetStore) IsHashed(name string) bool {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	return store.hashed[name]
+}
+
+// LoadManifest (re)loads the fingerprinted assets from Vite's manifest, if it has been modified
+func (store *assetStore) LoadManifest() error {
+	info, err := fs.Stat(store.files, store.manifestPath)
+	if err != nil {
+		return err
+	}
+
+	store.mu.Lock()
+	unchanged := store.loaded && info.ModTime().Equal(store.manifestMod)
+	store.mu.Unlock()
+	if unchanged {
+		return nil
+	}
+
+	hashed, err := loadViteManifest(store.files, store.manifestPath)
+	if err != nil {
+		return err
+	}
+
+	store.mu.Lock()
+	store.hashed = hashed
+	store.manifestMod = info.ModTime()
+	store.loaded = true
+	store.mu.Unlock()
+
+	return nil
+}
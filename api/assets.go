@@ -1,159 +1,274 @@
 package api
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io/fs"
+	"log/slog"
 	"net/http"
-	"os"
+	"path"
+	"strconv"
+	"sync"
 	"time"
 
 	"github.com/Blockitifluy/CoffeeCo/utility"
-	"github.com/fatih/color"
 	"github.com/gabriel-vasile/mimetype"
 	"github.com/gorilla/mux"
 )
 
 const assetCacheControl string = "must-revalidate, max-age=86400" // Caches for one day
 
-var openedCache = map[string]*AssetCache{}
+// ViteManifestChunk is a chunk of Vite's build manifest (`build.manifest` in vite.config.mjs)
+type ViteManifestChunk struct {
+	File   string   `json:"file"`   // The fingerprinted file, e.g.: assets/index-4f1e2a3b.js
+	CSS    []string `json:"css"`    // The fingerprinted css files
+	Assets []string `json:"assets"` // The fingerprinted assets (images, fonts)
+}
+
+// loadViteManifest gets the name of every fingerprinted (hashed) asset from Vite's build manifest
+func loadViteManifest(files fs.FS, manifestPath string) (map[string]bool, error) {
+	read, err := fs.ReadFile(files, manifestPath)
+	if err != nil {
+		return nil, err
+	}
 
-// LoadAssets loads asset urls
-func (srv *Server) LoadAssets() {
-	const weekLength int = 2 * 7 * 24 * int(time.Hour)
+	var chunks map[string]ViteManifestChunk
+	if err := json.Unmarshal(read, &chunks); err != nil {
+		return nil, err
+	}
+
+	hashed := map[string]bool{}
+	for _, chunk := range chunks {
+		hashed[path.Base(chunk.File)] = true
+		for _, file := range append(chunk.CSS, chunk.Assets...) {
+			hashed[path.Base(file)] = true
+		}
+	}
+
+	return hashed, nil
+}
+
+// LoadAssets loads asset urls and precompresses every asset in `ASSETS_PATH`.
+// Returns an error if `HTML_PATH` or `manifest.json` can't be read
+func (srv *Server) LoadAssets() error {
+	const weekLength int = 7 * 24 * 60 * 60
+
+	srv.assets = newAssetStore(srv.Config.AssetCacheSize, srv.Files, utility.FilePath(srv.Config.ViteManifest))
 
 	HTMLOptions := ConstantFileOptions{
-		Path:   os.Getenv("HTML_PATH"),
+		Path:   utility.FilePath(srv.Config.HTMLPath),
 		Mime:   "text/html",
-		MaxAge: weekLength,
+		MaxAge: 0, // Always revalidated, as it links to the fingerprinted assets
+	}
+
+	html, err := srv.loadConstantFile(HTMLOptions)
+	if err != nil {
+		return err
 	}
 
-	HTMLMethod := srv.ConstantFile(HTMLOptions)
+	srv.html = html
+	srv.pages = newPageCache(pageCacheLength)
+
+	HTMLMethod := func(w http.ResponseWriter, r *http.Request) {
+		srv.SendAssetsFile(w, r, srv.html.Get())
+	}
 	for _, path := range srv.getHTMLRoutes() {
-		if srv.Debug {
+		if srv.Config.Debug {
 			fmt.Printf("> %s\n", path)
 		}
 		srv.HandleFunc(path, HTMLMethod).Methods("GET")
 	}
 
+	for _, rout := range srv.getPageRoutes() {
+		if srv.Config.Debug {
+			fmt.Printf("> %s\n", rout.path)
+		}
+		srv.HandleFunc(rout.path, rout.Funct).Methods(rout.Methods...)
+	}
+
 	ManifestOptions := ConstantFileOptions{
 		Path:   "manifest.json",
 		Mime:   "application/json",
 		MaxAge: weekLength,
 	}
-	srv.HandleFunc("/manifest.json", srv.ConstantFile(ManifestOptions)).
+	manifest, err := srv.ConstantFile(ManifestOptions)
+	if err != nil {
+		return err
+	}
+
+	srv.HandleFunc("/manifest.json", manifest).
 		Methods("GET")
 	srv.HandleFunc("/assets/{filename}", srv.AssetFiles).
 		Methods("GET")
+
+	srv.precompressAssets()
+	return nil
+}
+
+// precompressAssets caches and compresses (gzip and brotli) every file in `ASSETS_PATH` (until the cache is full),
+// so no compression happens whilst serving.
+// Files in Vite's manifest are fingerprinted and cached forever
+func (srv *Server) precompressAssets() {
+	if err := srv.assets.LoadManifest(); err != nil {
+		slog.Warn("Vite manifest couldn't be read, assets won't be cached forever", "error", err)
+	}
+
+	entries, err := fs.ReadDir(srv.Files, utility.FilePath(srv.Config.AssetsPath))
+	if err != nil {
+		slog.Warn("Assets couldn't be precompressed", "error", err)
+		return
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+
+		fileName := entry.Name()
+		cache := srv.createAssetCache(fileName, srv.assets.IsHashed(fileName))
+		if cache.Err != nil {
+			slog.Warn("Asset couldn't be precompressed", "file", fileName, "error", cache.Err)
+			continue
+		}
+
+		srv.assets.Put(fileName, &cache)
+
+		if srv.Config.Debug {
+			fmt.Printf("> /assets/%s\n", fileName)
+		}
+	}
+
+	slog.Info("Assets precompressed", "count", srv.assets.Len())
 }
 
 // AssetFiles is an api call. Doesn't work as expected when called outside an API context
 //
-// Sends files from `dist/assets` and caches it
+// Sends files from `dist/assets` and caches it.
+// When debugging, modified files are reloaded
 func (srv *Server) AssetFiles(w http.ResponseWriter, r *http.Request) {
 	fileName := mux.Vars(r)["filename"]
-	cache := openedCache[fileName]
+	path := path.Join(utility.FilePath(srv.Config.AssetsPath), fileName)
 
-	if cache != nil { // Cache exists
+	cache, ok := srv.assets.Get(fileName)
+	if ok && srv.Config.Debug && cache.isStale(srv.Files, path) {
+		ok = false
+	}
+
+	if ok { // Cache exists
 		srv.SendAssetsFile(w, r, *cache)
 		return
 	}
 
-	path := os.Getenv("ASSETS_PATH") + fileName
-	if !utility.DoesFileExist(path) {
+	if !utility.IsFileValid(fileName) || !utility.DoesFileExist(srv.Files, path) {
 		utility.Error(w, utility.HTTPError{
 			Public:  "File doesn't exist",
 			Message: "file path doesn't exist",
-			Code:    400,
+			Status:  404,
 		})
 		return
 	}
 
-	newCache := createAssetCache(fileName)
+	if srv.Config.Debug { // The frontend could've been rebuilt
+		srv.assets.LoadManifest()
+	}
+
+	newCache := srv.createAssetCache(fileName, srv.assets.IsHashed(fileName))
 	if newCache.Err != nil {
 		utility.Error(w, utility.HTTPError{
 			Public:  "Couldn't get file",
 			Message: newCache.Err.Error(),
-			Code:    newCache.Code,
+			Status:  newCache.Code,
 		})
 		return
 	}
 
+	srv.assets.Put(fileName, &newCache)
 	srv.SendAssetsFile(w, r, newCache)
 }
 
-// SendAssetsFile sends the AssetCache to the client
+// SendAssetsFile sends the AssetCache to the client,
+// using the precompressed file if the client accepts it's encoding
 func (srv *Server) SendAssetsFile(w http.ResponseWriter, r *http.Request, Data AssetCache) {
-	match := r.Header.Get("If-None-Match")
-	ifModifiedSince := r.Header.Get("If-Modified-Since")
+	content, encoding := Data.File.Content, ""
+	switch utility.NegotiateEncoding(r.Header.Get("Accept-Encoding")) {
+	case utility.EncodingBrotli:
+		if Data.Brotli != nil {
+			content, encoding = Data.Brotli, utility.EncodingBrotli
+		} else if Data.GZip != nil {
+			content, encoding = Data.GZip, utility.EncodingGZip
+		}
+	case utility.EncodingGZip:
+		if Data.GZip != nil {
+			content, encoding = Data.GZip, utility.EncodingGZip
+		}
+	}
+
+	eTag := utility.EncodedETag(Data.ETag, encoding)
+
+	modTime := Data.FileInfo.ModTime() // Embedded files have no modification time
+
+	w.Header().Set("Cache-Control", Data.CacheControl)
+	w.Header().Set("ETag", eTag)
+	if !modTime.IsZero() {
+		w.Header().Set("Last-Modified", utility.GetFileLastModified(Data.FileInfo))
+	}
 
-	if match != "" {
-		if match == Data.ETag {
+	if match := r.Header.Get("If-None-Match"); match != "" {
+		if utility.ETagMatches(match, eTag) {
 			w.WriteHeader(http.StatusNotModified)
 			return
 		}
-	}
-
-	if ifModifiedSince != "" {
+	} else if ifModifiedSince := r.Header.Get("If-Modified-Since"); ifModifiedSince != "" && !modTime.IsZero() {
 		t, err := time.Parse(http.TimeFormat, ifModifiedSince)
-		if err == nil && Data.FileInfo.ModTime().Before(t.Add(1*time.Second)) {
+		if err == nil && modTime.Before(t.Add(1*time.Second)) {
 			w.WriteHeader(http.StatusNotModified)
 			return
 		}
 	}
 
-	lastMod := utility.GetFileLastModified(Data.FileInfo)
-
-	w.Header().Set("Content-Encoding", "gzip")
-	w.Header().Set("Cache-Control", assetCacheControl)
-	w.Header().Set("ETag", Data.ETag)
-	w.Header().Set("Last-Modified", lastMod)
+	if encoding != "" {
+		w.Header().Set("Content-Encoding", encoding)
+	}
 	w.Header().Set("Content-Type", Data.File.Mime)
-	w.Write(Data.File.Content)
+	w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+	w.Write(content)
 }
 
 // AssetCache is represents the Asset stored in the Cache
 type AssetCache struct {
-	File     *utility.FileMime // The filedata
-	FileInfo fs.FileInfo       // The file metadata
-	Err      error             // The Error being return (optional)
-	Code     int               // The code being returned
-	ETag     string            // The file's ETag
+	File         *utility.FileMime // The filedata
+	GZip         []byte            // The file compressed by gzip (nil if not worth compressing)
+	Brotli       []byte            // The file compressed by brotli (nil if not worth compressing)
+	FileInfo     fs.FileInfo       // The file metadata
+	Err          error             // The Error being return (optional)
+	Code         int               // The code being returned
+	ETag         string            // The file's ETag
+	CacheControl string            // The file's Cache-Control
 }
 
-// createAssetCache should only be used by [coffeecoserver/api.AssetFile],
-// when a asset file (in cache) doesn't exists, then create one and return it
-func createAssetCache(fileName string) AssetCache {
-	path := os.Getenv("ASSETS_PATH") + fileName // Example: dist/assets/hello.world
-	if !utility.IsFileValid(fileName) {
-		return AssetCache{
-			File: nil,
-			Code: http.StatusBadRequest,
-			Err:  errors.New("Invalid File Name"),
+// newAssetCache reads, precompresses and creates an ETag for a file.
+// If mime is empty, the mime is detected from the file
+func newAssetCache(files fs.FS, path, mime, cacheControl string) AssetCache {
+	read, readErr := fs.ReadFile(files, path)
+	if readErr != nil {
+		code := 500
+		if errors.Is(readErr, fs.ErrNotExist) {
+			code = 404
 		}
-	}
 
-	read, readErr := os.ReadFile(path)
-
-	mtype := utility.MimeExpection(mimetype.Detect(read), path)
-	if readErr != nil {
 		return AssetCache{
 			File: nil,
-			Code: 500,
+			Code: code,
 			Err:  readErr,
 		}
 	}
 
-	compress, err := utility.GZipBytes(read)
-	if err != nil {
-		return AssetCache{
-			File: nil,
-			Code: 500,
-			Err:  err,
-		}
+	if mime == "" {
+		mime = utility.MimeExpection(mimetype.Detect(read), path)
 	}
 
-	fileInfo, err := os.Stat(path)
+	fileInfo, err := fs.Stat(files, path)
 	if err != nil {
 		return AssetCache{
 			File: nil,
@@ -162,89 +277,129 @@ func createAssetCache(fileName string) AssetCache {
 		}
 	}
 
-	eTag, err := utility.GenerateETag(read)
-	if err != nil {
-		return AssetCache{
-			File: nil,
-			Code: 500,
-			Err:  err,
-		}
+	return compressAsset(read, mime, cacheControl, fileInfo)
+}
+
+// compressAsset precompresses and creates an ETag for content
+func compressAsset(content []byte, mime, cacheControl string, fileInfo fs.FileInfo) AssetCache {
+	Cache := AssetCache{
+		File: &utility.FileMime{
+			Mime:    mime,
+			Content: content,
+		},
+		Err:          nil,
+		Code:         200,
+		FileInfo:     fileInfo,
+		ETag:         utility.GenerateETag(content),
+		CacheControl: cacheControl,
 	}
 
-	FileData := &utility.FileMime{
-		Mime:    mtype,
-		Content: compress,
+	if len(content) < utility.CompressMinSize || utility.IsCompressedMime(mime) {
+		return Cache
 	}
 
-	Cache := AssetCache{
-		File:     FileData,
-		Err:      nil,
-		Code:     200,
-		FileInfo: fileInfo,
-		ETag:     eTag,
+	// Only keeps compressed files that are smaller
+	if zipped, err := utility.GZipBytes(content); err == nil && len(zipped) < len(content) {
+		Cache.GZip = zipped
 	}
 
-	openedCache[fileName] = &Cache
+	if brotli, err := utility.BrotliBytes(content); err == nil && len(brotli) < len(content) {
+		Cache.Brotli = brotli
+	}
 
 	return Cache
 }
 
+// createAssetCache should only be used by [coffeecoserver/api.AssetFile] and when loading assets,
+// when a asset file (in cache) doesn't exists, then create one and return it (isn't added to the cache).
+//
+// Fingerprinted files (with a hash in it's name) are cached forever
+func (srv *Server) createAssetCache(fileName string, fingerprinted bool) AssetCache {
+	if !utility.IsFileValid(fileName) {
+		return AssetCache{
+			File: nil,
+			Code: http.StatusBadRequest,
+			Err:  errors.New("Invalid File Name"),
+		}
+	}
+
+	cacheControl := assetCacheControl
+	if fingerprinted {
+		cacheControl = utility.ImmutableCacheControl
+	}
+
+	path := path.Join(utility.FilePath(srv.Config.AssetsPath), fileName) // Example: dist/assets/hello.world
+	return newAssetCache(srv.Files, path, "", cacheControl)
+}
+
 // ConstantFileOptions is for the method [github.com/Blockitifluy/CoffeeCo/api.ConstantFile]
 type ConstantFileOptions struct {
 	Path   string
 	Mime   string
-	MaxAge int
+	MaxAge int // In seconds
 }
 
-// ConstantFile is an api call. Doesn't work as expected when called outside an API context
-//
-// First, reads and caches file then sends to client
-func (srv *Server) ConstantFile(Options ConstantFileOptions) http.HandlerFunc {
-	const CacheControl string = "must-revalidate, public, max-age=604800" // Caches for one week
-	read, readErr := os.ReadFile(Options.Path)
-	if readErr != nil {
-		color.Red("'%s' can't be found; Server will not start (%s)", Options.Path, readErr.Error())
-		os.Exit(1)
-	}
+// constantFile is a file that is read once (and reloaded when modified whilst debugging)
+type constantFile struct {
+	mu           sync.RWMutex
+	srv          *Server
+	options      ConstantFileOptions
+	cacheControl string
+	cache        AssetCache
+}
 
-	compress, err := utility.GZipBytes(read)
-	if err != nil {
-		color.Red("'%s' couldn't be compressed; Server will not start", Options.Path)
-		os.Exit(1)
-	}
+// loadConstantFile reads and precompresses a file, the server shouldn't start if it can't be read
+func (srv *Server) loadConstantFile(Options ConstantFileOptions) (*constantFile, error) {
+	cacheControl := fmt.Sprintf("must-revalidate, public, max-age=%d", Options.MaxAge)
 
-	eTag, err := utility.GenerateETag(compress)
-	if err != nil {
-		color.Red("'%s' couldn't get ETag; Server will not start", Options.Path)
-		os.Exit(1)
+	Cache := newAssetCache(srv.Files, Options.Path, Options.Mime, cacheControl)
+	if Cache.Err != nil {
+		return nil, fmt.Errorf("'%s' can't be loaded: %w", Options.Path, Cache.Err)
 	}
 
-	fileInfo, err := os.Stat(Options.Path)
-	if err != nil {
-		color.Red("'%s' couldn't get file info", Options.Path)
-		os.Exit(1)
+	return &constantFile{
+		srv:          srv,
+		options:      Options,
+		cacheControl: cacheControl,
+		cache:        Cache,
+	}, nil
+}
+
+// Get gets the file, when debugging the file is reloaded if it has been modified
+func (file *constantFile) Get() AssetCache {
+	file.mu.RLock()
+	current := file.cache
+	file.mu.RUnlock()
+
+	srv, Options := file.srv, file.options
+	if !srv.Config.Debug || !current.isStale(srv.Files, Options.Path) {
+		return current
 	}
 
-	return func(w http.ResponseWriter, r *http.Request) {
+	reloaded := newAssetCache(srv.Files, Options.Path, Options.Mime, file.cacheControl)
+	if reloaded.Err != nil { // Could be midway through a rebuild
+		slog.Warn("File couldn't be reloaded", "file", Options.Path, "error", reloaded.Err)
+		return current
+	}
 
-		if match := r.Header.Get("If-None-Match"); match != "" {
-			if match == eTag {
-				w.WriteHeader(http.StatusNotModified)
-				return
-			}
-		}
+	file.mu.Lock()
+	file.cache = reloaded
+	file.mu.Unlock()
 
-		if ifModifiedSince := r.Header.Get("If-Modified-Since"); ifModifiedSince != "" {
-			t, err := time.Parse(http.TimeFormat, ifModifiedSince)
-			if err == nil && fileInfo.ModTime().Before(t.Add(1*time.Second)) {
-				w.WriteHeader(http.StatusNotModified)
-				return
-			}
-		}
+	return reloaded
+}
 
-		w.Header().Set("Content-Type", Options.Mime)
-		w.Header().Set("Content-Encoding", "gzip")
-		w.Header().Set("Cache-Control", CacheControl)
-		w.Write(compress)
+// ConstantFile is an api call. Doesn't work as expected when called outside an API context
+//
+// First, reads, precompresses and caches file then sends to client (returns an error if it can't be read).
+// When debugging, the file is reloaded when modified
+func (srv *Server) ConstantFile(Options ConstantFileOptions) (http.HandlerFunc, error) {
+	file, err := srv.loadConstantFile(Options)
+	if err != nil {
+		return nil, err
 	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		srv.SendAssetsFile(w, r, file.Get())
+	}, nil
 }
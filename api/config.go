@@ -0,0 +1,490 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Blockitifluy/CoffeeCo/api/database"
+)
+
+// Config is the configuration of the server.
+//
+// It's loaded from (in order, later sources override earlier ones) the defaults ([DefaultConfig]),
+// `.env`, a config file ([Config.LoadFile]), environment variables ([Config.LoadEnv]) and flags ([ConfigFlags])
+type Config struct {
+	Address   string // The hosted address, e.g.: :8000
+	Debug     bool   // Prints the loaded routes and reloads modified assets
+	PublicURL string // The url the server is hosted at, used for link previews (they don't have urls or images when empty)
+
+	CORSOrigins string // Other sites (origins, comma separated) that can send requests with the user's cookies, e.g.: http://localhost:3000
+
+	AssetsPath     string // The built assets, e.g.: dist/assets/
+	HTMLPath       string // The built index.html
+	ViteManifest   string // Vite's build manifest
+	AssetCacheSize int64  // The size of the asset cache (in bytes)
+
+	HTTP   HTTPConfig
+	TLS    TLSConfig
+	Log    LogConfig
+	Admin  AdminConfig
+	Limits LimitConfig
+	Login  LoginConfig
+	DB     DatabaseConfig
+	Backup BackupConfig
+}
+
+// HTTPConfig is the limits of the http server (see [net/http.Server])
+type HTTPConfig struct {
+	ReadTimeout       time.Duration // The longest a request (including the body) can take to read
+	ReadHeaderTimeout time.Duration // The longest the request's headers can take to read
+	WriteTimeout      time.Duration // The longest a response can take to write
+	IdleTimeout       time.Duration // How long keep-alive connections wait for the next request
+	MaxHeaderBytes    int           // The largest the request's headers can be
+	ShutdownTimeout   time.Duration // How long in-flight requests have to finish when the server stops
+}
+
+// TLSConfig is how the server is served over https, it's disabled when `TLS_CERT` and `TLS_KEY` aren't set
+type TLSConfig struct {
+	CertPath        string        // The certificate (PEM), reloaded when it's modified
+	KeyPath         string        // The certificate's private key (PEM)
+	RedirectAddress string        // Where http requests are redirected to https, e.g.: :80 (disabled when empty)
+	HSTSMaxAge      time.Duration // How long browsers only use https (Strict-Transport-Security), 0 disables it
+}
+
+// LogConfig is how the server logs (using [log/slog]), see [NewLogger]
+type LogConfig struct {
+	Level  slog.Level // The least important messages logged: debug, info, warn or error
+	Format string     // text or json
+	Access bool       // Logs every request
+}
+
+// AdminConfig is how `/metrics` and `/debug/` are served.
+// `/metrics` is only served when `ADMIN_ADDRESS` or `METRICS_TOKEN` is set, `/debug/` with `ADMIN_ADDRESS` or `DEBUG` and `METRICS_TOKEN`
+type AdminConfig struct {
+	Address      string // A separate listener for `/metrics` and `/debug/`, e.g.: 127.0.0.1:9090 (instead of the public address)
+	MetricsToken string // Sent as `Authorization: Bearer {token}` to read the metrics (and `/debug/`)
+}
+
+// LimitConfig is how requests are rate limited (see [RateLimit])
+type LimitConfig struct {
+	Enabled        bool   // Rate limits the routes that have a limit
+	TrustedProxies string // The proxies (IPs or CIDRs, comma separated) that `X-Forwarded-For` is read from, e.g.: 10.0.0.0/8
+}
+
+// LoginConfig is when failed log ins lock out a handle or IP, see [Server.APILoginUser]
+type LoginConfig struct {
+	MaxAttempts   int           // The failed log ins of a handle before it's locked out, 0 never locks out
+	MaxIPAttempts int           // The failed log ins of an IP (to any handle) before it's locked out, 0 never locks out
+	Lockout       time.Duration // How long the first lockout is, doubling every failure after
+	MaxLockout    time.Duration // The longest lockout, failures are forgotten this long after the last one
+}
+
+// DatabaseConfig is the database used by the server
+type DatabaseConfig struct {
+	Driver database.Dialect // sqlite3 or postgres
+	Path   string           // The SQLite file
+	URL    string           // The Postgres connection url
+}
+
+// BackupConfig is when the database is backed up (see [database.BackupSchedule])
+type BackupConfig struct {
+	Dir      string        // Where backups are stored
+	Interval time.Duration // How often a backup is taken, 0 disables scheduled backups
+	Keep     int           // The amount of backups kept, 0 keeps every backup
+}
+
+// DefaultConfig is the configuration used when nothing is set
+func DefaultConfig() Config {
+	return Config{
+		Address: ":8000",
+
+		AssetsPath:     "dist/assets/",
+		HTMLPath:       "dist/index.html",
+		ViteManifest:   "dist/manifest.json",
+		AssetCacheSize: defaultAssetBudget,
+
+		HTTP: HTTPConfig{
+			ReadTimeout:       15 * time.Second,
+			ReadHeaderTimeout: 5 * time.Second,
+			WriteTimeout:      30 * time.Second,
+			IdleTimeout:       2 * time.Minute,
+			MaxHeaderBytes:    1 << 20, // 1mb
+			ShutdownTimeout:   15 * time.Second,
+		},
+
+		TLS: TLSConfig{
+			HSTSMaxAge: 180 * 24 * time.Hour,
+		},
+
+		Log: LogConfig{
+			Level:  slog.LevelInfo,
+			Format: "text",
+			Access: true,
+		},
+
+		Limits: LimitConfig{
+			Enabled: true,
+		},
+		Login: LoginConfig{
+			MaxAttempts:   5,
+			MaxIPAttempts: 20,
+			Lockout:       time.Minute,
+			MaxLockout:    time.Hour,
+		},
+
+		DB: DatabaseConfig{
+			Driver: database.SQLite,
+			Path:   "api/database/db.sql",
+		},
+		Backup: BackupConfig{
+			Dir:  "api/database/backups/",
+			Keep: 7,
+		},
+	}
+}
+
+// setting is a value of [Config], set using it's key (the environment variable and config file key)
+type setting struct {
+	Key    string // e.g.: DB_PATH
+	Flag   string // The `serve` flag, empty if there isn't one
+	Usage  string
+	Secret bool // Redacted when the config is shown
+
+	field func(cfg *Config) any // A pointer to the field
+}
+
+// settings are every value of [Config] that can be set
+var settings = []setting{
+	{Key: "DEFAULT_PORT", Flag: "port", Usage: "The hosted port, e.g.: :8000", field: func(cfg *Config) any { return &cfg.Address }},
+	{Key: "DEBUG", Flag: "debug", Usage: "Prints the loaded routes and reloads modified assets", field: func(cfg *Config) any { return &cfg.Debug }},
+	{Key: "PUBLIC_URL", Flag: "public-url", Usage: "The url the server is hosted at, used for link previews", field: func(cfg *Config) any { return &cfg.PublicURL }},
+	{Key: "CORS_ORIGINS", Flag: "cors-origins", Usage: "Other sites (origins, comma separated) that can send requests with the user's cookies", field: func(cfg *Config) any { return &cfg.CORSOrigins }},
+
+	{Key: "ASSETS_PATH", Usage: "The built assets", field: func(cfg *Config) any { return &cfg.AssetsPath }},
+	{Key: "HTML_PATH", Usage: "The built index.html", field: func(cfg *Config) any { return &cfg.HTMLPath }},
+	{Key: "VITE_MANIFEST", Usage: "Vite's build manifest", field: func(cfg *Config) any { return &cfg.ViteManifest }},
+	{Key: "ASSET_CACHE_SIZE", Usage: "The size of the asset cache (in bytes)", field: func(cfg *Config) any { return &cfg.AssetCacheSize }},
+
+	{Key: "READ_TIMEOUT", Usage: "The longest a request (including the body) can take to read", field: func(cfg *Config) any { return &cfg.HTTP.ReadTimeout }},
+	{Key: "READ_HEADER_TIMEOUT", Usage: "The longest the request's headers can take to read", field: func(cfg *Config) any { return &cfg.HTTP.ReadHeaderTimeout }},
+	{Key: "WRITE_TIMEOUT", Usage: "The longest a response can take to write", field: func(cfg *Config) any { return &cfg.HTTP.WriteTimeout }},
+	{Key: "IDLE_TIMEOUT", Usage: "How long keep-alive connections wait for the next request", field: func(cfg *Config) any { return &cfg.HTTP.IdleTimeout }},
+	{Key: "MAX_HEADER_BYTES", Usage: "The largest the request's headers can be (in bytes)", field: func(cfg *Config) any { return &cfg.HTTP.MaxHeaderBytes }},
+	{Key: "SHUTDOWN_TIMEOUT", Flag: "shutdown-timeout", Usage: "How long in-flight requests have to finish when the server stops", field: func(cfg *Config) any { return &cfg.HTTP.ShutdownTimeout }},
+
+	{Key: "TLS_CERT", Flag: "tls-cert", Usage: "The TLS certificate (PEM), https is used when it and TLS_KEY are set", field: func(cfg *Config) any { return &cfg.TLS.CertPath }},
+	{Key: "TLS_KEY", Flag: "tls-key", Usage: "The TLS certificate's private key (PEM)", field: func(cfg *Config) any { return &cfg.TLS.KeyPath }},
+	{Key: "HTTP_REDIRECT_ADDRESS", Flag: "http-redirect", Usage: "Where http requests are redirected to https, e.g.: :80", field: func(cfg *Config) any { return &cfg.TLS.RedirectAddress }},
+	{Key: "HSTS_MAX_AGE", Usage: "How long browsers only use https (Strict-Transport-Security), empty disables it", field: func(cfg *Config) any { return &cfg.TLS.HSTSMaxAge }},
+
+	{Key: "LOG_LEVEL", Flag: "log-level", Usage: "The least important messages logged: debug, info, warn or error", field: func(cfg *Config) any { return &cfg.Log.Level }},
+	{Key: "LOG_FORMAT", Flag: "log-format", Usage: "The format of the logs: text or json", field: func(cfg *Config) any { return &cfg.Log.Format }},
+	{Key: "ACCESS_LOG", Usage: "Logs every request", field: func(cfg *Config) any { return &cfg.Log.Access }},
+
+	{Key: "ADMIN_ADDRESS", Flag: "admin-address", Usage: "A separate listener for /metrics and /debug/, e.g.: 127.0.0.1:9090", field: func(cfg *Config) any { return &cfg.Admin.Address }},
+	{Key: "METRICS_TOKEN", Usage: "Sent as `Authorization: Bearer {token}` to read /metrics and /debug/", Secret: true, field: func(cfg *Config) any { return &cfg.Admin.MetricsToken }},
+
+	{Key: "RATE_LIMIT", Usage: "Rate limits logging in, signing up, posting and uploading", field: func(cfg *Config) any { return &cfg.Limits.Enabled }},
+	{Key: "TRUSTED_PROXIES", Usage: "The proxies (IPs or CIDRs, comma separated) that X-Forwarded-For is read from", field: func(cfg *Config) any { return &cfg.Limits.TrustedProxies }},
+
+	{Key: "LOGIN_MAX_ATTEMPTS", Usage: "The failed log ins of a handle before it's locked out, 0 never locks out", field: func(cfg *Config) any { return &cfg.Login.MaxAttempts }},
+	{Key: "LOGIN_MAX_IP_ATTEMPTS", Usage: "The failed log ins of an IP before it's locked out, 0 never locks out", field: func(cfg *Config) any { return &cfg.Login.MaxIPAttempts }},
+	{Key: "LOGIN_LOCKOUT", Usage: "How long the first lockout is (e.g. 1m), doubling every failure after", field: func(cfg *Config) any { return &cfg.Login.Lockout }},
+	{Key: "LOGIN_MAX_LOCKOUT", Usage: "The longest lockout (e.g. 1h), failures are forgotten this long after the last one", field: func(cfg *Config) any { return &cfg.Login.MaxLockout }},
+
+	{Key: "DB_DRIVER", Flag: "db-driver", Usage: "The database, sqlite3 or postgres", field: func(cfg *Config) any { return &cfg.DB.Driver }},
+	{Key: "DB_PATH", Flag: "db-path", Usage: "The SQLite file", field: func(cfg *Config) any { return &cfg.DB.Path }},
+	{Key: "DB_URL", Flag: "db-url", Usage: "The Postgres connection url", Secret: true, field: func(cfg *Config) any { return &cfg.DB.URL }},
+
+	{Key: "BACKUP_DIR", Usage: "Where backups are stored", field: func(cfg *Config) any { return &cfg.Backup.Dir }},
+	{Key: "BACKUP_INTERVAL", Usage: "How often a backup is taken (e.g. 24h), empty disables scheduled backups", field: func(cfg *Config) any { return &cfg.Backup.Interval }},
+	{Key: "BACKUP_KEEP", Usage: "The amount of backups kept, 0 keeps every backup", field: func(cfg *Config) any { return &cfg.Backup.Keep }},
+}
+
+// findSetting gets the setting with the key
+func findSetting(key string) (setting, bool) {
+	for _, s := range settings {
+		if s.Key == key {
+			return s, true
+		}
+	}
+
+	return setting{}, false
+}
+
+// Set sets a value using it's key (e.g. DB_PATH), the value is parsed into the field's type
+func (cfg *Config) Set(key, value string) error {
+	s, ok := findSetting(key)
+	if !ok {
+		return fmt.Errorf("%s isn't a setting", key)
+	}
+
+	var err error
+	switch field := s.field(cfg).(type) {
+	case *string:
+		*field = value
+	case *bool:
+		*field, err = strconv.ParseBool(value)
+	case *int:
+		*field, err = strconv.Atoi(value)
+	case *int64:
+		*field, err = strconv.ParseInt(value, 10, 64)
+	case *time.Duration:
+		*field = 0
+		if value != "" {
+			*field, err = time.ParseDuration(value)
+		}
+	case *database.Dialect:
+		*field, err = database.ParseDialect(value)
+	case *slog.Level:
+		err = field.UnmarshalText([]byte(value))
+	default:
+		err = fmt.Errorf("%T can't be set", field)
+	}
+
+	if err != nil {
+		return fmt.Errorf("%s is invalid: %w", key, err)
+	}
+
+	return nil
+}
+
+// Get gets a value using it's key (e.g. DB_PATH) as a string
+func (cfg *Config) Get(key string) (string, bool) {
+	s, ok := findSetting(key)
+	if !ok {
+		return "", false
+	}
+
+	switch field := s.field(cfg).(type) {
+	case *time.Duration:
+		if *field == 0 {
+			return "", true
+		}
+		return field.String(), true
+	default:
+		return fmt.Sprint(reflect.ValueOf(field).Elem().Interface()), true
+	}
+}
+
+// Redacted gets every value by it's key (see [Config.Get]), secrets that are set are replaced with REDACTED
+func (cfg Config) Redacted() map[string]string {
+	values := map[string]string{}
+	for _, s := range settings {
+		value, _ := cfg.Get(s.Key)
+		if s.Secret && value != "" {
+			value = "REDACTED"
+		}
+
+		values[s.Key] = value
+	}
+
+	return values
+}
+
+// Apply sets every value in values (see [Config.Set]), e.g. a parsed `.env`. Unknown keys are ignored
+func (cfg *Config) Apply(values map[string]string) error {
+	var errs []error
+	for _, s := range settings {
+		if value, ok := values[s.Key]; ok {
+			errs = append(errs, cfg.Set(s.Key, value))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// LoadEnv sets the values of the environment variables that are set
+func (cfg *Config) LoadEnv() error {
+	values := map[string]string{}
+	for _, s := range settings {
+		if value, ok := os.LookupEnv(s.Key); ok {
+			values[s.Key] = value
+		}
+	}
+
+	return cfg.Apply(values)
+}
+
+// LoadFile sets the values in a JSON config file, an object using the same keys as `.env`, e.g.:
+//
+//	{"DB_DRIVER": "postgres", "BACKUP_INTERVAL": "24h", "BACKUP_KEEP": 7}
+//
+// Unknown keys are an error (so typos are noticed)
+func (cfg *Config) LoadFile(path string) error {
+	read, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("config file couldn't be read: %w", err)
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(read))
+	decoder.UseNumber() // So large numbers aren't formatted as floats, e.g. 6.7108864e+07
+
+	var file map[string]any
+	if err := decoder.Decode(&file); err != nil {
+		return fmt.Errorf("config file %s isn't valid JSON: %w", path, err)
+	}
+
+	values := map[string]string{}
+	for key, value := range file {
+		if _, ok := findSetting(key); !ok {
+			return fmt.Errorf("config file %s: %s isn't a setting", path, key)
+		}
+
+		if value == nil {
+			value = ""
+		}
+		values[key] = fmt.Sprint(value)
+	}
+
+	return cfg.Apply(values)
+}
+
+// ConfigFlags adds a flag for every setting with one. Flags that are used are put into overrides,
+// which should be applied last (see [Config.Apply]), so flags override every other source
+func ConfigFlags(flags *flag.FlagSet, overrides map[string]string) {
+	defaults := DefaultConfig()
+
+	for _, s := range settings {
+		if s.Flag == "" {
+			continue
+		}
+
+		key := s.Key
+		set := func(value string) error {
+			if err := (&Config{}).Set(key, value); err != nil { // Checked whilst parsing, so the flag is shown
+				return err
+			}
+
+			overrides[key] = value
+			return nil
+		}
+
+		usage := fmt.Sprintf("%s (%s)", s.Usage, key)
+		if _, isBool := s.field(&defaults).(*bool); isBool {
+			flags.BoolFunc(s.Flag, usage, func(value string) error {
+				return set(value)
+			})
+			continue
+		}
+
+		if value, _ := defaults.Get(key); value != "" && !s.Secret {
+			usage += fmt.Sprintf(" (default %q)", value)
+		}
+		flags.Func(s.Flag, usage, set)
+	}
+}
+
+// Validate checks the config, returning every problem
+func (cfg Config) Validate() error {
+	var errs []error
+
+	if cfg.Address == "" {
+		errs = append(errs, errors.New("DEFAULT_PORT must be set, e.g.: :8000"))
+	}
+
+	if cfg.PublicURL != "" && !strings.HasPrefix(cfg.PublicURL, "http://") && !strings.HasPrefix(cfg.PublicURL, "https://") {
+		errs = append(errs, fmt.Errorf("PUBLIC_URL must start with http:// or https://, not %s", cfg.PublicURL))
+	}
+
+	if _, err := ParseOrigins(cfg.CORSOrigins); err != nil {
+		errs = append(errs, fmt.Errorf("CORS_ORIGINS is invalid: %w", err))
+	}
+
+	if cfg.HTMLPath == "" || cfg.AssetsPath == "" {
+		errs = append(errs, errors.New("HTML_PATH and ASSETS_PATH must be set"))
+	}
+
+	if cfg.AssetCacheSize < 0 {
+		errs = append(errs, errors.New("ASSET_CACHE_SIZE can't be negative"))
+	}
+
+	timeouts := map[string]time.Duration{
+		"READ_TIMEOUT":        cfg.HTTP.ReadTimeout,
+		"READ_HEADER_TIMEOUT": cfg.HTTP.ReadHeaderTimeout,
+		"WRITE_TIMEOUT":       cfg.HTTP.WriteTimeout,
+		"IDLE_TIMEOUT":        cfg.HTTP.IdleTimeout,
+		"SHUTDOWN_TIMEOUT":    cfg.HTTP.ShutdownTimeout,
+	}
+	for _, s := range settings { // In the order of settings, so the errors are always in the same order
+		if timeout, ok := timeouts[s.Key]; ok && timeout < 0 {
+			errs = append(errs, fmt.Errorf("%s can't be negative (0 has no timeout)", s.Key))
+		}
+	}
+
+	if cfg.HTTP.MaxHeaderBytes < 0 {
+		errs = append(errs, errors.New("MAX_HEADER_BYTES can't be negative"))
+	}
+
+	if (cfg.TLS.CertPath == "") != (cfg.TLS.KeyPath == "") {
+		errs = append(errs, errors.New("TLS_CERT and TLS_KEY must both be set (or neither)"))
+	}
+
+	if cfg.TLS.RedirectAddress != "" {
+		if !cfg.TLSEnabled() {
+			errs = append(errs, errors.New("HTTP_REDIRECT_ADDRESS requires TLS_CERT and TLS_KEY"))
+		} else if cfg.TLS.RedirectAddress == cfg.Address {
+			errs = append(errs, errors.New("HTTP_REDIRECT_ADDRESS must be different to DEFAULT_PORT"))
+		}
+	}
+
+	if cfg.TLS.HSTSMaxAge < 0 {
+		errs = append(errs, errors.New("HSTS_MAX_AGE can't be negative"))
+	}
+
+	if cfg.Log.Format != "text" && cfg.Log.Format != "json" {
+		errs = append(errs, fmt.Errorf("LOG_FORMAT must be text or json, not %q", cfg.Log.Format))
+	}
+
+	if cfg.Admin.Address != "" && (cfg.Admin.Address == cfg.Address || cfg.Admin.Address == cfg.TLS.RedirectAddress) {
+		errs = append(errs, errors.New("ADMIN_ADDRESS must be different to DEFAULT_PORT and HTTP_REDIRECT_ADDRESS"))
+	}
+
+	if cfg.Login.MaxAttempts < 0 || cfg.Login.MaxIPAttempts < 0 {
+		errs = append(errs, errors.New("LOGIN_MAX_ATTEMPTS and LOGIN_MAX_IP_ATTEMPTS can't be negative (0 never locks out)"))
+	}
+
+	if (cfg.Login.MaxAttempts > 0 || cfg.Login.MaxIPAttempts > 0) && (cfg.Login.Lockout <= 0 || cfg.Login.MaxLockout < cfg.Login.Lockout) {
+		errs = append(errs, errors.New("LOGIN_LOCKOUT must be positive and LOGIN_MAX_LOCKOUT can't be shorter"))
+	}
+
+	if _, err := ParseTrustedProxies(cfg.Limits.TrustedProxies); err != nil {
+		errs = append(errs, fmt.Errorf("TRUSTED_PROXIES is invalid: %w", err))
+	}
+
+	switch cfg.DB.Driver {
+	case database.SQLite:
+		if cfg.DB.Path == "" {
+			errs = append(errs, errors.New("DB_PATH must be set when DB_DRIVER is sqlite3"))
+		}
+	case database.Postgres:
+		if cfg.DB.URL == "" {
+			errs = append(errs, errors.New("DB_URL must be set when DB_DRIVER is postgres"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("DB_DRIVER must be sqlite3 or postgres, not %q", cfg.DB.Driver))
+	}
+
+	if cfg.Backup.Interval < 0 {
+		errs = append(errs, errors.New("BACKUP_INTERVAL can't be negative"))
+	}
+
+	if cfg.Backup.Interval > 0 && cfg.Backup.Dir == "" {
+		errs = append(errs, errors.New("BACKUP_DIR must be set when BACKUP_INTERVAL is set"))
+	}
+
+	if cfg.Backup.Keep < 0 {
+		errs = append(errs, errors.New("BACKUP_KEEP can't be negative"))
+	}
+
+	return errors.Join(errs...)
+}
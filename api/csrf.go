@@ -0,0 +1,130 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/Blockitifluy/CoffeeCo/utility"
+	"github.com/gorilla/handlers"
+)
+
+// corsMaxAge is how long browsers cache a preflight request (in seconds, browsers cap it at 10 minutes)
+const corsMaxAge = 600
+
+// ParseOrigins parses `CORS_ORIGINS`, origins separated by commas (e.g.: https://coffeeco.app, http://localhost:3000).
+// The origins are lower case, without a trailing slash (the way browsers send them)
+func ParseOrigins(origins string) ([]string, error) {
+	var parsed []string
+	for _, origin := range strings.Split(origins, ",") {
+		origin = strings.TrimSpace(origin)
+		if origin == "" {
+			continue
+		}
+
+		u, err := url.Parse(origin)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" ||
+			u.User != nil || (u.Path != "" && u.Path != "/") || u.RawQuery != "" || u.Fragment != "" {
+			return nil, fmt.Errorf("%s isn't an origin, e.g.: https://coffeeco.app", origin)
+		}
+
+		parsed = append(parsed, strings.ToLower(u.Scheme+"://"+u.Host))
+	}
+
+	return parsed, nil
+}
+
+// trustedOrigins are the origins that can send cross-origin requests, `CORS_ORIGINS` and `PUBLIC_URL`
+func (cfg Config) trustedOrigins() map[string]bool {
+	origins, _ := ParseOrigins(cfg.CORSOrigins) // Checked by [Config.Validate]
+
+	trusted := map[string]bool{}
+	for _, origin := range origins {
+		trusted[origin] = true
+	}
+
+	if public, err := url.Parse(cfg.PublicURL); err == nil && public.Host != "" {
+		trusted[strings.ToLower(public.Scheme+"://"+public.Host)] = true
+	}
+
+	return trusted
+}
+
+// isSafeMethod checks if a method can't change anything (so it doesn't need CSRF protection)
+func isSafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+
+	return false
+}
+
+// crossOriginMiddleware rejects unsafe requests (e.g. POST) sent by browsers from other sites,
+// so other sites can't use the `AuthToken` cookie (CSRF). Unsafe requests are allowed when:
+//
+//   - `Origin` is one of `CORS_ORIGINS` or `PUBLIC_URL`
+//   - `Sec-Fetch-Site` is same-origin, or none (e.g. typed by the user)
+//   - Without `Sec-Fetch-Site` (older browsers), `Origin` is the request's host
+//   - Neither is sent (not sent by a browser)
+func (srv *Server) crossOriginMiddleware(next http.Handler) http.Handler {
+	trusted := srv.Config.trustedOrigins()
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isSafeMethod(r.Method) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		origin := r.Header.Get("Origin")
+		if trusted[origin] {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		site := r.Header.Get("Sec-Fetch-Site")
+		switch site {
+		case "same-origin", "none":
+			next.ServeHTTP(w, r)
+			return
+		case "":
+			if origin == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if u, err := url.Parse(origin); err == nil && u.Host == r.Host {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+
+		utility.Error(w, utility.HTTPError{
+			Code:    "cross_origin_request",
+			Public:  "Requests from other sites aren't allowed",
+			Message: fmt.Sprintf("cross-origin %s request (Origin: %q, Sec-Fetch-Site: %q)", r.Method, origin, site),
+			Status:  http.StatusForbidden,
+		})
+	})
+}
+
+// corsMiddleware lets the `CORS_ORIGINS` read responses (with cookies), other sites can't.
+// Without `CORS_ORIGINS` no CORS headers are sent
+func (srv *Server) corsMiddleware(next http.Handler) http.Handler {
+	origins, _ := ParseOrigins(srv.Config.CORSOrigins) // Checked by [Config.Validate]
+	if len(origins) == 0 {
+		return next
+	}
+
+	return handlers.CORS(
+		handlers.AllowedOrigins(origins),
+		handlers.AllowCredentials(),
+		handlers.AllowedHeaders([]string{"Content-Type", RequestIDHeader}),
+		handlers.ExposedHeaders([]string{
+			RequestIDHeader, "Retry-After",
+			"RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "RateLimit-Policy",
+		}),
+		handlers.MaxAge(corsMaxAge),
+	)(next)
+}
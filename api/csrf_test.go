@@ -0,0 +1,101 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestParseOrigins(t *testing.T) {
+	origins, err := ParseOrigins(" https://CoffeeCo.app/, http://localhost:3000 ,")
+	if err != nil || strings.Join(origins, ",") != "https://coffeeco.app,http://localhost:3000" {
+		t.Fatalf("got %v (%v)", origins, err)
+	}
+
+	for _, invalid := range []string{"coffeeco.app", "ftp://coffeeco.app", "https://coffeeco.app/path", "https://user@coffeeco.app", "https://"} {
+		if _, err := ParseOrigins(invalid); err == nil {
+			t.Errorf("expected %q to be invalid", invalid)
+		}
+	}
+}
+
+func TestCrossOriginRequests(t *testing.T) {
+	cfg := testConfig()
+	cfg.CORSOrigins = "http://localhost:3000"
+	_, handler := newTestServer(t, cfg)
+
+	tests := []struct {
+		name, method      string
+		origin, fetchSite string
+		host              string
+		allowed           bool
+	}{
+		{"safe method", "GET", "https://evil.example", "cross-site", "", true},
+		{"cross site", "POST", "https://evil.example", "cross-site", "", false},
+		{"same site", "POST", "https://sub.coffeeco.example", "same-site", "", false},
+		{"cors origin", "POST", "http://localhost:3000", "cross-site", "", true},
+		{"public url", "POST", "https://coffeeco.example", "cross-site", "", true},
+		{"same origin", "POST", "https://coffeeco.local", "same-origin", "", true},
+		{"typed by the user", "POST", "", "none", "", true},
+		{"not a browser", "POST", "", "", "", true},
+		{"older browser, same host", "POST", "http://coffeeco.local", "", "coffeeco.local", true},
+		{"older browser, other host", "POST", "https://evil.example", "", "coffeeco.local", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest(test.method, "/api/user/log-out", nil)
+			if test.origin != "" {
+				r.Header.Set("Origin", test.origin)
+			}
+			if test.fetchSite != "" {
+				r.Header.Set("Sec-Fetch-Site", test.fetchSite)
+			}
+			if test.host != "" {
+				r.Host = test.host
+			}
+
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			if !test.allowed {
+				expectError(t, w, http.StatusForbidden, "cross_origin_request")
+			} else if w.Code == http.StatusForbidden {
+				t.Fatalf("expected the request to be allowed: %s", w.Body.String())
+			}
+		})
+	}
+}
+
+func TestCORS(t *testing.T) {
+	preflight := func(handler http.Handler, origin string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("OPTIONS", "/api/post/add", nil)
+		r.Header.Set("Origin", origin)
+		r.Header.Set("Access-Control-Request-Method", "POST")
+		r.Header.Set("Access-Control-Request-Headers", "Content-Type")
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	cfg := testConfig()
+	cfg.CORSOrigins = "http://localhost:3000"
+	_, handler := newTestServer(t, cfg)
+
+	w := preflight(handler, "http://localhost:3000")
+	if w.Header().Get("Access-Control-Allow-Origin") != "http://localhost:3000" || w.Header().Get("Access-Control-Allow-Credentials") != "true" {
+		t.Fatalf("expected the origin to be allowed with credentials, got %v", w.Header())
+	}
+
+	if w := preflight(handler, "https://evil.example"); w.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Fatalf("expected another origin not to be allowed, got %v", w.Header())
+	}
+
+	// Without `CORS_ORIGINS`, no CORS headers are sent
+	_, handler = newTestServer(t, testConfig())
+	if w := preflight(handler, "http://localhost:3000"); w.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Fatalf("expected no CORS headers, got %v", w.Header())
+	}
+}
@@ -0,0 +1,241 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Backups are named `{backupPrefix}{time}{backupExt}`, so they're sorted by time
+const (
+	backupPrefix     = "coffeeco-"
+	backupExt        = ".db"
+	backupTimeFormat = "2006-01-02T15-04-05"
+)
+
+// ErrBackupUnsupported is returned when backing up a database that isn't SQLite
+var ErrBackupUnsupported = errors.New("only SQLite can be backed up, use pg_dump for Postgres")
+
+// BackupName is the file name of a backup taken at t
+func BackupName(t time.Time) string {
+	return backupPrefix + t.UTC().Format(backupTimeFormat) + backupExt
+}
+
+// Backup copies the database to dest (which mustn't exist) using `VACUUM INTO`.
+// Safe whilst the server is running, the copy is consistent. A partial copy is removed when it fails
+func (db *DB) Backup(dest string) error {
+	if db.Dialect != SQLite {
+		return ErrBackupUnsupported
+	}
+
+	if _, err := os.Stat(dest); err == nil {
+		return fmt.Errorf("%s already exists", dest)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+		return err
+	}
+
+	if _, err := db.DB.Exec("VACUUM INTO ?", dest); err != nil {
+		os.Remove(dest)
+		return err
+	}
+
+	return nil
+}
+
+// openReadOnly opens a SQLite file without modifying it, the file must exist.
+// The path is escaped, so names containing `?`, `#` or `%` aren't read as part of the URI
+func openReadOnly(path string) (*sql.DB, error) {
+	if _, err := os.Stat(path); err != nil {
+		return nil, err
+	}
+
+	uri := url.URL{Path: filepath.ToSlash(path)}
+	return sql.Open(string(SQLite), "file:"+uri.EscapedPath()+"?mode=ro")
+}
+
+// CheckIntegrity checks a SQLite file with `PRAGMA integrity_check` and `PRAGMA foreign_key_check`
+func CheckIntegrity(path string) error {
+	db, err := openReadOnly(path)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	rows, err := db.Query("PRAGMA integrity_check")
+	if err != nil {
+		return fmt.Errorf("%s couldn't be checked: %w", path, err)
+	}
+	defer rows.Close()
+
+	var problems []string
+	for rows.Next() {
+		var problem string
+		if err := rows.Scan(&problem); err != nil {
+			return err
+		}
+
+		if problem != "ok" {
+			problems = append(problems, problem)
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	var violations int
+	if err := db.QueryRow("SELECT COUNT(*) FROM pragma_foreign_key_check").Scan(&violations); err != nil {
+		return err
+	}
+
+	if violations != 0 {
+		problems = append(problems, fmt.Sprintf("%d rows break foreign keys", violations))
+	}
+
+	if len(problems) != 0 {
+		return fmt.Errorf("%s failed the integrity check: %s", path, strings.Join(problems, ", "))
+	}
+
+	return nil
+}
+
+// Restore checks a backup then copies it to dest, which mustn't exist (restore into a fresh path)
+func Restore(backup, dest string) error {
+	if err := CheckIntegrity(backup); err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(dest); err == nil {
+		return fmt.Errorf("%s already exists, restore into a fresh path", dest)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+		return err
+	}
+
+	db, err := openReadOnly(backup)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if _, err := db.Exec("VACUUM INTO ?", dest); err != nil {
+		return err
+	}
+
+	return CheckIntegrity(dest)
+}
+
+// BackupSchedule is when backups are taken and how many are kept
+type BackupSchedule struct {
+	Dir      string        // Where backups are stored
+	Interval time.Duration // How often a backup is taken
+	Keep     int           // The amount of backups kept, the oldest are removed (0 keeps every backup)
+}
+
+// ScheduleBackups takes a backup (into schedule.Dir) every interval, checks it and removes old backups.
+// A backup which fails or doesn't pass the check is removed, without removing old backups.
+// done is called after every backup, with the backup's path.
+//
+// Returns a function which stops the backups, waiting for a running backup to finish
+func (db *DB) ScheduleBackups(schedule BackupSchedule, done func(path string, err error)) (stop func()) {
+	var (
+		ticker = time.NewTicker(schedule.Interval)
+		quit   = make(chan struct{})
+		wg     sync.WaitGroup
+	)
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		for {
+			select {
+			case <-quit:
+				return
+			case now := <-ticker.C:
+				path := filepath.Join(schedule.Dir, BackupName(now))
+
+				err := db.Backup(path)
+				if err == nil {
+					if err = CheckIntegrity(path); err != nil {
+						os.Remove(path)
+					}
+				}
+				if err == nil {
+					err = PruneBackups(schedule.Dir, schedule.Keep)
+				}
+
+				done(path, err)
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			ticker.Stop()
+			close(quit)
+			wg.Wait()
+		})
+	}
+}
+
+// PruneBackups removes the oldest backups in dir, keeping the newest keep backups which pass the integrity check
+// (0 keeps every backup). Backups failing the check don't count towards keep, so they never replace good backups
+func PruneBackups(dir string, keep int) error {
+	if keep <= 0 {
+		return nil
+	}
+
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	var backups []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.IsDir() && strings.HasPrefix(name, backupPrefix) && strings.HasSuffix(name, backupExt) {
+			backups = append(backups, name)
+		}
+	}
+
+	sort.Sort(sort.Reverse(sort.StringSlice(backups))) // Newest first
+
+	kept := 0
+	for i, name := range backups {
+		if kept == keep {
+			return removeBackups(dir, backups[i:])
+		}
+
+		if CheckIntegrity(filepath.Join(dir, name)) == nil {
+			kept++
+		}
+	}
+
+	return nil
+}
+
+// removeBackups removes the backups (file names) in dir
+func removeBackups(dir string, backups []string) error {
+	for _, name := range backups {
+		if err := os.Remove(filepath.Join(dir, name)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
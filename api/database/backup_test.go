@@ -0,0 +1,76 @@
+package database_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Blockitifluy/CoffeeCo/api/database"
+	"github.com/Blockitifluy/CoffeeCo/api/database/dbtest"
+)
+
+func TestBackupAndRestore(t *testing.T) {
+	db := dbtest.Migrated(t, database.SQLite)
+	if _, err := db.Exec("INSERT INTO Users (username, password, handle, auth, timeCreated) VALUES (?, ?, ?, ?, ?)",
+		"Coffee", []byte{1}, "coffee", "auth", time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	// Characters with a meaning in URIs are escaped
+	dir := filepath.Join(t.TempDir(), "back?ups #1 100%")
+	backup := filepath.Join(dir, database.BackupName(time.Now()))
+
+	if err := db.Backup(backup); err != nil {
+		t.Fatal(err)
+	}
+	if err := database.CheckIntegrity(backup); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Backup(backup); err == nil {
+		t.Fatal("expected backing up to an existing file to fail")
+	}
+
+	restored := filepath.Join(dir, "restored.db")
+	if err := database.Restore(backup, restored); err != nil {
+		t.Fatal(err)
+	}
+	if err := database.Restore(backup, restored); err == nil {
+		t.Fatal("expected restoring to an existing file to fail")
+	}
+
+	if err := database.CheckIntegrity(filepath.Join(dir, "missing.db")); err == nil {
+		t.Fatal("expected checking a missing file to fail")
+	}
+}
+
+func TestPruneBackups(t *testing.T) {
+	db := dbtest.Migrated(t, database.SQLite)
+	dir := t.TempDir()
+	start := time.Date(2024, 6, 13, 0, 0, 0, 0, time.UTC)
+
+	var backups []string
+	for i := 0; i < 4; i++ {
+		path := filepath.Join(dir, database.BackupName(start.Add(time.Duration(i)*time.Hour)))
+		if err := db.Backup(path); err != nil {
+			t.Fatal(err)
+		}
+		backups = append(backups, path)
+	}
+
+	// The newest backup is corrupted, so it doesn't count towards the kept backups
+	if err := os.WriteFile(backups[3], []byte("not a database"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := database.PruneBackups(dir, 2); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, path := range backups {
+		_, err := os.Stat(path)
+		if kept := i != 0; kept != (err == nil) {
+			t.Errorf("backup %d: expected kept to be %t (%v)", i, kept, err)
+		}
+	}
+}
@@ -0,0 +1,234 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	_ "github.com/lib/pq"           // Used for a driver by database/sql
+	_ "github.com/mattn/go-sqlite3" // Used for a driver by database/sql
+)
+
+// Dialect is a supported database, it's also the name of it's driver
+type Dialect string
+
+// Supported dialects
+const (
+	SQLite   Dialect = "sqlite3"
+	Postgres Dialect = "postgres"
+)
+
+// sqliteOptions are added to SQLite's connection string:
+//
+//   - WAL, so reads don't wait for writes
+//   - busy_timeout, writes wait (up to 5 seconds) for other writes instead of failing with `database is locked`
+//   - foreign_keys, enforces foreign keys (off by default)
+//   - synchronous=NORMAL, commits don't wait for the disk (safe when using WAL)
+//   - txlock=immediate, transactions lock when they begin, so they can't deadlock when upgrading to a write
+const sqliteOptions = "_journal_mode=WAL&_busy_timeout=5000&_foreign_keys=on&_synchronous=NORMAL&_txlock=immediate"
+
+// Connection pool limits of Postgres
+const (
+	postgresMaxConns    = 25
+	postgresMaxIdleTime = 5 * time.Minute
+)
+
+// DB is a database and it's dialect.
+//
+// Queries are written with `?` placeholders, they're rebound for the dialect (e.g. `$1` for Postgres)
+type DB struct {
+	*sql.DB
+	Dialect Dialect
+
+	// Observe is called after a query (see [DB.Exec], [DB.Query], [DB.QueryRow] and [DB.QueryPrepared]),
+	// with it's operation and table (see [DescribeQuery]). Set it before the database is used
+	Observe func(operation, table string, took time.Duration)
+
+	mu    sync.Mutex
+	stmts map[string]*sql.Stmt // Prepared statements, by query
+}
+
+// ParseDialect gets the dialect of a driver name (`DB_DRIVER`), empty is [SQLite]
+func ParseDialect(driver string) (Dialect, error) {
+	switch strings.ToLower(driver) {
+	case "", "sqlite", "sqlite3":
+		return SQLite, nil
+	case "postgres", "postgresql":
+		return Postgres, nil
+	}
+
+	return "", fmt.Errorf("unsupported database driver %s (use sqlite3 or postgres)", driver)
+}
+
+// Open opens and connects to a database, source is a file path for SQLite or a connection string for Postgres.
+//
+// SQLite is opened with WAL, a busy timeout and foreign keys (see [sqliteOptions])
+func Open(dialect Dialect, source string) (*DB, error) {
+	if dialect == SQLite {
+		source = sqliteSource(source)
+	}
+
+	db, err := sql.Open(string(dialect), source)
+	if err != nil {
+		return nil, err
+	}
+
+	switch dialect {
+	case SQLite: // Only one connection can write at a time, extra connections only help reads
+		conns := max(4, runtime.NumCPU())
+		db.SetMaxOpenConns(conns)
+		db.SetMaxIdleConns(conns)
+	case Postgres:
+		db.SetMaxOpenConns(postgresMaxConns)
+		db.SetMaxIdleConns(postgresMaxConns)
+		db.SetConnMaxIdleTime(postgresMaxIdleTime)
+	}
+
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &DB{DB: db, Dialect: dialect, stmts: map[string]*sql.Stmt{}}, nil
+}
+
+// sqliteSource adds [sqliteOptions] to a file path
+func sqliteSource(path string) string {
+	if !strings.HasPrefix(path, "file:") {
+		path = "file:" + path
+	}
+
+	if strings.Contains(path, "?") {
+		return path + "&" + sqliteOptions
+	}
+	return path + "?" + sqliteOptions
+}
+
+// Prepared gets the prepared statement of a query, preparing it on first use.
+// Used for hot queries, the statement is closed by [DB.Close]
+func (db *DB) Prepared(query string) (*sql.Stmt, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if stmt, ok := db.stmts[query]; ok {
+		return stmt, nil
+	}
+
+	stmt, err := db.DB.Prepare(db.Rebind(query))
+	if err != nil {
+		return nil, err
+	}
+
+	db.stmts[query] = stmt
+	return stmt, nil
+}
+
+// Close closes the prepared statements and the database
+func (db *DB) Close() error {
+	db.mu.Lock()
+	for query, stmt := range db.stmts {
+		stmt.Close()
+		delete(db.stmts, query)
+	}
+	db.mu.Unlock()
+
+	return db.DB.Close()
+}
+
+// Rebind changes the `?` placeholders of query to the dialect's placeholders
+func (db *DB) Rebind(query string) string {
+	if db.Dialect != Postgres {
+		return query
+	}
+
+	var (
+		b       strings.Builder
+		n       int
+		inQuote bool
+	)
+
+	for _, char := range query {
+		switch {
+		case char == '\'':
+			inQuote = !inQuote
+		case char == '?' && !inQuote:
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+
+		b.WriteRune(char)
+	}
+
+	return b.String()
+}
+
+// observe calls [DB.Observe] (if set) with the time since start
+func (db *DB) observe(query string, start time.Time) {
+	if db.Observe == nil {
+		return
+	}
+
+	operation, table := DescribeQuery(query)
+	db.Observe(operation, table, time.Since(start))
+}
+
+// DescribeQuery gets the operation (e.g. SELECT) and the table of a query (empty when it doesn't have one),
+// so queries can be grouped without their arguments
+func DescribeQuery(query string) (operation, table string) {
+	words := strings.Fields(query)
+	if len(words) == 0 {
+		return "", ""
+	}
+
+	operation = strings.ToUpper(words[0])
+
+	before := "FROM"
+	switch operation {
+	case "INSERT":
+		before = "INTO"
+	case "UPDATE":
+		return operation, strings.Trim(words[min(1, len(words)-1)], `"(`)
+	}
+
+	for i, word := range words[:len(words)-1] {
+		if strings.ToUpper(word) == before {
+			return operation, strings.Trim(words[i+1], `"(`)
+		}
+	}
+
+	return operation, ""
+}
+
+// Exec is [sql.DB.Exec] with the query rebound
+func (db *DB) Exec(query string, args ...any) (sql.Result, error) {
+	defer db.observe(query, time.Now())
+	return db.DB.Exec(db.Rebind(query), args...)
+}
+
+// Query is [sql.DB.Query] with the query rebound
+func (db *DB) Query(query string, args ...any) (*sql.Rows, error) {
+	defer db.observe(query, time.Now())
+	return db.DB.Query(db.Rebind(query), args...)
+}
+
+// QueryRow is [sql.DB.QueryRow] with the query rebound
+func (db *DB) QueryRow(query string, args ...any) *sql.Row {
+	defer db.observe(query, time.Now())
+	return db.DB.QueryRow(db.Rebind(query), args...)
+}
+
+// QueryPrepared queries using the prepared statement of query (see [DB.Prepared])
+func (db *DB) QueryPrepared(query string, args ...any) (*sql.Rows, error) {
+	stmt, err := db.Prepared(query)
+	if err != nil {
+		return nil, err
+	}
+
+	defer db.observe(query, time.Now())
+	return stmt.Query(args...)
+}
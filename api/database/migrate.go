@@ -0,0 +1,338 @@
+// Package database opens the database (SQLite or Postgres) and contains it's migrations, embedded in the executable.
+//
+// Migrations are in `migrations/{dialect}/`, named `{version}_{name}.up.sql` and `{version}_{name}.down.sql`.
+// Every dialect has the same versions. Applied migrations are stored in the `schema_migrations` table
+package database
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed migrations/*/*.sql
+var migrationFiles embed.FS
+
+var migrationName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+const createMigrationsTable = `
+CREATE TABLE IF NOT EXISTS schema_migrations (
+	version INTEGER PRIMARY KEY,
+	name TEXT NOT NULL,
+	appliedAt TIMESTAMP NOT NULL
+)`
+
+// Migration is a versioned change to the database's schema
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Migrations gets every migration of a dialect, sorted by version
+func Migrations(dialect Dialect) ([]Migration, error) {
+	dir := "migrations/" + string(dialect)
+
+	entries, err := fs.ReadDir(migrationFiles, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int]*Migration{}
+	for _, entry := range entries {
+		match := migrationName.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("invalid migration name %s", entry.Name())
+		}
+
+		version, _ := strconv.Atoi(match[1])
+		content, err := fs.ReadFile(migrationFiles, dir+"/"+entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = migration
+		} else if migration.Name != match[2] {
+			return nil, fmt.Errorf("migration %d has two names (%s and %s)", version, migration.Name, match[2])
+		}
+
+		if match[3] == "up" {
+			migration.Up = string(content)
+		} else {
+			migration.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" || migration.Down == "" {
+			return nil, fmt.Errorf("migration %d_%s needs an up and down file", migration.Version, migration.Name)
+		}
+		migrations = append(migrations, *migration)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+// Latest is the version of the newest migration
+func Latest(dialect Dialect) (int, error) {
+	migrations, err := Migrations(dialect)
+	if err != nil || len(migrations) == 0 {
+		return 0, err
+	}
+
+	return migrations[len(migrations)-1].Version, nil
+}
+
+// Version gets the version of the database, 0 when no migrations have been applied
+func Version(db *DB) (int, error) {
+	if _, err := db.Exec(createMigrationsTable); err != nil {
+		return 0, err
+	}
+
+	var version int
+	err := db.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&version)
+	return version, err
+}
+
+// Up applies every migration that hasn't been applied. Returns the migrations applied
+func Up(db *DB) ([]Migration, error) {
+	latest, err := Latest(db.Dialect)
+	if err != nil {
+		return nil, err
+	}
+
+	return To(db, latest)
+}
+
+// Down reverts the last applied migration. Returns the migrations reverted
+func Down(db *DB) ([]Migration, error) {
+	current, err := Version(db)
+	if err != nil {
+		return nil, err
+	}
+
+	if current == 0 {
+		return nil, nil
+	}
+
+	migrations, err := Migrations(db.Dialect)
+	if err != nil {
+		return nil, err
+	}
+
+	target := 0
+	for _, migration := range migrations {
+		if migration.Version < current {
+			target = migration.Version
+		}
+	}
+
+	return To(db, target)
+}
+
+// To migrates the database up or down to a version (0 reverts every migration).
+// Each migration is applied in it's own transaction. Returns the migrations applied or reverted
+func To(db *DB, version int) ([]Migration, error) {
+	migrations, err := Migrations(db.Dialect)
+	if err != nil {
+		return nil, err
+	}
+
+	if version != 0 && !hasVersion(migrations, version) {
+		return nil, fmt.Errorf("migration %d doesn't exist", version)
+	}
+
+	current, err := Version(db)
+	if err != nil {
+		return nil, err
+	}
+
+	current, err = adoptDBInit(db, migrations, current)
+	if err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+
+	if version >= current {
+		for _, migration := range migrations {
+			if migration.Version <= current || migration.Version > version {
+				continue
+			}
+
+			if err := checkRows(db, migration); err != nil {
+				return done, err
+			}
+
+			if err := apply(db, migration, true); err != nil {
+				return done, err
+			}
+			done = append(done, migration)
+		}
+
+		return done, nil
+	}
+
+	for i := len(migrations) - 1; i >= 0; i-- {
+		migration := migrations[i]
+		if migration.Version > current || migration.Version <= version {
+			continue
+		}
+
+		if err := apply(db, migration, false); err != nil {
+			return done, err
+		}
+		done = append(done, migration)
+	}
+
+	return done, nil
+}
+
+// dbInitVersion is the migration matching the schema of the old `db-init` script, once it had the image meta columns
+const dbInitVersion = 2
+
+// adoptDBInit records the migrations a SQLite database created by the old `db-init` script already has
+// (so adding the image meta columns again doesn't fail). Returns the version of the database
+func adoptDBInit(db *DB, migrations []Migration, current int) (int, error) {
+	if current != 0 || db.Dialect != SQLite {
+		return current, nil
+	}
+
+	if _, err := db.Exec("SELECT blurHash FROM Images LIMIT 0"); err != nil {
+		return current, nil // A new database, or created before the image meta columns
+	}
+
+	if _, err := db.Exec("SELECT etag FROM Images LIMIT 0"); err != nil { // db-init had etag added later
+		if _, err := db.Exec("ALTER TABLE Images ADD COLUMN etag TEXT NOT NULL DEFAULT ''"); err != nil {
+			return current, err
+		}
+	}
+
+	for _, migration := range migrations {
+		if migration.Version > dbInitVersion {
+			break
+		}
+
+		record := "INSERT INTO schema_migrations (version, name, appliedAt) VALUES (?, ?, ?)"
+		if _, err := db.Exec(record, migration.Version, migration.Name, time.Now()); err != nil {
+			return current, err
+		}
+	}
+
+	return dbInitVersion, nil
+}
+
+// rowCheck finds the rows breaking a migration's constraints, query selects their IDs
+type rowCheck struct {
+	problem string // e.g. Posts without content
+	query   string
+}
+
+// rowChecks are run before a migration (by version) is applied, so it fails listing the rows to fix
+// instead of removing them. The queries are written for every dialect
+var rowChecks = map[int][]rowCheck{
+	3: {
+		{"Users with a handle that isn't 1 to 24 characters", "SELECT ID FROM Users WHERE handle IS NULL OR length(handle) NOT BETWEEN 1 AND 24"},
+		{"Posts posted by a missing user", "SELECT ID FROM Posts WHERE PostedBy IS NULL OR PostedBy NOT IN (SELECT ID FROM Users)"},
+		{"Posts with content that isn't 1 to 240 characters", "SELECT ID FROM Posts WHERE content IS NULL OR length(content) NOT BETWEEN 1 AND 240"},
+		{"Comments of a missing post", "SELECT ID FROM Posts WHERE parentID <> -1 AND parentID NOT IN (SELECT ID FROM Posts)"},
+		{"Images without content or an image mimetype", "SELECT URL FROM Images WHERE content IS NULL OR mimetype IS NULL OR mimetype NOT LIKE 'image/%'"},
+		{"Images with a negative size", "SELECT URL FROM Images WHERE width < 0 OR height < 0"},
+	},
+}
+
+// maxListedRows is the most IDs listed for each problem by [checkRows]
+const maxListedRows = 20
+
+// checkRows runs the [rowChecks] of a migration, returning an error listing the rows breaking it
+func checkRows(db *DB, migration Migration) error {
+	var problems []string
+	for _, check := range rowChecks[migration.Version] {
+		rows, err := db.Query(check.query)
+		if err != nil {
+			return err
+		}
+
+		var IDs []string
+		for rows.Next() {
+			var ID string
+			if err := rows.Scan(&ID); err != nil {
+				rows.Close()
+				return err
+			}
+			IDs = append(IDs, ID)
+		}
+		rows.Close()
+
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		if len(IDs) == 0 {
+			continue
+		}
+
+		listed := strings.Join(IDs[:min(len(IDs), maxListedRows)], ", ")
+		if len(IDs) > maxListedRows {
+			listed += fmt.Sprintf(" (and %d more)", len(IDs)-maxListedRows)
+		}
+		problems = append(problems, fmt.Sprintf("%s: %s", check.problem, listed))
+	}
+
+	if len(problems) == 0 {
+		return nil
+	}
+
+	return fmt.Errorf("migration %d_%s can't be applied, fix or remove these rows first:\n  %s",
+		migration.Version, migration.Name, strings.Join(problems, "\n  "))
+}
+
+func hasVersion(migrations []Migration, version int) bool {
+	for _, migration := range migrations {
+		if migration.Version == version {
+			return true
+		}
+	}
+
+	return false
+}
+
+// apply runs a migration (up or down) and records it, in a transaction
+func apply(db *DB, migration Migration, up bool) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	script, record, args := migration.Down, "DELETE FROM schema_migrations WHERE version = ?", []any{migration.Version}
+	if up {
+		script = migration.Up
+		record = "INSERT INTO schema_migrations (version, name, appliedAt) VALUES (?, ?, ?)"
+		args = append(args, migration.Name, time.Now())
+	}
+
+	if _, err := tx.Exec(script); err != nil {
+		return fmt.Errorf("migration %d_%s failed: %w", migration.Version, migration.Name, err)
+	}
+
+	if _, err := tx.Exec(db.Rebind(record), args...); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
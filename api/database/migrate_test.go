@@ -0,0 +1,278 @@
+package database_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Blockitifluy/CoffeeCo/api/database"
+	"github.com/Blockitifluy/CoffeeCo/api/database/dbtest"
+)
+
+func TestRebind(t *testing.T) {
+	tests := []struct {
+		query, sqlite, postgres string
+	}{
+		{"SELECT 1", "SELECT 1", "SELECT 1"},
+		{"SELECT * FROM Users WHERE id = ?", "SELECT * FROM Users WHERE id = ?", "SELECT * FROM Users WHERE id = $1"},
+		{"VALUES (?, ?, NULLIF(?, -1))", "VALUES (?, ?, NULLIF(?, -1))", "VALUES ($1, $2, NULLIF($3, -1))"},
+		{"WHERE a = '?' AND b = ?", "WHERE a = '?' AND b = ?", "WHERE a = '?' AND b = $1"},
+		{"WHERE a = 'it''s?' AND b = ?", "WHERE a = 'it''s?' AND b = ?", "WHERE a = 'it''s?' AND b = $1"},
+	}
+
+	sqlite, postgres := &database.DB{Dialect: database.SQLite}, &database.DB{Dialect: database.Postgres}
+	for _, test := range tests {
+		if got := sqlite.Rebind(test.query); got != test.sqlite {
+			t.Errorf("sqlite: Rebind(%q) = %q, expected %q", test.query, got, test.sqlite)
+		}
+
+		if got := postgres.Rebind(test.query); got != test.postgres {
+			t.Errorf("postgres: Rebind(%q) = %q, expected %q", test.query, got, test.postgres)
+		}
+	}
+}
+
+func TestMigrationsMatch(t *testing.T) {
+	sqlite, err := database.Migrations(database.SQLite)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	postgres, err := database.Migrations(database.Postgres)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(sqlite) != len(postgres) {
+		t.Fatalf("sqlite has %d migrations, postgres has %d", len(sqlite), len(postgres))
+	}
+
+	for i := range sqlite {
+		if sqlite[i].Version != postgres[i].Version || sqlite[i].Name != postgres[i].Name {
+			t.Errorf("migration %d is %d_%s for sqlite, %d_%s for postgres",
+				i, sqlite[i].Version, sqlite[i].Name, postgres[i].Version, postgres[i].Name)
+		}
+	}
+}
+
+// expectVersion fails when the database isn't at version
+func expectVersion(t *testing.T, db *database.DB, version int) {
+	t.Helper()
+
+	current, err := database.Version(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if current != version {
+		t.Fatalf("database is at version %d, expected %d", current, version)
+	}
+}
+
+func TestMigrateUpAndDown(t *testing.T) {
+	dbtest.Run(t, func(t *testing.T, dialect database.Dialect) {
+		db := dbtest.Open(t, dialect)
+
+		latest, err := database.Latest(dialect)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		applied, err := database.Up(db)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(applied) != latest {
+			t.Fatalf("applied %d migrations, expected %d", len(applied), latest)
+		}
+		expectVersion(t, db, latest)
+
+		if applied, err := database.Up(db); err != nil || len(applied) != 0 {
+			t.Fatalf("migrating again applied %d migrations (%v)", len(applied), err)
+		}
+
+		reverted, err := database.Down(db)
+		if err != nil || len(reverted) != 1 {
+			t.Fatalf("down reverted %d migrations (%v), expected 1", len(reverted), err)
+		}
+		expectVersion(t, db, latest-1)
+
+		if _, err := database.To(db, 0); err != nil {
+			t.Fatal(err)
+		}
+		expectVersion(t, db, 0)
+
+		if _, err := db.Exec("SELECT 1 FROM Posts"); err == nil {
+			t.Fatal("expected reverting every migration to drop Posts")
+		}
+
+		if _, err := database.Up(db); err != nil {
+			t.Fatalf("couldn't migrate after reverting: %v", err)
+		}
+		expectVersion(t, db, latest)
+
+		if _, err := database.To(db, latest+1); err == nil {
+			t.Fatal("expected migrating to a missing version to fail")
+		}
+	})
+}
+
+// oldData adds a user, a post, a comment and an image to a database at version 2, when top-level posts had a parentID of -1
+func oldData(t *testing.T, db *database.DB) {
+	t.Helper()
+
+	queries := []struct {
+		query string
+		args  []any
+	}{
+		{"INSERT INTO Users (ID, username, password, handle, auth, timeCreated) VALUES (?, ?, ?, ?, ?, ?)",
+			[]any{1, "Coffee", []byte{1, 2, 3, 4}, "coffee", "auth", time.Now()}},
+		{"INSERT INTO Posts (ID, PostedBy, content, timeCreated, parentID, images) VALUES (?, ?, ?, ?, ?, ?)",
+			[]any{1, 1, "Hello", time.Now(), -1, ""}},
+		{"INSERT INTO Posts (ID, PostedBy, content, timeCreated, parentID, images) VALUES (?, ?, ?, ?, ?, ?)",
+			[]any{2, 1, "A comment", time.Now(), 1, ""}},
+		{"INSERT INTO Images (URL, content, mimetype, width, height, blurHash, color) VALUES (?, ?, ?, ?, ?, ?, ?)",
+			[]any{"image", []byte{1}, "image/png", 1, 1, "", ""}},
+	}
+
+	for _, q := range queries {
+		if _, err := db.Exec(q.query, q.args...); err != nil {
+			t.Fatalf("couldn't add old data: %v", err)
+		}
+	}
+}
+
+func TestMigrateExistingData(t *testing.T) {
+	dbtest.Run(t, func(t *testing.T, dialect database.Dialect) {
+		db := dbtest.Open(t, dialect)
+
+		if _, err := database.To(db, 2); err != nil {
+			t.Fatal(err)
+		}
+		oldData(t, db)
+
+		if _, err := database.Up(db); err != nil {
+			t.Fatal(err)
+		}
+
+		var posts, topLevel, comments, users, images int
+		counts := []struct {
+			query string
+			count *int
+		}{
+			{"SELECT COUNT(*) FROM Posts", &posts},
+			{"SELECT COUNT(*) FROM Posts WHERE parentID IS NULL", &topLevel},
+			{"SELECT COUNT(*) FROM Posts WHERE parentID = 1", &comments},
+			{"SELECT COUNT(*) FROM Users WHERE handle = 'coffee'", &users},
+			{"SELECT COUNT(*) FROM Images WHERE etag = ''", &images},
+		}
+
+		for _, c := range counts {
+			if err := db.QueryRow(c.query).Scan(c.count); err != nil {
+				t.Fatalf("%s: %v", c.query, err)
+			}
+		}
+
+		if posts != 2 || topLevel != 1 || comments != 1 || users != 1 || images != 1 {
+			t.Fatalf("got %d posts (%d top-level, %d comments), %d users and %d images", posts, topLevel, comments, users, images)
+		}
+
+		// The migrated foreign keys are enforced
+		if _, err := db.Exec("INSERT INTO Posts (PostedBy, content, timeCreated, parentID) VALUES (?, ?, ?, ?)", 1, "Hi", time.Now(), 999); err == nil {
+			t.Fatal("expected a comment of a missing post to fail")
+		}
+	})
+}
+
+func TestMigrateDBInit(t *testing.T) {
+	db := dbtest.Open(t, database.SQLite)
+
+	// The schema created by the old db-init script, which doesn't record migrations
+	if _, err := database.To(db, 2); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("DELETE FROM schema_migrations"); err != nil {
+		t.Fatal(err)
+	}
+	expectVersion(t, db, 0)
+
+	if _, err := database.Up(db); err != nil {
+		t.Fatalf("couldn't migrate a db-init database: %v", err)
+	}
+
+	latest, err := database.Latest(database.SQLite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectVersion(t, db, latest)
+}
+
+// Rows breaking the constraints of 0003_constraints fail the migration (listing them), they're never removed
+func TestMigrateInvalidRows(t *testing.T) {
+	dbtest.Run(t, func(t *testing.T, dialect database.Dialect) {
+		db := dbtest.Open(t, dialect)
+
+		if _, err := database.To(db, 2); err != nil {
+			t.Fatal(err)
+		}
+		oldData(t, db)
+
+		invalid := []struct {
+			query string
+			args  []any
+		}{
+			{"INSERT INTO Users (ID, username, password, handle, auth, timeCreated) VALUES (?, ?, ?, ?, ?, ?)",
+				[]any{2, "Long", []byte{1}, strings.Repeat("a", 25), "auth2", time.Now()}},
+			{"INSERT INTO Posts (ID, PostedBy, content, timeCreated, parentID, images) VALUES (?, ?, ?, ?, ?, ?)",
+				[]any{3, 1, "", time.Now(), -1, ""}},
+			{"INSERT INTO Posts (ID, PostedBy, content, timeCreated, parentID, images) VALUES (?, ?, ?, ?, ?, ?)",
+				[]any{4, 1, "An orphan", time.Now(), 999, ""}},
+		}
+
+		for _, q := range invalid {
+			if _, err := db.Exec(q.query, q.args...); err != nil {
+				t.Fatalf("couldn't add invalid data: %v", err)
+			}
+		}
+
+		_, err := database.Up(db)
+		if err == nil {
+			t.Fatal("expected the migration to fail")
+		}
+
+		for _, listed := range []string{"migration 3_constraints", "handle that isn't 1 to 24 characters: 2", "content that isn't 1 to 240 characters: 3", "Comments of a missing post: 4"} {
+			if !strings.Contains(err.Error(), listed) {
+				t.Errorf("expected the error to contain %q: %v", listed, err)
+			}
+		}
+		expectVersion(t, db, 2)
+
+		var posts, users int
+		if err := db.QueryRow("SELECT COUNT(*) FROM Posts").Scan(&posts); err != nil || posts != 4 {
+			t.Fatalf("got %d posts (%v), expected nothing to be removed", posts, err)
+		}
+		if err := db.QueryRow("SELECT COUNT(*) FROM Users").Scan(&users); err != nil || users != 2 {
+			t.Fatalf("got %d users (%v), expected nothing to be removed", users, err)
+		}
+
+		// Migrates once they're fixed
+		fixes := []string{
+			"UPDATE Users SET handle = 'long' WHERE ID = 2",
+			"UPDATE Posts SET content = 'Not empty' WHERE ID = 3",
+			"UPDATE Posts SET parentID = -1 WHERE ID = 4",
+		}
+		for _, fix := range fixes {
+			if _, err := db.Exec(fix); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if _, err := database.Up(db); err != nil {
+			t.Fatalf("couldn't migrate the fixed rows: %v", err)
+		}
+
+		if err := db.QueryRow("SELECT COUNT(*) FROM Posts").Scan(&posts); err != nil || posts != 4 {
+			t.Fatalf("got %d posts (%v) after migrating, expected 4", posts, err)
+		}
+	})
+}
@@ -0,0 +1,41 @@
+CREATE TABLE IF NOT EXISTS Images (
+    URL TEXT PRIMARY KEY,
+    content BYTEA,
+    mimetype TEXT
+);
+
+CREATE TABLE IF NOT EXISTS Posts (
+    ID SERIAL PRIMARY KEY,
+    PostedBy INTEGER,
+    content TEXT,
+
+    likes INTEGER DEFAULT 0,
+    whoLiked TEXT NOT NULL DEFAULT '',
+
+    dislikes INTEGER DEFAULT 0,
+    whoDisliked TEXT NOT NULL DEFAULT '',
+
+    timeCreated TIMESTAMP,
+    parentID INTEGER,
+    images TEXT
+);
+
+CREATE TABLE IF NOT EXISTS Users (
+    ID SERIAL PRIMARY KEY,
+    username TEXT,
+    password BYTEA,
+    handle TEXT UNIQUE,
+    email TEXT NULL,
+    bio TEXT DEFAULT '',
+
+    auth TEXT NOT NULL,
+    timeCreated TIMESTAMP,
+
+    Followers INTEGER DEFAULT 0,
+    whoFollowed TEXT DEFAULT '',
+
+    posts INTEGER DEFAULT 0,
+
+    profile TEXT DEFAULT '',
+    banner TEXT DEFAULT ''
+);
@@ -0,0 +1,5 @@
+ALTER TABLE Images ADD COLUMN width INTEGER DEFAULT 0;
+ALTER TABLE Images ADD COLUMN height INTEGER DEFAULT 0;
+ALTER TABLE Images ADD COLUMN blurHash TEXT NOT NULL DEFAULT '';
+ALTER TABLE Images ADD COLUMN color TEXT NOT NULL DEFAULT '';
+ALTER TABLE Images ADD COLUMN etag TEXT NOT NULL DEFAULT '';
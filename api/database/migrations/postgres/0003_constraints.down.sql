@@ -0,0 +1,40 @@
+DROP INDEX IF EXISTS Users_timeCreated;
+DROP INDEX IF EXISTS Users_auth;
+DROP INDEX IF EXISTS Posts_timeCreated;
+DROP INDEX IF EXISTS Posts_parentID;
+DROP INDEX IF EXISTS Posts_PostedBy;
+
+ALTER TABLE Images
+    DROP CONSTRAINT Images_size_positive,
+    DROP CONSTRAINT Images_mimetype_image,
+    ALTER COLUMN height DROP NOT NULL,
+    ALTER COLUMN width DROP NOT NULL,
+    ALTER COLUMN mimetype DROP NOT NULL,
+    ALTER COLUMN content DROP NOT NULL;
+
+ALTER TABLE Posts
+    DROP CONSTRAINT Posts_parentID_fkey,
+    DROP CONSTRAINT Posts_PostedBy_fkey,
+    DROP CONSTRAINT Posts_content_length,
+    ALTER COLUMN images DROP DEFAULT,
+    ALTER COLUMN images DROP NOT NULL,
+    ALTER COLUMN timeCreated DROP NOT NULL,
+    ALTER COLUMN dislikes DROP NOT NULL,
+    ALTER COLUMN likes DROP NOT NULL,
+    ALTER COLUMN content DROP NOT NULL,
+    ALTER COLUMN PostedBy DROP NOT NULL;
+
+ALTER TABLE Users
+    DROP CONSTRAINT Users_handle_length,
+    ALTER COLUMN banner DROP NOT NULL,
+    ALTER COLUMN profile DROP NOT NULL,
+    ALTER COLUMN posts DROP NOT NULL,
+    ALTER COLUMN whoFollowed DROP NOT NULL,
+    ALTER COLUMN Followers DROP NOT NULL,
+    ALTER COLUMN timeCreated DROP NOT NULL,
+    ALTER COLUMN bio DROP NOT NULL,
+    ALTER COLUMN handle DROP NOT NULL,
+    ALTER COLUMN password DROP NOT NULL,
+    ALTER COLUMN username DROP NOT NULL;
+
+UPDATE Posts SET parentID = -1 WHERE parentID IS NULL;
@@ -0,0 +1,55 @@
+-- Top-level posts had a parentID of -1, it's now NULL so comments can reference their parent.
+-- Rows breaking the constraints are found before the migration is applied (see checks in migrate.go), nothing is removed.
+
+UPDATE Posts SET parentID = NULL WHERE parentID = -1;
+
+UPDATE Users SET
+    username = COALESCE(username, ''), password = COALESCE(password, ''::BYTEA), bio = COALESCE(bio, ''),
+    timeCreated = COALESCE(timeCreated, CURRENT_TIMESTAMP), Followers = COALESCE(Followers, 0),
+    whoFollowed = COALESCE(whoFollowed, ''), posts = COALESCE(posts, 0),
+    profile = COALESCE(profile, ''), banner = COALESCE(banner, '');
+
+UPDATE Posts SET
+    likes = COALESCE(likes, 0), dislikes = COALESCE(dislikes, 0),
+    timeCreated = COALESCE(timeCreated, CURRENT_TIMESTAMP), images = COALESCE(images, '');
+
+UPDATE Images SET width = COALESCE(width, 0), height = COALESCE(height, 0);
+
+ALTER TABLE Users
+    ALTER COLUMN username SET NOT NULL,
+    ALTER COLUMN password SET NOT NULL,
+    ALTER COLUMN handle SET NOT NULL,
+    ALTER COLUMN bio SET NOT NULL,
+    ALTER COLUMN timeCreated SET NOT NULL,
+    ALTER COLUMN Followers SET NOT NULL,
+    ALTER COLUMN whoFollowed SET NOT NULL,
+    ALTER COLUMN posts SET NOT NULL,
+    ALTER COLUMN profile SET NOT NULL,
+    ALTER COLUMN banner SET NOT NULL,
+    ADD CONSTRAINT Users_handle_length CHECK (char_length(handle) BETWEEN 1 AND 24);
+
+ALTER TABLE Posts
+    ALTER COLUMN PostedBy SET NOT NULL,
+    ALTER COLUMN content SET NOT NULL,
+    ALTER COLUMN likes SET NOT NULL,
+    ALTER COLUMN dislikes SET NOT NULL,
+    ALTER COLUMN timeCreated SET NOT NULL,
+    ALTER COLUMN images SET NOT NULL,
+    ALTER COLUMN images SET DEFAULT '',
+    ADD CONSTRAINT Posts_content_length CHECK (char_length(content) BETWEEN 1 AND 240),
+    ADD CONSTRAINT Posts_PostedBy_fkey FOREIGN KEY (PostedBy) REFERENCES Users (ID) ON DELETE CASCADE,
+    ADD CONSTRAINT Posts_parentID_fkey FOREIGN KEY (parentID) REFERENCES Posts (ID) ON DELETE CASCADE;
+
+ALTER TABLE Images
+    ALTER COLUMN content SET NOT NULL,
+    ALTER COLUMN mimetype SET NOT NULL,
+    ALTER COLUMN width SET NOT NULL,
+    ALTER COLUMN height SET NOT NULL,
+    ADD CONSTRAINT Images_mimetype_image CHECK (mimetype LIKE 'image/%'),
+    ADD CONSTRAINT Images_size_positive CHECK (width >= 0 AND height >= 0);
+
+CREATE INDEX Posts_PostedBy ON Posts (PostedBy);
+CREATE INDEX Posts_parentID ON Posts (parentID);
+CREATE INDEX Posts_timeCreated ON Posts (timeCreated);
+CREATE INDEX Users_auth ON Users (auth);
+CREATE INDEX Users_timeCreated ON Users (timeCreated);
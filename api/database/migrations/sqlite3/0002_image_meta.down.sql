@@ -0,0 +1,5 @@
+ALTER TABLE Images DROP COLUMN etag;
+ALTER TABLE Images DROP COLUMN color;
+ALTER TABLE Images DROP COLUMN blurHash;
+ALTER TABLE Images DROP COLUMN height;
+ALTER TABLE Images DROP COLUMN width;
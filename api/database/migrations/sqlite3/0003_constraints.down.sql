@@ -0,0 +1,65 @@
+-- Rebuilds the tables without constraints, top-level posts have a parentID of -1 again
+
+CREATE TABLE Users_old (
+    ID INTEGER PRIMARY KEY AUTOINCREMENT,
+    username TEXT,
+    password BLOB,
+    handle TEXT UNIQUE,
+    email TEXT NULL,
+    bio TEXT DEFAULT '',
+
+    auth TEXT NOT NULL,
+    timeCreated DATETIME,
+
+    Followers NUMBER DEFAULT 0,
+    whoFollowed TEXT DEFAULT '',
+
+    posts INTEGER DEFAULT 0,
+
+    profile TEXT DEFAULT '',
+    banner TEXT DEFAULT ''
+);
+
+INSERT INTO Users_old SELECT * FROM Users;
+
+CREATE TABLE Posts_old (
+    ID INTEGER PRIMARY KEY AUTOINCREMENT,
+    PostedBy INTEGER,
+    content TEXT,
+
+    likes INTEGER DEFAULT 0,
+    whoLiked TEXT NOT NULL DEFAULT '',
+
+    dislikes INTEGER DEFAULT 0,
+    whoDisliked TEXT NOT NULL DEFAULT '',
+
+    timeCreated DATETIME,
+    parentID INTEGER,
+    images TEXT
+);
+
+INSERT INTO Posts_old
+SELECT ID, PostedBy, content, likes, whoLiked, dislikes, whoDisliked, timeCreated, COALESCE(parentID, -1), images
+FROM Posts;
+
+CREATE TABLE Images_old (
+    URL TEXT PRIMARY KEY,
+    content BLOB,
+    mimetype TEXT,
+
+    width INTEGER DEFAULT 0,
+    height INTEGER DEFAULT 0,
+    blurHash TEXT NOT NULL DEFAULT '',
+    color TEXT NOT NULL DEFAULT '',
+    etag TEXT NOT NULL DEFAULT ''
+);
+
+INSERT INTO Images_old SELECT * FROM Images;
+
+DROP TABLE Images;
+DROP TABLE Posts;
+DROP TABLE Users;
+
+ALTER TABLE Users_old RENAME TO Users;
+ALTER TABLE Posts_old RENAME TO Posts;
+ALTER TABLE Images_old RENAME TO Images;
@@ -0,0 +1,86 @@
+-- Top-level posts had a parentID of -1, it's now NULL so comments can reference their parent.
+-- SQLite can't add constraints to a table, so the tables are rebuilt. Rows breaking the constraints are found before
+-- the migration is applied (see checks in migrate.go), nothing is removed.
+-- The new tables are renamed afterwards, which updates the foreign keys referencing them.
+
+CREATE TABLE Users_new (
+    ID INTEGER PRIMARY KEY AUTOINCREMENT,
+    username TEXT NOT NULL,
+    password BLOB NOT NULL,
+    handle TEXT NOT NULL UNIQUE CHECK (length(handle) BETWEEN 1 AND 24),
+    email TEXT NULL,
+    bio TEXT NOT NULL DEFAULT '',
+
+    auth TEXT NOT NULL,
+    timeCreated DATETIME NOT NULL,
+
+    Followers INTEGER NOT NULL DEFAULT 0,
+    whoFollowed TEXT NOT NULL DEFAULT '',
+
+    posts INTEGER NOT NULL DEFAULT 0,
+
+    profile TEXT NOT NULL DEFAULT '',
+    banner TEXT NOT NULL DEFAULT ''
+);
+
+INSERT INTO Users_new
+SELECT ID, COALESCE(username, ''), COALESCE(password, X''), handle, email, COALESCE(bio, ''),
+    auth, COALESCE(timeCreated, CURRENT_TIMESTAMP),
+    COALESCE(Followers, 0), COALESCE(whoFollowed, ''), COALESCE(posts, 0),
+    COALESCE(profile, ''), COALESCE(banner, '')
+FROM Users;
+
+CREATE TABLE Posts_new (
+    ID INTEGER PRIMARY KEY AUTOINCREMENT,
+    PostedBy INTEGER NOT NULL REFERENCES Users_new (ID) ON DELETE CASCADE,
+    content TEXT NOT NULL CHECK (length(content) BETWEEN 1 AND 240),
+
+    likes INTEGER NOT NULL DEFAULT 0,
+    whoLiked TEXT NOT NULL DEFAULT '',
+
+    dislikes INTEGER NOT NULL DEFAULT 0,
+    whoDisliked TEXT NOT NULL DEFAULT '',
+
+    timeCreated DATETIME NOT NULL,
+    parentID INTEGER NULL REFERENCES Posts_new (ID) ON DELETE CASCADE, -- NULL for posts
+    images TEXT NOT NULL DEFAULT ''
+);
+
+-- Foreign keys are checked when the migration commits, so posts can be inserted in any order
+PRAGMA defer_foreign_keys = ON;
+
+INSERT INTO Posts_new
+SELECT ID, PostedBy, content, COALESCE(likes, 0), whoLiked, COALESCE(dislikes, 0), whoDisliked,
+    COALESCE(timeCreated, CURRENT_TIMESTAMP), NULLIF(parentID, -1), COALESCE(images, '')
+FROM Posts;
+
+DROP TABLE Posts;
+DROP TABLE Users;
+
+ALTER TABLE Users_new RENAME TO Users;
+ALTER TABLE Posts_new RENAME TO Posts;
+
+CREATE TABLE Images_new (
+    URL TEXT PRIMARY KEY,
+    content BLOB NOT NULL,
+    mimetype TEXT NOT NULL CHECK (mimetype LIKE 'image/%'),
+
+    width INTEGER NOT NULL DEFAULT 0 CHECK (width >= 0),
+    height INTEGER NOT NULL DEFAULT 0 CHECK (height >= 0),
+    blurHash TEXT NOT NULL DEFAULT '',
+    color TEXT NOT NULL DEFAULT '',
+    etag TEXT NOT NULL DEFAULT ''
+);
+
+INSERT INTO Images_new
+SELECT URL, content, mimetype, COALESCE(width, 0), COALESCE(height, 0), blurHash, color, etag
+FROM Images;
+
+DROP TABLE Images;
+ALTER TABLE Images_new RENAME TO Images;
+
+CREATE INDEX Posts_PostedBy ON Posts (PostedBy);
+CREATE INDEX Posts_parentID ON Posts (parentID);
+CREATE INDEX Posts_timeCreated ON Posts (timeCreated);
+CREATE INDEX Users_auth ON Users (auth);
+CREATE INDEX Users_timeCreated ON Users (timeCreated);
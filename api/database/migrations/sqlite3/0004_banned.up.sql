@@ -0,0 +1,2 @@
+-- Banned users can't log in or use their authorisation token
+ALTER TABLE Users ADD COLUMN banned BOOLEAN NOT NULL DEFAULT FALSE;
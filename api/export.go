@@ -0,0 +1,170 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/Blockitifluy/CoffeeCo/utility"
+)
+
+// ExportVersion is the version of the export format, increased when it changes
+const ExportVersion = 1
+
+// exportPage is the amount of items read from a store at a time
+const exportPage = 100
+
+// Export contains everything in the stores, used to move an instance (e.g. from SQLite to Postgres)
+type Export struct {
+	Version int           `json:"version"`
+	Users   []ExportUser  `json:"users"`
+	Posts   []PostDB      `json:"posts"` // In order of ID, so parents are before their comments
+	Images  []ExportImage `json:"images"`
+}
+
+// ExportUser is a [User] with it's hashed password
+type ExportUser struct {
+	User
+
+	Password []byte `json:"password"` // hashed password
+}
+
+// ExportImage is an uploaded image with it's placeholder
+type ExportImage struct {
+	ImageMeta
+
+	Content     []byte `json:"content"`
+	ContentType string `json:"mimetype"`
+}
+
+// listAll reads every item of a store, a page at a time
+func listAll[t any](list func(from, amount int) ([]t, error)) ([]t, error) {
+	var items []t
+	for from := 0; ; from += exportPage {
+		page, err := list(from, exportPage)
+		if err != nil {
+			return nil, err
+		}
+
+		items = append(items, page...)
+		if len(page) < exportPage {
+			return items, nil
+		}
+	}
+}
+
+// ExportData writes everything in the stores to w as JSON
+func ExportData(stores Stores, w io.Writer) (Export, error) {
+	data := Export{Version: ExportVersion}
+
+	Users, err := listAll(stores.Users.List)
+	if err != nil {
+		return data, fmt.Errorf("couldn't export users: %w", err)
+	}
+
+	for _, u := range Users {
+		data.Users = append(data.Users, ExportUser{User: u, Password: u.password})
+	}
+
+	if data.Posts, err = listAll(stores.Posts.List); err != nil {
+		return data, fmt.Errorf("couldn't export posts: %w", err)
+	}
+
+	Images, err := listAll(stores.Images.List)
+	if err != nil {
+		return data, fmt.Errorf("couldn't export images: %w", err)
+	}
+
+	for _, image := range Images {
+		metas, err := stores.Images.Meta([]string{image.URL})
+		if err != nil {
+			return data, fmt.Errorf("couldn't export images: %w", err)
+		}
+
+		meta := metas[image.URL]
+		meta.URL = image.URL
+
+		data.Images = append(data.Images, ExportImage{
+			ImageMeta:   meta,
+			Content:     image.Content,
+			ContentType: image.ContentType,
+		})
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "\t")
+
+	return data, encoder.Encode(data)
+}
+
+// isEmpty checks the stores don't have any users, posts or images
+func isEmpty(stores Stores) (bool, error) {
+	Users, err := stores.Users.List(0, 1)
+	if err != nil {
+		return false, err
+	}
+
+	Posts, err := stores.Posts.List(0, 1)
+	if err != nil {
+		return false, err
+	}
+
+	Images, err := stores.Images.List(0, 1)
+	if err != nil {
+		return false, err
+	}
+
+	return len(Users)+len(Posts)+len(Images) == 0, nil
+}
+
+// ImportData reads an export (see [ExportData]) from r into the stores, which must be empty.
+// IDs are kept, so links to users and posts still work
+func ImportData(stores Stores, r io.Reader) (Export, error) {
+	var data Export
+	if err := json.NewDecoder(r).Decode(&data); err != nil {
+		return data, fmt.Errorf("couldn't read the export: %w", err)
+	}
+
+	if data.Version != ExportVersion {
+		return data, fmt.Errorf("export version %d isn't supported (expected %d)", data.Version, ExportVersion)
+	}
+
+	empty, err := isEmpty(stores)
+	if err != nil {
+		return data, err
+	} else if !empty {
+		return data, errors.New("the database isn't empty, import into a new database")
+	}
+
+	for _, u := range data.Users {
+		if u.PublicUser == nil {
+			return data, errors.New("a user has no public information")
+		}
+
+		u.password = u.Password
+		if err := stores.Users.Import(u.User); err != nil {
+			return data, fmt.Errorf("couldn't import user %d: %w", u.ID, err)
+		}
+	}
+
+	for _, pst := range data.Posts {
+		if err := stores.Posts.Import(pst); err != nil {
+			return data, fmt.Errorf("couldn't import post %d: %w", pst.ID, err)
+		}
+	}
+
+	for _, image := range data.Images {
+		content, err := utility.GUnzipBytes(image.Content)
+		if err != nil {
+			return data, fmt.Errorf("couldn't import image %s: %w", image.URL, err)
+		}
+
+		Image := ImageData{URL: image.URL, Content: image.Content, ContentType: image.ContentType, ETag: utility.GenerateETag(content)}
+		if err := stores.Images.Add(Image, image.ImageMeta); err != nil {
+			return data, fmt.Errorf("couldn't import image %s: %w", image.URL, err)
+		}
+	}
+
+	return data, nil
+}
@@ -0,0 +1,170 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/pprof"
+	"runtime/debug"
+	"time"
+
+	"github.com/Blockitifluy/CoffeeCo/api/database"
+)
+
+// readyTimeout is the longest the database has to respond to a readiness check
+const readyTimeout = 2 * time.Second
+
+// HealthCheck is a check of `/readyz`
+type HealthCheck struct {
+	Name  string `json:"name"`
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+// writeJSON writes v as JSON with a status code, the response isn't cached
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+// APIHealth is an api call. Doesn't work as expected when called outside an API context
+//
+// Responds while the process is alive (for supervisors), see [Server.APIReady] for if requests can be handled
+func (srv *Server) APIHealth(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// ReadinessChecks checks the server can handle requests: it isn't shutting down,
+// the database is reachable and migrated, and the frontend is loaded
+func (srv *Server) ReadinessChecks(ctx context.Context) []HealthCheck {
+	check := func(name string, err error) HealthCheck {
+		if err != nil {
+			return HealthCheck{Name: name, Error: err.Error()}
+		}
+		return HealthCheck{Name: name, OK: true}
+	}
+
+	var stopping error
+	if srv.stopping.Load() {
+		stopping = fmt.Errorf("the server is shutting down")
+	}
+	checks := []HealthCheck{check("running", stopping)}
+
+	if srv.db != nil { // Other stores (e.g. in-memory) are always ready
+		ctx, cancel := context.WithTimeout(ctx, readyTimeout)
+		defer cancel()
+
+		pingErr := srv.db.PingContext(ctx)
+		checks = append(checks, check("database", pingErr))
+
+		if pingErr == nil {
+			checks = append(checks, check("migrations", srv.checkMigrations()))
+		}
+	}
+
+	var assetsErr error
+	if srv.html == nil || srv.assets == nil {
+		assetsErr = fmt.Errorf("the frontend isn't loaded")
+	}
+	checks = append(checks, check("assets", assetsErr))
+
+	return checks
+}
+
+// checkMigrations checks every migration has been applied
+func (srv *Server) checkMigrations() error {
+	version, err := database.Version(srv.db)
+	if err != nil {
+		return err
+	}
+
+	latest, err := database.Latest(srv.db.Dialect)
+	if err != nil {
+		return err
+	}
+
+	if version != latest {
+		return fmt.Errorf("the database is at version %d, not %d (run `coffeeco migrate`)", version, latest)
+	}
+
+	return nil
+}
+
+// APIReady is an api call. Doesn't work as expected when called outside an API context
+//
+// Responds with `200` when the server can handle requests (for load balancers), otherwise `503`.
+// See [Server.ReadinessChecks]
+func (srv *Server) APIReady(w http.ResponseWriter, r *http.Request) {
+	checks := srv.ReadinessChecks(r.Context())
+
+	status, code := "ready", http.StatusOK
+	for _, check := range checks {
+		if !check.OK {
+			status, code = "not ready", http.StatusServiceUnavailable
+			break
+		}
+	}
+
+	writeJSON(w, code, map[string]any{"status": status, "checks": checks})
+}
+
+// BuildInfo is how the executable was built
+type BuildInfo struct {
+	Version   string `json:"version"`            // The module's version, (devel) when built from source
+	Revision  string `json:"revision,omitempty"` // The commit
+	Time      string `json:"time,omitempty"`     // When the commit was made
+	Modified  bool   `json:"modified"`           // If there were uncommitted changes
+	GoVersion string `json:"goVersion"`
+	Tags      string `json:"tags,omitempty"` // e.g.: embed
+}
+
+// ReadBuildInfo reads the build info embedded in the executable (see [runtime/debug.ReadBuildInfo])
+func ReadBuildInfo() BuildInfo {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return BuildInfo{Version: "unknown"}
+	}
+
+	build := BuildInfo{Version: info.Main.Version, GoVersion: info.GoVersion}
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			build.Revision = setting.Value
+		case "vcs.time":
+			build.Time = setting.Value
+		case "vcs.modified":
+			build.Modified = setting.Value == "true"
+		case "-tags":
+			build.Tags = setting.Value
+		}
+	}
+
+	return build
+}
+
+// APIDebugInfo is an api call. Doesn't work as expected when called outside an API context
+//
+// Sends the build info and the config (with secrets redacted)
+func (srv *Server) APIDebugInfo(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{
+		"build":  ReadBuildInfo(),
+		"config": srv.Config.Redacted(),
+	})
+}
+
+// debugHandler serves `/debug/pprof/` (see [net/http/pprof]) and `/debug/info`,
+// on the admin listener or with `DEBUG` and `METRICS_TOKEN` set. `METRICS_TOKEN` is required when it's set
+func (srv *Server) debugHandler() http.Handler {
+	router := http.NewServeMux()
+	router.HandleFunc("/debug/pprof/", pprof.Index) // Also serves the profiles, e.g. /debug/pprof/heap
+	router.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	router.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	router.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	router.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	router.HandleFunc("/debug/info", srv.APIDebugInfo)
+
+	return srv.requireToken(router)
+}
@@ -0,0 +1,75 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHealthAndReady(t *testing.T) {
+	srv, handler := newTestServer(t, testConfig())
+
+	if w := request(t, handler, "GET", "/healthz", nil); w.Code != http.StatusOK {
+		t.Fatalf("/healthz is %d, expected 200", w.Code)
+	}
+
+	// `/readyz` isn't wrapped in `{"data": ...}`
+	w := request(t, handler, "GET", "/readyz", nil)
+	var ready struct {
+		Status string        `json:"status"`
+		Checks []HealthCheck `json:"checks"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &ready); err != nil || w.Code != http.StatusOK || ready.Status != "ready" {
+		t.Fatalf("/readyz is %d %s, expected ready (%v)", w.Code, w.Body.String(), err)
+	}
+
+	srv.stopping.Store(true)
+	if w := request(t, handler, "GET", "/readyz", nil); w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("/readyz is %d while shutting down, expected 503", w.Code)
+	}
+}
+
+func TestDebugEndpoints(t *testing.T) {
+	tests := []struct {
+		name         string
+		token, admin string
+		publicStatus int
+	}{
+		// --debug without a token or an admin address doesn't make the profiler public
+		{"no token", "", "", http.StatusNotFound},
+		{"token", "secret", "", http.StatusUnauthorized},
+		{"admin address", "", "127.0.0.1:0", http.StatusNotFound},
+	}
+
+	for _, test := range tests {
+		cfg := testConfig()
+		cfg.Debug = true
+		cfg.Admin.MetricsToken = test.token
+		cfg.Admin.Address = test.admin
+		srv, handler := newTestServer(t, cfg)
+
+		for _, path := range []string{"/debug/info", "/debug/pprof/"} {
+			if w := request(t, handler, "GET", path, nil); w.Code != test.publicStatus {
+				t.Errorf("%s: public %s is %d, expected %d", test.name, path, w.Code, test.publicStatus)
+			}
+		}
+
+		if test.token != "" {
+			r := httptest.NewRequest("GET", "/debug/info", nil)
+			r.Header.Set("Authorization", "Bearer "+test.token)
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			if w.Code != http.StatusOK {
+				t.Errorf("%s: /debug/info with the token is %d, expected 200", test.name, w.Code)
+			}
+		}
+
+		if test.admin != "" {
+			if w := request(t, srv.adminServer().Handler, "GET", "/debug/info", nil); w.Code != http.StatusOK {
+				t.Errorf("%s: admin /debug/info is %d, expected 200", test.name, w.Code)
+			}
+		}
+	}
+}
@@ -1,13 +1,16 @@
 package api
 
 import (
-	"fmt"
+	"bytes"
 	"io"
+	"log/slog"
 	"net/http"
 	"net/url"
+	"regexp"
+	"strings"
+	"time"
 
 	"github.com/Blockitifluy/CoffeeCo/utility"
-	"github.com/blockloop/scan"
 	"github.com/google/uuid"
 	"github.com/gorilla/mux"
 )
@@ -17,18 +20,139 @@ type ImageData struct {
 	URL         string `db:"URL"`
 	Content     []byte `db:"content"`
 	ContentType string `db:"mimetype"`
+	ETag        string `db:"etag"` // Stored when uploaded, empty for images uploaded before
+}
+
+// ImageMeta contains the placeholder information of an uploaded image,
+// so clients can reserve layout and show a preview before the image loads
+type ImageMeta struct {
+	URL      string `json:"url" db:"URL"`
+	Width    int    `json:"width" db:"width"`
+	Height   int    `json:"height" db:"height"`
+	BlurHash string `json:"blurHash" db:"blurHash"`
+	Color    string `json:"color" db:"color"` // The dominant colour (hex)
+}
+
+// downloadPath is the route prefix of uploaded images
+const downloadPath = "/api/images/download/"
+
+// validPostImage matches a single image of a post's images string, e.g.: src (alt)
+var validPostImage = regexp.MustCompile(`^(.+) \((.*?)\)$`)
+
+// imageIDFromURL gets the ID of an uploaded image from it's url.
+// Returns false if the url isn't an uploaded image
+func imageIDFromURL(src string) (string, bool) {
+	index := strings.Index(src, downloadPath)
+	if index == -1 {
+		return "", false
+	}
+
+	ID, err := url.PathUnescape(src[index+len(downloadPath):])
+	if err != nil || ID == "" {
+		return "", false
+	}
+
+	return ID, true
+}
+
+// postImageIDs gets the IDs of the uploaded images from a post's images string
+func postImageIDs(images string) []string {
+	var IDs []string
+	for _, item := range strings.Split(images, ",") {
+		match := validPostImage.FindStringSubmatch(strings.TrimSpace(item))
+		if match == nil {
+			continue
+		}
+
+		if ID, ok := imageIDFromURL(match[1]); ok {
+			IDs = append(IDs, ID)
+		}
+	}
+
+	return IDs
+}
+
+// imageMetaError is sent when the ImageMeta of posts or users can't be found
+func imageMetaError(err error) *utility.HTTPError {
+	return &utility.HTTPError{
+		Public:  utility.PublicServerError,
+		Message: err.Error(),
+		Status:  500,
+	}
+}
+
+// attachPostImageMeta adds the ImageMeta of every uploaded image to the posts
+func (srv *Server) attachPostImageMeta(Posts []PostDB) *utility.HTTPError {
+	var IDs []string
+	for _, pst := range Posts {
+		IDs = append(IDs, postImageIDs(pst.Images)...)
+	}
+
+	metas, err := srv.Images.Meta(IDs)
+	if err != nil {
+		return imageMetaError(err)
+	}
+
+	for i := range Posts {
+		Posts[i].ImageMeta = []ImageMeta{}
+		for _, ID := range postImageIDs(Posts[i].Images) {
+			if meta, ok := metas[ID]; ok {
+				Posts[i].ImageMeta = append(Posts[i].ImageMeta, meta)
+			}
+		}
+	}
+
+	return nil
+}
+
+// attachUserImageMeta adds the ImageMeta of the profile and banner to the users,
+// if they are uploaded images
+func (srv *Server) attachUserImageMeta(Users []PublicUser) *utility.HTTPError {
+	var IDs []string
+	for _, u := range Users {
+		for _, src := range []string{u.Profile, u.Banner} {
+			if ID, ok := imageIDFromURL(src); ok {
+				IDs = append(IDs, ID)
+			}
+		}
+	}
+
+	metas, err := srv.Images.Meta(IDs)
+	if err != nil {
+		return imageMetaError(err)
+	}
+
+	find := func(src string) *ImageMeta {
+		ID, ok := imageIDFromURL(src)
+		if !ok {
+			return nil
+		}
+
+		if meta, ok := metas[ID]; ok {
+			return &meta
+		}
+		return nil
+	}
+
+	for i := range Users {
+		Users[i].ProfileMeta = find(Users[i].Profile)
+		Users[i].BannerMeta = find(Users[i].Banner)
+	}
+
+	return nil
 }
 
 // APIUploadImage is an api call. Doesn't work as expected when called outside an API context
 //
-// Uploads an image (png, jpeg and gif) with a limited size, compresses it and add to database
+// Uploads an image (png, jpeg and gif) with a limited size, compresses it and add to database.
+// The dimensions, BlurHash and dominant colour are also stored (see [ImageMeta]), the image's url is sent
 func (srv *Server) APIUploadImage(w http.ResponseWriter, r *http.Request) {
 	mimetype := r.Header.Get("Content-Type")
 	if Accepted := utility.CanImageBeAccepted(r, mimetype); !Accepted.Ok {
 		utility.Error(w, utility.HTTPError{
 			Public:  Accepted.Msg,
 			Message: Accepted.Msg,
-			Code:    Accepted.Code,
+			Status:  Accepted.Code,
 		})
 		return
 	}
@@ -38,17 +162,31 @@ func (srv *Server) APIUploadImage(w http.ResponseWriter, r *http.Request) {
 		utility.Error(w, utility.HTTPError{
 			Public:  "Couldn't Read Image",
 			Message: err.Error(),
-			Code:    500,
+			Status:  500,
 		})
 		return
 	}
 
+	srv.metrics.uploadSize.Observe(float64(len(img)))
+
+	start := time.Now()
 	compress, compErr := utility.AutoCompress(mimetype, img)
+	srv.metrics.imageCompression.WithLabelValues(mimetype).Observe(time.Since(start).Seconds())
 	if compErr != nil {
 		utility.Error(w, utility.HTTPError{
 			Public:  "Couldn't Compress Image",
 			Message: compErr.Error(),
-			Code:    500,
+			Status:  500,
+		})
+		return
+	}
+
+	info, err := utility.GetImageInfo(compress)
+	if err != nil {
+		utility.Error(w, utility.HTTPError{
+			Public:  "Couldn't Read Image",
+			Message: err.Error(),
+			Status:  500,
 		})
 		return
 	}
@@ -59,28 +197,41 @@ func (srv *Server) APIUploadImage(w http.ResponseWriter, r *http.Request) {
 		utility.Error(w, utility.HTTPError{
 			Public:  "Couldn't Zip Image",
 			Message: err.Error(),
-			Code:    500,
+			Status:  500,
 		})
 		return
 	}
 
-	_, resultErr := srv.Exec("INSERT INTO Images (url, content, mimetype) VALUES (?, ?, ?)", ID.String(), zipped, mimetype)
+	Image := ImageData{
+		URL:         ID.String(),
+		Content:     zipped,
+		ContentType: mimetype,
+		ETag:        utility.GenerateETag(compress),
+	}
+
+	resultErr := srv.Images.Add(Image, ImageMeta{
+		Width:    info.Width,
+		Height:   info.Height,
+		BlurHash: info.BlurHash,
+		Color:    info.Color,
+	})
 	if resultErr != nil {
 		utility.Error(w, utility.HTTPError{
 			Public:  "Couldn't Add image to Server",
 			Message: resultErr.Error(),
-			Code:    500,
+			Status:  500,
 		})
 		return
 	}
 
-	w.Header().Set("Content-Type", "text/plain")
-	w.Write([]byte(ID.String()))
+	utility.Send(w, http.StatusCreated, map[string]string{"url": ID.String()})
 }
 
 // APIDownloadImage is an api call. Doesn't work as expected when called outside an API context
 //
-// Retrieves an image from the batabase, compress for network
+// Retrieves an image from the batabase. Supports conditional (`If-None-Match`) and
+// partial (`Range`) requests, and is cached forever because an image's content never changes.
+// Conditional requests are answered with the stored ETag, without reading the image
 func (srv *Server) APIDownloadImage(w http.ResponseWriter, r *http.Request) {
 	URLParams := mux.Vars(r)
 	imageURL, err := url.QueryUnescape(URLParams["url"])
@@ -88,29 +239,54 @@ func (srv *Server) APIDownloadImage(w http.ResponseWriter, r *http.Request) {
 		utility.Error(w, utility.HTTPError{
 			Public:  "Couldn't Write Image",
 			Message: err.Error(),
-			Code:    400,
+			Status:  400,
 		})
 		return
 	}
 
-	rows, err := srv.Query("SELECT content, mimetype FROM Images WHERE url = ?", imageURL)
+	eTag, err := srv.Images.ETag(imageURL)
+	if err != nil {
+		utility.SendScanErr(w, err, nil)
+		return
+	}
+
+	w.Header().Set("Cache-Control", utility.ImmutableCacheControl)
+	if eTag != "" {
+		w.Header().Set("ETag", eTag)
+
+		if match := r.Header.Get("If-None-Match"); match != "" && utility.ETagMatches(match, eTag) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+
+	Image, err := srv.Images.Get(imageURL)
+	if err != nil {
+		utility.SendScanErr(w, err, nil)
+		return
+	}
+
+	content, err := utility.GUnzipBytes(Image.Content)
 	if err != nil {
 		utility.Error(w, utility.HTTPError{
 			Public:  "Couldn't Get Image",
 			Message: err.Error(),
-			Code:    500,
+			Status:  500,
 		})
 		return
 	}
 
-	var Image ImageData
-	if err := scan.Row(&Image, rows); err != nil {
-		utility.SendScanErr(w, err, nil)
-		return
+	if eTag == "" { // Uploaded before ETags were stored
+		eTag = utility.GenerateETag(content)
+		w.Header().Set("ETag", eTag)
+
+		if err := srv.Images.SetETag(imageURL, eTag); err != nil {
+			slog.Warn("ETag couldn't be stored", "image", imageURL, "error", err)
+		}
 	}
 
-	w.Header().Set("Cache-Control", fmt.Sprintf("max-age=%d", utility.ImageMaxAge))
-	w.Header().Set("Content-Encoding", "gzip")
 	w.Header().Set("Content-Type", Image.ContentType)
-	w.Write(Image.Content) // Faster Speed over network
+
+	// Handles If-None-Match, If-Range, Range and HEAD requests
+	http.ServeContent(w, r, imageURL, time.Time{}, bytes.NewReader(content))
 }
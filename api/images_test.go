@@ -0,0 +1,117 @@
+package api
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Blockitifluy/CoffeeCo/utility"
+)
+
+// testPNG is a small png image
+func testPNG(t *testing.T) []byte {
+	t.Helper()
+
+	img := image.NewRGBA(image.Rect(0, 0, 16, 8))
+	for x := 0; x < 16; x++ {
+		for y := 0; y < 8; y++ {
+			img.Set(x, y, color.RGBA{R: uint8(x * 16), G: uint8(y * 32), B: 128, A: 255})
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+// upload sends an image to `/api/images/upload`
+func upload(handler http.Handler, contentType string, img []byte) *httptest.ResponseRecorder {
+	r := httptest.NewRequest("POST", "/api/images/upload", bytes.NewReader(img))
+	r.Header.Set("Content-Type", contentType)
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	return w
+}
+
+func TestUploadAndDownloadImage(t *testing.T) {
+	srv, handler := newTestServer(t, testConfig())
+
+	uploaded := decodeData[map[string]string](t, upload(handler, "image/png", testPNG(t)), http.StatusCreated)
+	target := "/api/images/download/" + uploaded["url"]
+
+	w := request(t, handler, "GET", target, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status is %d: %s", w.Code, w.Body.String())
+	}
+
+	eTag := w.Header().Get("ETag")
+	if eTag == "" || w.Header().Get("Content-Type") != "image/png" {
+		t.Fatalf("expected an ETag and image/png, got %v", w.Header())
+	}
+
+	if _, err := png.Decode(bytes.NewReader(w.Body.Bytes())); err != nil {
+		t.Fatalf("downloaded image isn't a png: %v", err)
+	}
+
+	meta, err := srv.Images.Meta([]string{uploaded["url"]})
+	if stored := meta[uploaded["url"]]; err != nil || stored.Width != 2*stored.Height || stored.BlurHash == "" {
+		t.Fatalf("expected the image's placeholder to be stored, got %v (%v)", meta, err)
+	}
+
+	t.Run("not modified", func(t *testing.T) {
+		r := httptest.NewRequest("GET", target, nil)
+		r.Header.Set("If-None-Match", eTag)
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+			t.Fatalf("expected 304 without a body, got %d", w.Code)
+		}
+	})
+
+	t.Run("range", func(t *testing.T) {
+		r := httptest.NewRequest("GET", target, nil)
+		r.Header.Set("Range", "bytes=0-3")
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if w.Code != http.StatusPartialContent || w.Body.String() != "\x89PNG" {
+			t.Fatalf("expected 206 with the first 4 bytes, got %d %q", w.Code, w.Body.String())
+		}
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		expectError(t, request(t, handler, "GET", "/api/images/download/missing", nil), http.StatusNotFound, "not_found")
+	})
+}
+
+func TestUploadImageErrors(t *testing.T) {
+	_, handler := newTestServer(t, testConfig())
+
+	t.Run("unsupported media type", func(t *testing.T) {
+		expectError(t, upload(handler, "text/plain", []byte("text")), http.StatusUnsupportedMediaType, "unsupported_media_type")
+	})
+
+	t.Run("length required", func(t *testing.T) {
+		r := httptest.NewRequest("POST", "/api/images/upload", bytes.NewReader(testPNG(t)))
+		r.Header.Set("Content-Type", "image/png")
+		r.ContentLength = -1 // Sent chunked
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		expectError(t, w, http.StatusLengthRequired, "length_required")
+	})
+
+	t.Run("too large", func(t *testing.T) {
+		large := make([]byte, utility.ImageSizeLimit)
+		expectError(t, upload(handler, "image/png", large), http.StatusRequestEntityTooLarge, "too_large")
+	})
+}
@@ -0,0 +1,150 @@
+package api
+
+import (
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Notifier tells the owner of an account about something that happened to it (e.g. by email).
+// The server logs the notifications by default (see [LogNotifier])
+type Notifier interface {
+	Notify(user User, subject, message string) error
+}
+
+// LogNotifier logs notifications instead of sending them, used when there isn't a way to contact users
+type LogNotifier struct{}
+
+// Notify logs the notification as a warning
+func (LogNotifier) Notify(user User, subject, message string) error {
+	slog.Warn("notification", "user_id", user.ID, "handle", user.Handle, "subject", subject, "message", message)
+	return nil
+}
+
+// loginAttempts is the failed log ins of a handle or IP
+type loginAttempts struct {
+	failures    int
+	lastFailure time.Time
+	lockedUntil time.Time
+}
+
+// loginGuard tracks failed log ins of each handle and IP, locking them out for longer after every failure
+// once they've failed too many times (see [LoginConfig])
+type loginGuard struct {
+	cfg LoginConfig
+
+	mu      sync.Mutex
+	handles map[string]*loginAttempts
+	ips     map[string]*loginAttempts
+	swept   time.Time
+}
+
+func newLoginGuard(cfg LoginConfig) *loginGuard {
+	return &loginGuard{
+		cfg:     cfg,
+		handles: map[string]*loginAttempts{},
+		ips:     map[string]*loginAttempts{},
+		swept:   time.Now(),
+	}
+}
+
+// lockout is how long failures lock out for: the first failure over maxAttempts locks out for `LOGIN_LOCKOUT`,
+// doubling every failure after it (up to `LOGIN_MAX_LOCKOUT`)
+func (g *loginGuard) lockout(failures, maxAttempts int) time.Duration {
+	if maxAttempts <= 0 || failures < maxAttempts {
+		return 0
+	}
+
+	lockout := g.cfg.Lockout
+	for i := maxAttempts; i < failures && lockout < g.cfg.MaxLockout; i++ {
+		lockout *= 2
+	}
+
+	return min(lockout, g.cfg.MaxLockout)
+}
+
+// expired checks if the failures are forgotten, `LOGIN_MAX_LOCKOUT` after the last failure (once unlocked)
+func (g *loginGuard) expired(attempts *loginAttempts, now time.Time) bool {
+	return now.After(attempts.lockedUntil) && now.Sub(attempts.lastFailure) >= g.cfg.MaxLockout
+}
+
+// lockedFor is how long until the handle and IP can log in again, 0 when they can
+func (g *loginGuard) lockedFor(handle, ip string, now time.Time) time.Duration {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	var wait time.Duration
+	for _, attempts := range []*loginAttempts{g.handles[handle], g.ips[ip]} {
+		if attempts != nil {
+			wait = max(wait, attempts.lockedUntil.Sub(now))
+		}
+	}
+
+	return wait
+}
+
+// fail records a failed log in, returning how long the handle is locked out for
+// when this failure locked it out for the first time (so the owner is told once)
+func (g *loginGuard) fail(handle, ip string, now time.Time) (lockedFor time.Duration, firstLock bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if now.Sub(g.swept) >= limitSweepInterval {
+		g.sweep(now)
+	}
+
+	record := func(attempts map[string]*loginAttempts, key string, maxAttempts int) *loginAttempts {
+		attempt, ok := attempts[key]
+		if !ok || g.expired(attempt, now) {
+			attempt = &loginAttempts{}
+			attempts[key] = attempt
+		}
+
+		attempt.failures++
+		attempt.lastFailure = now
+		if lockout := g.lockout(attempt.failures, maxAttempts); lockout > 0 {
+			attempt.lockedUntil = now.Add(lockout)
+		}
+		return attempt
+	}
+
+	record(g.ips, ip, g.cfg.MaxIPAttempts)
+	attempt := record(g.handles, handle, g.cfg.MaxAttempts)
+
+	return attempt.lockedUntil.Sub(now), attempt.failures == g.cfg.MaxAttempts
+}
+
+// succeed forgets the failures of the handle (but not the IP, which could've tried other handles)
+func (g *loginGuard) succeed(handle string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	delete(g.handles, handle)
+}
+
+// sweep removes the forgotten failures, whilst locked
+func (g *loginGuard) sweep(now time.Time) {
+	for _, attempts := range []map[string]*loginAttempts{g.handles, g.ips} {
+		for key, attempt := range attempts {
+			if g.expired(attempt, now) {
+				delete(attempts, key)
+			}
+		}
+	}
+
+	g.swept = now
+}
+
+// notifyLocked tells the owner of the account that it's been locked out, in the background
+// (so the response doesn't take longer for handles that exist)
+func (srv *Server) notifyLocked(user User, lockedFor time.Duration, ip string) {
+	message := fmt.Sprintf("Logging in to @%s failed %d times (the last from %s), so logging in is locked for %s. "+
+		"If this wasn't you, someone may be guessing your password.", user.Handle, srv.Config.Login.MaxAttempts, ip, lockedFor)
+
+	go func() {
+		if err := srv.Notifier.Notify(user, "Your account has been locked", message); err != nil {
+			slog.Error("Couldn't notify user", "user_id", user.ID, "error", err)
+		}
+	}()
+}
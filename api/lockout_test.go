@@ -0,0 +1,51 @@
+package api
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLoginGuard(t *testing.T) {
+	guard := newLoginGuard(LoginConfig{MaxAttempts: 3, MaxIPAttempts: 5, Lockout: time.Minute, MaxLockout: 5 * time.Minute})
+	now := time.Now()
+
+	for i := 1; i < 3; i++ {
+		if lockedFor, _ := guard.fail("coffee", "203.0.113.5", now); lockedFor > 0 {
+			t.Fatalf("failure %d locked out for %s", i, lockedFor)
+		}
+	}
+
+	// The 3rd failure locks out, doubling every failure after (up to the max)
+	lockouts := []time.Duration{time.Minute, 2 * time.Minute, 4 * time.Minute, 5 * time.Minute}
+	for i, want := range lockouts {
+		lockedFor, firstLock := guard.fail("coffee", "198.51.100.1", now)
+		if lockedFor != want || firstLock != (i == 0) {
+			t.Fatalf("failure %d locked out for %s (first %t), expected %s", i+3, lockedFor, firstLock, want)
+		}
+	}
+
+	if wait := guard.lockedFor("coffee", "192.0.2.1", now); wait != 5*time.Minute {
+		t.Fatalf("the handle is locked for %s from another IP, expected 5m", wait)
+	}
+
+	// Logging in forgets the handle's failures, but not the IP's
+	guard.succeed("coffee")
+	for _, handle := range []string{"tea", "milk", "sugar"} {
+		guard.fail(handle, "203.0.113.5", now)
+	}
+	if wait := guard.lockedFor("coffee", "203.0.113.5", now); wait != time.Minute {
+		t.Fatalf("the IP is locked for %s after failing for many handles, expected 1m", wait)
+	}
+	if wait := guard.lockedFor("coffee", "192.0.2.1", now); wait != 0 {
+		t.Fatalf("the handle is locked for %s after logging in", wait)
+	}
+
+	// Failures are forgotten once unlocked and `LOGIN_MAX_LOCKOUT` after the last failure
+	for i := 0; i < 4; i++ {
+		guard.fail("espresso", "192.0.2.1", now)
+	}
+	later := now.Add(5*time.Minute + time.Second)
+	if lockedFor, _ := guard.fail("espresso", "192.0.2.1", later); lockedFor > 0 {
+		t.Fatalf("failing after the failures were forgotten locked out for %s", lockedFor)
+	}
+}
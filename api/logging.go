@@ -0,0 +1,166 @@
+package api
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// RequestIDHeader is the header containing the ID of a request, sent with every response (and error).
+// A valid ID sent by the client (or a proxy) is used instead of generating one
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength is the longest request ID accepted from the client
+const maxRequestIDLength = 128
+
+// NewLogger creates the logger of the config (see [LogConfig]),
+// usually set as the default using [log/slog.SetDefault]
+func NewLogger(cfg LogConfig, w io.Writer) *slog.Logger {
+	options := &slog.HandlerOptions{Level: cfg.Level}
+
+	if cfg.Format == "json" {
+		return slog.New(slog.NewJSONHandler(w, options))
+	}
+
+	return slog.New(slog.NewTextHandler(w, options))
+}
+
+// requestInfo is what's known about a request whilst it's handled, used by the access log
+type requestInfo struct {
+	ID     string
+	Route  string // The route's template, e.g.: /api/post/get-post-from-id/{ID} (empty when no route matched)
+	UserID int    // The authenticated user, -1 when unknown
+}
+
+type requestInfoKey struct{}
+
+// getRequestInfo gets the info of a request, nil when the request isn't from [Server.Handler]
+func getRequestInfo(r *http.Request) *requestInfo {
+	info, _ := r.Context().Value(requestInfoKey{}).(*requestInfo)
+	return info
+}
+
+// setRequestUser records the user making the request (for the access log), after they've been authenticated
+func setRequestUser(r *http.Request, ID int) {
+	if info := getRequestInfo(r); info != nil {
+		info.UserID = ID
+	}
+}
+
+// isValidRequestID checks a request ID sent by the client, so it can't forge log lines
+func isValidRequestID(ID string) bool {
+	if ID == "" || len(ID) > maxRequestIDLength {
+		return false
+	}
+
+	for _, char := range ID {
+		isAlphaNumeric := ('a' <= char && char <= 'z') || ('A' <= char && char <= 'Z') || ('0' <= char && char <= '9')
+		if !isAlphaNumeric && char != '-' && char != '_' && char != '.' && char != ':' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// statusWriter records the status and size of a response
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (sw *statusWriter) WriteHeader(code int) {
+	if sw.status == 0 {
+		sw.status = code
+	}
+	sw.ResponseWriter.WriteHeader(code)
+}
+
+func (sw *statusWriter) Write(b []byte) (int, error) {
+	if sw.status == 0 {
+		sw.status = http.StatusOK
+	}
+
+	n, err := sw.ResponseWriter.Write(b)
+	sw.bytes += n
+	return n, err
+}
+
+// Flush is used when streaming responses
+func (sw *statusWriter) Flush() {
+	http.NewResponseController(sw.ResponseWriter).Flush()
+}
+
+// Unwrap is used by [http.ResponseController]
+func (sw *statusWriter) Unwrap() http.ResponseWriter {
+	return sw.ResponseWriter
+}
+
+// requestMiddleware gives every request an ID (see [RequestIDHeader]), records it's metrics
+// and logs it once it's finished (when `ACCESS_LOG` is set).
+// The logged size is the sent (compressed) size
+func (srv *Server) requestMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		info := &requestInfo{ID: r.Header.Get(RequestIDHeader), UserID: -1}
+		if !isValidRequestID(info.ID) {
+			info.ID = uuid.NewString()
+		}
+
+		w.Header().Set(RequestIDHeader, info.ID)
+		r = r.WithContext(context.WithValue(r.Context(), requestInfoKey{}, info))
+
+		sw := &statusWriter{ResponseWriter: w}
+		next.ServeHTTP(sw, r)
+
+		if sw.status == 0 { // Nothing was written
+			sw.status = http.StatusOK
+		}
+
+		took := time.Since(start)
+		srv.metrics.observeRequest(r.Method, info.Route, sw.status, took)
+
+		if !srv.Config.Log.Access {
+			return
+		}
+
+		level := slog.LevelInfo
+		if sw.status >= 500 {
+			level = slog.LevelError
+		}
+
+		attrs := []slog.Attr{
+			slog.String("request_id", info.ID),
+			slog.String("method", r.Method),
+			slog.String("route", info.Route),
+			slog.String("path", r.URL.Path),
+			slog.Int("status", sw.status),
+			slog.Duration("latency", took),
+			slog.Int("bytes", sw.bytes),
+			slog.String("remote", srv.ClientIP(r)), // See `TRUSTED_PROXIES`
+		}
+		if info.UserID != -1 {
+			attrs = append(attrs, slog.Int("user_id", info.UserID))
+		}
+
+		slog.LogAttrs(r.Context(), level, "request", attrs...)
+	})
+}
+
+// routeMiddleware records the template of the matched route (see [RouteTemplate]), added to the router
+func routeMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if info, route := getRequestInfo(r), mux.CurrentRoute(r); info != nil && route != nil {
+			info.Route, _ = route.GetPathTemplate()
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,346 @@
+package api
+
+import (
+	"bytes"
+	"container/list"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	pageCacheLength      = time.Minute // How long a rendered page is cached for
+	maxCachedPages       = 1024
+	maxDescriptionLength = 200
+	pageCacheControl     = "public, no-cache" // Always revalidated (using the ETag)
+)
+
+// PageMeta contains the meta tags of a page, used by link previews (OpenGraph and Twitter)
+type PageMeta struct {
+	Title       string
+	Description string
+	URL         string // The canonical url, empty when `PUBLIC_URL` isn't set
+	Type        string // The OpenGraph type, e.g.: article, profile
+	Author      string
+	Image       *PageImage // Optional
+}
+
+// PageImage is the image shown in a link preview
+type PageImage struct {
+	URL    string // Absolute
+	Alt    string
+	Width  int // Optional
+	Height int // Optional
+}
+
+// Card is the Twitter card type
+func (meta PageMeta) Card() string {
+	if meta.Image != nil && meta.Type == "article" {
+		return "summary_large_image"
+	}
+	return "summary"
+}
+
+var metaTemplate = template.Must(template.New("meta").Parse(`
+		<title>{{.Title}}</title>
+		<meta name="description" content="{{.Description}}" />
+		{{- with .Author}}
+		<meta name="author" content="{{.}}" />
+		{{- end}}
+		{{- with .URL}}
+		<link rel="canonical" href="{{.}}" />
+		<meta property="og:url" content="{{.}}" />
+		{{- end}}
+		<meta property="og:site_name" content="CoffeeCo" />
+		<meta property="og:type" content="{{.Type}}" />
+		<meta property="og:title" content="{{.Title}}" />
+		<meta property="og:description" content="{{.Description}}" />
+		{{- with .Image}}
+		<meta property="og:image" content="{{.URL}}" />
+		<meta property="og:image:alt" content="{{.Alt}}" />
+		{{- if .Width}}
+		<meta property="og:image:width" content="{{.Width}}" />
+		<meta property="og:image:height" content="{{.Height}}" />
+		{{- end}}
+		<meta name="twitter:image" content="{{.URL}}" />
+		{{- end}}
+		<meta name="twitter:card" content="{{.Card}}" />
+		<meta name="twitter:title" content="{{.Title}}" />
+		<meta name="twitter:description" content="{{.Description}}" />
+	`))
+
+var (
+	titleElement = regexp.MustCompile(`(?is)<title>.*?</title>`)
+	headEnd      = regexp.MustCompile(`(?i)</head>`)
+)
+
+// renderPage adds the meta tags to the html (replacing the title)
+func renderPage(html []byte, meta PageMeta) ([]byte, error) {
+	var tags bytes.Buffer
+	if err := metaTemplate.Execute(&tags, meta); err != nil {
+		return nil, err
+	}
+
+	html = titleElement.ReplaceAll(html, nil)
+
+	loc := headEnd.FindIndex(html)
+	if loc == nil {
+		return nil, fmt.Errorf("html has no </head>")
+	}
+
+	var page bytes.Buffer
+	page.Write(html[:loc[0]])
+	page.Write(tags.Bytes())
+	page.Write(html[loc[0]:])
+
+	return page.Bytes(), nil
+}
+
+// pageInfo is the [fs.FileInfo] of a rendered page, it has no modification time
+// (so the ETag is used instead)
+type pageInfo struct {
+	name string
+	size int64
+}
+
+func (info pageInfo) Name() string       { return info.name }
+func (info pageInfo) Size() int64        { return info.size }
+func (info pageInfo) Mode() fs.FileMode  { return 0o444 }
+func (info pageInfo) ModTime() time.Time { return time.Time{} }
+func (info pageInfo) IsDir() bool        { return false }
+func (info pageInfo) Sys() any           { return nil }
+
+// pageCache is an LRU cache of rendered pages, which last for a short time
+type pageCache struct {
+	mu     sync.Mutex
+	length time.Duration
+	pages  map[string]*list.Element // Elements are *cachedPage
+	order  *list.List               // The most recently used page is at the front
+}
+
+type cachedPage struct {
+	key     string
+	page    AssetCache
+	expires time.Time
+}
+
+// newPageCache creates a pageCache, where pages last for length
+func newPageCache(length time.Duration) *pageCache {
+	return &pageCache{
+		length: length,
+		pages:  map[string]*list.Element{},
+		order:  list.New(),
+	}
+}
+
+// Get gets a page if it hasn't expired, and marks it as recently used
+func (cache *pageCache) Get(key string) (AssetCache, bool) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	elem, ok := cache.pages[key]
+	if !ok {
+		return AssetCache{}, false
+	}
+
+	cached := elem.Value.(*cachedPage)
+	if time.Now().After(cached.expires) {
+		cache.order.Remove(elem)
+		delete(cache.pages, key)
+		return AssetCache{}, false
+	}
+
+	cache.order.MoveToFront(elem)
+	return cached.page, true
+}
+
+// Put adds (or replaces) a page, removing the least recently used page when full
+func (cache *pageCache) Put(key string, page AssetCache) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	if elem, ok := cache.pages[key]; ok {
+		cache.order.Remove(elem)
+	}
+
+	cache.pages[key] = cache.order.PushFront(&cachedPage{
+		key:     key,
+		page:    page,
+		expires: time.Now().Add(cache.length),
+	})
+
+	for len(cache.pages) > maxCachedPages {
+		oldest := cache.order.Back()
+		cache.order.Remove(oldest)
+		delete(cache.pages, oldest.Value.(*cachedPage).key)
+	}
+}
+
+// publicURL is the url the server is hosted at (without a trailing slash), from `PUBLIC_URL`.
+// The request's `Host` isn't used, because it's chosen by the client
+func (srv *Server) publicURL() string {
+	return strings.TrimSuffix(srv.Config.PublicURL, "/")
+}
+
+// absoluteURL makes src absolute, returns an empty string if src can't be linked to
+// (e.g. data urls, or paths when base is empty)
+func absoluteURL(base, src string) string {
+	switch {
+	case strings.HasPrefix(src, "http://"), strings.HasPrefix(src, "https://"):
+		return src
+	case strings.HasPrefix(src, "/") && base != "":
+		return base + src
+	}
+
+	return ""
+}
+
+// shortenDescription shortens text to [maxDescriptionLength] characters
+func shortenDescription(text string) string {
+	text = strings.Join(strings.Fields(text), " ")
+
+	runes := []rune(text)
+	if len(runes) <= maxDescriptionLength {
+		return text
+	}
+
+	return string(runes[:maxDescriptionLength-1]) + "…"
+}
+
+// pageImage creates the PageImage of an image, with the dimensions of uploaded images
+func (srv *Server) pageImage(base, src, alt string) *PageImage {
+	link := absoluteURL(base, src)
+	if link == "" {
+		return nil
+	}
+
+	image := &PageImage{
+		URL: link,
+		Alt: alt,
+	}
+
+	if ID, ok := imageIDFromURL(src); ok {
+		if metas, err := srv.Images.Meta([]string{ID}); err == nil {
+			image.Width, image.Height = metas[ID].Width, metas[ID].Height
+		}
+	}
+
+	return image
+}
+
+// postMeta gets the meta tags of a post
+func (srv *Server) postMeta(base string, ID int) (PageMeta, error) {
+	pst, err := srv.Posts.Get(ID)
+	if err != nil {
+		return PageMeta{}, err
+	}
+
+	author, err := srv.Users.Get(pst.PostedBy)
+	if err != nil {
+		return PageMeta{}, err
+	}
+	handle := author.Handle
+
+	meta := PageMeta{
+		Title:       fmt.Sprintf("CoffeeCo - @%s's Post", handle),
+		Description: shortenDescription(pst.Content),
+		URL:         absoluteURL(base, fmt.Sprintf("/post/%d", ID)),
+		Type:        "article",
+		Author:      "@" + handle,
+	}
+
+	for _, item := range strings.Split(pst.Images, ",") { // The first linkable image
+		match := validPostImage.FindStringSubmatch(strings.TrimSpace(item))
+		if match == nil {
+			continue
+		}
+
+		if meta.Image = srv.pageImage(base, match[1], match[2]); meta.Image != nil {
+			break
+		}
+	}
+
+	return meta, nil
+}
+
+// userMeta gets the meta tags of a user
+func (srv *Server) userMeta(base string, ID int) (PageMeta, error) {
+	u, err := srv.Users.Get(ID)
+	if err != nil {
+		return PageMeta{}, err
+	}
+
+	handle, bio := u.Handle, u.Bio
+	if bio == "" {
+		bio = "No bio"
+	}
+
+	return PageMeta{
+		Title:       fmt.Sprintf("CoffeeCo - @%s", handle),
+		Description: shortenDescription(bio),
+		URL:         absoluteURL(base, fmt.Sprintf("/user/%d", ID)),
+		Type:        "profile",
+		Author:      "@" + handle,
+		Image:       srv.pageImage(base, u.Profile, fmt.Sprintf("@%s's Profile", handle)),
+	}, nil
+}
+
+// sendPage sends `HTML_PATH` with the meta tags of a resource (cached per resource).
+// If the meta tags can't be made, the plain html is sent
+func (srv *Server) sendPage(w http.ResponseWriter, r *http.Request, getMeta func(base string, ID int) (PageMeta, error)) {
+	html := srv.html.Get()
+
+	ID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		srv.SendAssetsFile(w, r, html)
+		return
+	}
+
+	base := srv.publicURL()
+	key := fmt.Sprintf("%s %s", html.ETag, r.URL.Path) // Changes when the html is rebuilt
+
+	if page, ok := srv.pages.Get(key); ok {
+		srv.SendAssetsFile(w, r, page)
+		return
+	}
+
+	meta, err := getMeta(base, ID)
+	if err != nil { // The frontend shows it's own not found page
+		srv.SendAssetsFile(w, r, html)
+		return
+	}
+
+	rendered, err := renderPage(html.File.Content, meta)
+	if err != nil {
+		srv.SendAssetsFile(w, r, html)
+		return
+	}
+
+	info := pageInfo{name: r.URL.Path, size: int64(len(rendered))}
+	page := compressAsset(rendered, html.File.Mime, pageCacheControl, info)
+
+	srv.pages.Put(key, page)
+	srv.SendAssetsFile(w, r, page)
+}
+
+// PostPage is an api call. Doesn't work as expected when called outside an API context
+//
+// Sends the frontend with the post's title, description and image as meta tags, so shared links have a preview
+func (srv *Server) PostPage(w http.ResponseWriter, r *http.Request) {
+	srv.sendPage(w, r, srv.postMeta)
+}
+
+// UserPage is an api call. Doesn't work as expected when called outside an API context
+//
+// Sends the frontend with the user's handle, bio and profile as meta tags, so shared links have a preview
+func (srv *Server) UserPage(w http.ResponseWriter, r *http.Request) {
+	srv.sendPage(w, r, srv.userMeta)
+}
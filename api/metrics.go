@@ -0,0 +1,193 @@
+package api
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Blockitifluy/CoffeeCo/utility"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// serverMetrics are the metrics of a server, served at `/metrics` (see [Server.metricsHandler])
+type serverMetrics struct {
+	registry *prometheus.Registry
+
+	requests         *prometheus.CounterVec   // By method, route and status
+	requestDuration  *prometheus.HistogramVec // By method and route
+	queryDuration    *prometheus.HistogramVec // By operation and table
+	uploadSize       prometheus.Histogram
+	imageCompression *prometheus.HistogramVec // By mimetype
+	compression      *prometheus.HistogramVec // By encoding
+	rateLimited      *prometheus.CounterVec   // By route
+	loginFailures    *prometheus.CounterVec   // By reason
+}
+
+// newServerMetrics registers the metrics of the server, including Go's runtime and process stats
+func newServerMetrics(srv *Server) *serverMetrics {
+	m := &serverMetrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "coffeeco_http_requests_total",
+			Help: "The amount of finished requests",
+		}, []string{"method", "route", "status"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "coffeeco_http_request_duration_seconds",
+			Help:    "How long requests took",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"method", "route"}),
+		queryDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "coffeeco_db_query_duration_seconds",
+			Help:    "How long database queries took",
+			Buckets: prometheus.ExponentialBuckets(0.0001, 4, 8),
+		}, []string{"operation", "table"}),
+		uploadSize: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "coffeeco_image_upload_bytes",
+			Help:    "The size of uploaded images (before they're compressed)",
+			Buckets: prometheus.ExponentialBuckets(16<<10, 4, 7),
+		}),
+		imageCompression: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "coffeeco_image_compression_duration_seconds",
+			Help:    "How long uploaded images took to compress",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"mimetype"}),
+		compression: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "coffeeco_response_compression_duration_seconds",
+			Help:    "How long responses took to compress",
+			Buckets: prometheus.ExponentialBuckets(0.0001, 4, 8),
+		}, []string{"encoding"}),
+		rateLimited: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "coffeeco_rate_limited_total",
+			Help: "The amount of requests rejected by rate limits",
+		}, []string{"route"}),
+		loginFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "coffeeco_login_failures_total",
+			Help: "The amount of failed log ins (invalid_credentials or locked)",
+		}, []string{"reason"}),
+	}
+
+	assetStat := func(stat func(hits, misses uint64, size int64) float64) func() float64 {
+		return func() float64 {
+			if srv.assets == nil {
+				return 0
+			}
+			return stat(srv.assets.Stats())
+		}
+	}
+
+	m.registry.MustRegister(
+		m.requests, m.requestDuration, m.queryDuration, m.uploadSize,
+		m.imageCompression, m.compression, m.rateLimited, m.loginFailures,
+
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Name: "coffeeco_asset_cache_hits_total",
+			Help: "The amount of assets found in the cache",
+		}, assetStat(func(hits, _ uint64, _ int64) float64 { return float64(hits) })),
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Name: "coffeeco_asset_cache_misses_total",
+			Help: "The amount of assets not in the cache (read from the disk)",
+		}, assetStat(func(_, misses uint64, _ int64) float64 { return float64(misses) })),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "coffeeco_asset_cache_hit_ratio",
+			Help: "The ratio of assets found in the cache, since the server started",
+		}, assetStat(func(hits, misses uint64, _ int64) float64 {
+			if hits+misses == 0 {
+				return 0
+			}
+			return float64(hits) / float64(hits+misses)
+		})),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "coffeeco_asset_cache_bytes",
+			Help: "The size of the cached assets",
+		}, assetStat(func(_, _ uint64, size int64) float64 { return float64(size) })),
+
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+
+	return m
+}
+
+// knownMethods are the methods used as a label, so clients can't create a label for every method
+var knownMethods = map[string]bool{
+	http.MethodGet: true, http.MethodHead: true, http.MethodPost: true, http.MethodPut: true,
+	http.MethodPatch: true, http.MethodDelete: true, http.MethodOptions: true,
+}
+
+// observeRequest records a finished request, labelled by it's route's template (not the url)
+func (m *serverMetrics) observeRequest(method, route string, status int, took time.Duration) {
+	if !knownMethods[method] {
+		method = "OTHER"
+	}
+
+	if route == "" {
+		route = "unmatched"
+	}
+
+	m.requests.WithLabelValues(method, route, strconv.Itoa(status)).Inc()
+	m.requestDuration.WithLabelValues(method, route).Observe(took.Seconds())
+}
+
+// observeQuery records a database query, used as [database.DB.Observe]
+func (m *serverMetrics) observeQuery(operation, table string, took time.Duration) {
+	m.queryDuration.WithLabelValues(operation, table).Observe(took.Seconds())
+}
+
+// observeCompression records a compressed response, used by [utility.CompressHandler]
+func (m *serverMetrics) observeCompression(encoding string, took time.Duration) {
+	m.compression.WithLabelValues(encoding).Observe(took.Seconds())
+}
+
+// requireToken requires `METRICS_TOKEN` to be sent as `Authorization: Bearer {token}`, when it's set
+func (srv *Server) requireToken(next http.Handler) http.Handler {
+	token := srv.Config.Admin.MetricsToken
+	expected := []byte("Bearer " + token)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if token != "" && subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), expected) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="coffeeco"`)
+			utility.Error(w, utility.HTTPError{
+				Public:  "Unauthorised",
+				Message: "missing or incorrect metrics token",
+				Status:  401,
+			})
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// metricsHandler serves the metrics in Prometheus' text format, see [Server.requireToken]
+func (srv *Server) metricsHandler() http.Handler {
+	metrics := promhttp.HandlerFor(srv.metrics.registry, promhttp.HandlerOpts{})
+
+	return srv.requireToken(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "no-store")
+		metrics.ServeHTTP(w, r)
+	}))
+}
+
+// adminServer creates the http server of `ADMIN_ADDRESS`, serving `/metrics`, `/debug/`, `/healthz` and `/readyz`
+// away from the public address
+func (srv *Server) adminServer() *http.Server {
+	router := http.NewServeMux()
+	router.Handle("/metrics", srv.metricsHandler())
+	router.Handle("/debug/", srv.debugHandler())
+	router.HandleFunc("/healthz", srv.APIHealth)
+	router.HandleFunc("/readyz", srv.APIReady)
+
+	cfg := srv.Config.HTTP
+	return &http.Server{
+		Addr:              srv.Config.Admin.Address,
+		Handler:           recoverMiddleware(router),
+		ReadTimeout:       cfg.ReadTimeout,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		WriteTimeout:      0, // CPU profiles and traces take longer than requests (`/debug/pprof/profile?seconds=30`)
+		IdleTimeout:       cfg.IdleTimeout,
+		MaxHeaderBytes:    cfg.MaxHeaderBytes,
+	}
+}
@@ -0,0 +1,69 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMetricsToken(t *testing.T) {
+	cfg := testConfig()
+	cfg.Admin.MetricsToken = "secret"
+	_, handler := newTestServer(t, cfg)
+
+	request(t, handler, "GET", "/api/post/get-post-from-id/12345", nil)
+	request(t, handler, "GET", "/not/a/route", nil)
+
+	expectError(t, request(t, handler, "GET", "/metrics", nil), http.StatusUnauthorized, "unauthorised")
+
+	withToken := func(token string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", "/metrics", nil)
+		r.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	expectError(t, withToken("wrong"), http.StatusUnauthorized, "unauthorised")
+
+	w := withToken("secret")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status is %d, expected 200: %s", w.Code, w.Body.String())
+	}
+
+	// Requests are labelled by their route's template, not their url
+	for _, metric := range []string{
+		`coffeeco_http_requests_total{method="GET",route="/api/post/get-post-from-id/{ID}",status="404"} 1`,
+		`coffeeco_http_requests_total{method="GET",route="unmatched",status="404"} 1`,
+		`coffeeco_asset_cache_hit_ratio`,
+		`go_goroutines`,
+	} {
+		if !strings.Contains(w.Body.String(), metric) {
+			t.Errorf("metrics don't have %s", metric)
+		}
+	}
+}
+
+func TestMetricsAdminAddress(t *testing.T) {
+	cfg := testConfig()
+	cfg.Admin.Address = "127.0.0.1:0"
+	srv, handler := newTestServer(t, cfg)
+
+	// Only served on the admin listener
+	if w := request(t, handler, "GET", "/metrics", nil); w.Code != http.StatusNotFound {
+		t.Fatalf("public /metrics is %d, expected 404", w.Code)
+	}
+
+	if w := request(t, srv.adminServer().Handler, "GET", "/metrics", nil); w.Code != http.StatusOK {
+		t.Fatalf("admin /metrics is %d, expected 200: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestMetricsDisabled(t *testing.T) {
+	_, handler := newTestServer(t, testConfig())
+
+	if w := request(t, handler, "GET", "/metrics", nil); w.Code != http.StatusNotFound {
+		t.Fatalf("/metrics is %d without a token or admin address, expected 404", w.Code)
+	}
+}
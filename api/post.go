@@ -11,9 +11,7 @@ import (
 	"time"
 
 	"github.com/Blockitifluy/CoffeeCo/utility"
-	"github.com/blockloop/scan"
 	"github.com/gorilla/mux"
-	_ "github.com/mattn/go-sqlite3" // Used for a driver by database/sql
 )
 
 // AddPostRequest struct should be used for request for adding a new Post in the database
@@ -31,13 +29,18 @@ type PostDB struct {
 	Content     string    `json:"content" db:"content"`
 	TimeCreated time.Time `json:"timeCreated" db:"timeCreated"`
 	ParentID    int       `json:"parentID" db:"parentID"`
-	WhoLiked    string    `json:"whoLiked" db:"whoLiked"`
-	WhoDisliked string    `json:"whoDisliked" db:"whoDisliked"`
+	WhoLiked    string    `json:"whoLiked" db:"whoLiked"`       // The IDs of the users who liked (comma separated)
+	WhoDisliked string    `json:"whoDisliked" db:"whoDisliked"` // The IDs of the users who disliked (comma separated)
 	Likes       int       `json:"likes" db:"likes"`
 	Dislikes    int       `json:"dislikes" db:"dislikes"`
 	Images      string    `json:"images" db:"images"`
+
+	ImageMeta []ImageMeta `json:"imageMeta" db:"-"` // The placeholders of the uploaded images
 }
 
+// maxPostLength is the most bytes a post's content can have
+const maxPostLength = 240
+
 // PostListBody is used by [coffeecoserver/api.server.PostFeedList] and only contains Amount int value.
 type PostListBody struct {
 	Amount int `json:"amount"`
@@ -48,81 +51,98 @@ type postFeed struct {
 	Code int
 }
 
-// getFeed gets a random Post from the DB.
+// getFeed gets a random Post from the DB, from any user when postedBy is 0.
 // This is used by PostFeedList and PostFeed
-func (srv *Server) getFeed(query string) (postFeed, error) {
-	rows, err := srv.Query(query)
-	if err != nil {
-		return postFeed{
-			Post: nil,
-			Code: 500,
-		}, err
-	}
-	defer rows.Close()
-
-	var Posts []PostDB
-	if err := scan.Rows(&Posts, rows); err != nil {
-		if err == sql.ErrNoRows {
-			return postFeed{
-				Post: nil,
-				Code: 400,
-			}, errors.New("No rows found")
-		}
-
-		return postFeed{
-			Post: nil,
-			Code: 500,
-		}, err
-	}
-
-	if len(Posts) == 0 {
+func (srv *Server) getFeed(postedBy int) (postFeed, error) {
+	RandPost, err := srv.Posts.Random(postedBy)
+	if err == sql.ErrNoRows {
 		return postFeed{
 			Post: nil,
 			Code: 500,
 		}, errors.New("Empty Array")
-	}
-
-	if err := rows.Err(); err != nil {
+	} else if err != nil {
 		return postFeed{
 			Post: nil,
 			Code: 500,
 		}, err
 	}
 
-	var RandPost PostDB = utility.GetRandFromSlice(Posts)
 	return postFeed{
 		Post: &RandPost,
 		Code: 200,
 	}, nil
 }
 
-func (srv *Server) isPostAllowed(Post AddPostRequest, r *http.Request) (bool, string) {
-	const maxLength = 240
-	if len(Post.Content) > maxLength {
-		return false, "Post is too long"
-	}
-
-	authToken, err := r.Cookie("AuthToken")
-
+// validatePost checks the post can be added by the logged in user (from the `AuthToken` cookie),
+// returning the error to send if it can't. Invalid fields are sent as details (see [utility.InvalidFields])
+func (srv *Server) validatePost(Post AddPostRequest, r *http.Request) *utility.HTTPError {
+	authToken, err := r.Cookie(authCookieName)
 	if err != nil {
-		return false, "Couldn't read cookie"
+		return &utility.HTTPError{
+			Code:    "not_logged_in",
+			Public:  "Not Logged In",
+			Message: "no auth cookie",
+			Status:  401,
+		}
 	}
 
-	ID, err := srv.AuthToID(authToken.Value)
+	ID, err := srv.Users.IDFromAuth(authToken.Value)
+	if err == sql.ErrNoRows {
+		return &utility.HTTPError{
+			Code:    "not_logged_in",
+			Public:  "Not Logged In",
+			Message: "auth cookie doesn't belong to a user",
+			Status:  401,
+		}
+	} else if err != nil {
+		return &utility.HTTPError{
+			Public:  utility.PublicServerError,
+			Message: err.Error(),
+			Status:  500,
+		}
+	}
+	setRequestUser(r, ID)
 
 	if Post.PostedBy != ID {
-		return false, "Invalid user"
+		return &utility.HTTPError{
+			Code:    "invalid_user",
+			Public:  "Invalid user",
+			Message: "postedBy isn't the logged in user",
+			Status:  403,
+		}
 	}
 
+	var details []utility.FieldError
 	if Post.Content == "" {
-		return false, "No content"
+		details = append(details, utility.FieldError{Field: "content", Code: "no_content", Message: "No content"})
+	} else if len(Post.Content) > maxPostLength {
+		details = append(details, utility.FieldError{
+			Field:   "content",
+			Code:    "post_too_long",
+			Message: fmt.Sprintf("Post is too long (%d limit)", maxPostLength),
+		})
+	}
+
+	if Post.ParentID == 0 {
+		details = append(details, utility.FieldError{Field: "parentID", Code: "no_parent", Message: "ParentID is null"})
+	} else if Post.ParentID != -1 {
+		if _, err := srv.Posts.Get(Post.ParentID); err == sql.ErrNoRows {
+			details = append(details, utility.FieldError{Field: "parentID", Code: "parent_not_found", Message: "Parent post doesn't exist"})
+		} else if err != nil {
+			return &utility.HTTPError{
+				Public:  utility.PublicServerError,
+				Message: err.Error(),
+				Status:  500,
+			}
+		}
 	}
 
-	if Post.ParentID == 0 || Post.PostedBy == 0 {
-		return false, "ParentID or PostBy is null"
+	if len(details) > 0 {
+		sentErr := utility.InvalidFields(details...)
+		return &sentErr
 	}
 
-	return true, "Success"
+	return nil
 }
 
 // APIGetCommentsFromPost is an API call, only use in HTTP contexts
@@ -135,7 +155,7 @@ func (srv *Server) APIGetCommentsFromPost(w http.ResponseWriter, r *http.Request
 		utility.Error(w, utility.HTTPError{
 			Public:  utility.PublicBadRequest,
 			Message: "Couldn't parse ID",
-			Code:    400,
+			Status:  400,
 		})
 		return
 	}
@@ -145,7 +165,7 @@ func (srv *Server) APIGetCommentsFromPost(w http.ResponseWriter, r *http.Request
 		utility.Error(w, utility.HTTPError{
 			Public:  utility.PublicBadRequest,
 			Message: "Couldn't parse from",
-			Code:    400,
+			Status:  400,
 		})
 		return
 	}
@@ -155,64 +175,28 @@ func (srv *Server) APIGetCommentsFromPost(w http.ResponseWriter, r *http.Request
 		utility.Error(w, utility.HTTPError{
 			Public:  utility.PublicBadRequest,
 			Message: "Couldn't range from",
-			Code:    400,
+			Status:  400,
 		})
 		return
 	}
 
-	const Query = `
-	SELECT *
-	FROM Posts
-	WHERE ParentId = ?
-	ORDER BY id
-	LIMIT ? OFFSET ?
-	`
-
-	rows, err := srv.Query(Query, parentID, postRange, from)
+	Posts, err := srv.Posts.Comments(parentID, from, postRange)
 	if err != nil {
-		utility.Error(w, utility.HTTPError{
-			Public:  utility.PublicServerError,
-			Message: err.Error(),
-			Code:    400,
-		})
-		return
-	}
-
-	var Posts []PostDB
-	if err := scan.Rows(&Posts, rows); err != nil {
 		utility.SendScanErr(w, err, nil)
 		return
 	}
 
 	if len(Posts) == 0 {
-		w.Header().Set("Content-Type", "application/json")
-		w.Write([]byte("[]"))
+		utility.Send(w, http.StatusOK, []PostDB{})
 		return
 	}
 
-	json, err := json.Marshal(Posts)
-	if err != nil {
-		utility.Error(w, utility.HTTPError{
-			Public:  utility.PublicServerError,
-			Message: err.Error(),
-			Code:    500,
-		})
+	if sentErr := srv.attachPostImageMeta(Posts); sentErr != nil {
+		utility.Error(w, *sentErr)
 		return
 	}
 
-	zipped, err := utility.GZipBytes(json)
-	if err != nil {
-		utility.Error(w, utility.HTTPError{
-			Public:  utility.PublicServerError,
-			Message: err.Error(),
-			Code:    500,
-		})
-		return
-	}
-
-	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("Content-Encoding", "gzip")
-	w.Write(zipped)
+	utility.Send(w, http.StatusOK, Posts)
 }
 
 // APIGetPostFromID is an API call, only use in HTTP contexts
@@ -225,40 +209,25 @@ func (srv *Server) APIGetPostFromID(w http.ResponseWriter, r *http.Request) {
 		utility.Error(w, utility.HTTPError{
 			Public:  utility.PublicBadRequest,
 			Message: err.Error(),
-			Code:    400,
+			Status:  400,
 		})
 		return
 	}
 
-	query, err := srv.Query("SELECT * FROM Posts WHERE id = ?", ID)
+	pst, err := srv.Posts.Get(ID)
 	if err != nil {
-		utility.Error(w, utility.HTTPError{
-			Public:  utility.PublicServerError,
-			Message: err.Error(),
-			Code:    500,
-		})
-		return
-	}
-
-	var pst PostDB
-	if err := scan.Row(&pst, query); err != nil {
 		utility.SendScanErr(w, err, nil)
 		return
 	}
 
-	JSON, err := json.Marshal(pst)
-	if err != nil {
-		utility.Error(w, utility.HTTPError{
-			Public:  utility.PublicServerError,
-			Message: err.Error(),
-			Code:    500,
-		})
+	Posts := []PostDB{pst}
+	if sentErr := srv.attachPostImageMeta(Posts); sentErr != nil {
+		utility.Error(w, *sentErr)
 		return
 	}
 
 	w.Header().Set("Cache-Control", fmt.Sprintf("max-age=%d", utility.HourCache))
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(JSON)
+	utility.Send(w, http.StatusOK, Posts[0])
 }
 
 // APIPostFeedList is an API call do not use outside of http requests
@@ -273,117 +242,90 @@ func (srv *Server) APIPostFeedList(w http.ResponseWriter, r *http.Request) {
 		utility.Error(w, utility.HTTPError{
 			Public:  utility.PublicBadRequest,
 			Message: err.Error(),
-			Code:    400,
+			Status:  400,
 		})
 		return
 	}
 
 	var Posts []PostDB
 	for i := 0; i < amount; i++ {
-		Feed, err := srv.getFeed("SELECT * FROM Posts WHERE ParentId = -1")
+		Feed, err := srv.getFeed(0)
 		if err != nil {
 			utility.Error(w, utility.HTTPError{
 				Public:  utility.PublicServerError,
 				Message: err.Error(),
-				Code:    Feed.Code,
+				Status:  Feed.Code,
 			})
 			return
 		}
 		Posts = append(Posts, *Feed.Post)
 	}
 
-	PostsJSON, err := json.Marshal(Posts)
-	if err != nil {
-		utility.Error(w, utility.HTTPError{
-			Public:  utility.PublicServerError,
-			Message: err.Error(),
-			Code:    500,
-		})
-		return
-	}
-
-	compress, err := utility.GZipBytes(PostsJSON)
-	if err != nil {
-		utility.Error(w, utility.HTTPError{
-			Public:  utility.PublicServerError,
-			Message: "Failed to Encode",
-			Code:    500,
-		})
+	if sentErr := srv.attachPostImageMeta(Posts); sentErr != nil {
+		utility.Error(w, *sentErr)
 		return
 	}
 
-	w.Header().Set("Content-Encoding", "gzip")
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(compress)
+	utility.Send(w, http.StatusOK, Posts)
 }
 
 // APIPostFeed is an API call do not use outside of http requests
 //
 // This is a work in progress will change in the future
 func (srv *Server) APIPostFeed(w http.ResponseWriter, r *http.Request) {
-	Feed, err := srv.getFeed("SELECT * FROM Posts WHERE ParentId = -1")
+	Feed, err := srv.getFeed(0)
 	if err != nil {
 		utility.Error(w, utility.HTTPError{
 			Public:  utility.PublicServerError,
 			Message: err.Error(),
-			Code:    Feed.Code,
+			Status:  Feed.Code,
 		})
 		return
 	}
 
-	PostsJSON, err := json.Marshal(Feed.Post)
-	if err != nil {
-		utility.Error(w, utility.HTTPError{
-			Public:  utility.PublicServerError,
-			Message: err.Error(),
-			Code:    500,
-		})
+	Posts := []PostDB{*Feed.Post}
+	if sentErr := srv.attachPostImageMeta(Posts); sentErr != nil {
+		utility.Error(w, *sentErr)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(PostsJSON)
+	utility.Send(w, http.StatusOK, Posts[0])
 }
 
 // APIAddPost is an API call do not use outside of http requests
 //
-// Adds a post to database. See more at [coffeecoserver/api.AddPostRequest].
+// Adds a post to database, sending it's ID. See more at [coffeecoserver/api.AddPostRequest].
 func (srv *Server) APIAddPost(w http.ResponseWriter, r *http.Request) {
 	var RequestPost AddPostRequest
 	decoder := json.NewDecoder(r.Body)
 	if err := decoder.Decode(&RequestPost); err != nil {
 		utility.Error(w, utility.HTTPError{
+			Code:    "invalid_body",
 			Public:  utility.PublicBadRequest,
 			Message: "Body can't be decoded",
-			Code:    400,
+			Status:  400,
 		})
 		return
 	}
 
-	postAllowed, reason := srv.isPostAllowed(RequestPost, r)
-	if !postAllowed {
-		utility.Error(w, utility.HTTPError{
-			Public:  reason,
-			Message: reason,
-			Code:    400,
-		})
+	if sentErr := srv.validatePost(RequestPost, r); sentErr != nil {
+		utility.Error(w, *sentErr)
 		return
 	}
 
 	// Query Added
 
-	_, err := srv.Exec("INSERT INTO Posts (PostedBy, Content, TimeCreated, ParentId, images) VALUES (?, ?, ?, ?, ?)", RequestPost.PostedBy, RequestPost.Content, time.Now(), RequestPost.ParentID, RequestPost.Images)
-
+	ID, err := srv.Posts.Add(RequestPost)
 	if err != nil {
 		utility.Error(w, utility.HTTPError{
 			Public:  utility.PublicServerError,
 			Message: err.Error(),
-			Code:    500,
+			Status:  500,
 		})
 		return
 	}
 
-	w.Write([]byte("Success"))
+	utility.Send(w, http.StatusCreated, map[string]int{"ID": ID})
 }
 
 // APIGetPostsFromUser is an API call do not use outside of http requests
@@ -396,7 +338,7 @@ func (srv *Server) APIGetPostsFromUser(w http.ResponseWriter, r *http.Request) {
 		utility.Error(w, utility.HTTPError{
 			Public:  utility.PublicBadRequest,
 			Message: err.Error(),
-			Code:    400,
+			Status:  400,
 		})
 		return
 	}
@@ -406,17 +348,14 @@ func (srv *Server) APIGetPostsFromUser(w http.ResponseWriter, r *http.Request) {
 		utility.Error(w, utility.HTTPError{
 			Public:  utility.PublicBadRequest,
 			Message: err.Error(),
-			Code:    400,
+			Status:  400,
 		})
 		return
 	}
 
 	var Posts []PostDB
 	for i := 0; i < amount; i++ {
-		queryStr := fmt.Sprintf("SELECT * FROM Posts WHERE ParentId = -1 AND PostedBy = %d", userID)
-
-		Feed, err := srv.getFeed(queryStr)
-
+		Feed, err := srv.getFeed(userID)
 		if err != nil {
 			utility.SendScanErr(w, err, nil)
 			return
@@ -425,30 +364,13 @@ func (srv *Server) APIGetPostsFromUser(w http.ResponseWriter, r *http.Request) {
 		Posts = append(Posts, *Feed.Post)
 	}
 
-	JSONPosts, err := json.Marshal(Posts)
-	if err != nil {
-		utility.Error(w, utility.HTTPError{
-			Public:  utility.PublicBadRequest,
-			Message: err.Error(),
-			Code:    500,
-		})
-		return
-	}
-
-	compress, err := utility.GZipBytes(JSONPosts)
-	if err != nil {
-		utility.Error(w, utility.HTTPError{
-			Public:  utility.PublicServerError,
-			Message: err.Error(),
-			Code:    500,
-		})
+	if sentErr := srv.attachPostImageMeta(Posts); sentErr != nil {
+		utility.Error(w, *sentErr)
 		return
 	}
 
 	w.Header().Set("Cache-Control", fmt.Sprintf("max-age=%d", utility.HourCache))
-	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("Content-Encoding", "gzip")
-	w.Write(compress)
+	utility.Send(w, http.StatusOK, Posts)
 }
 
 // APIGetUserPostHistory is an API call do not use outside of http requests
@@ -461,7 +383,7 @@ func (srv *Server) APIGetUserPostHistory(w http.ResponseWriter, r *http.Request)
 		utility.Error(w, utility.HTTPError{
 			Public:  utility.PublicBadRequest,
 			Message: "Couldn't parse ID",
-			Code:    400,
+			Status:  400,
 		})
 		return
 	}
@@ -471,7 +393,7 @@ func (srv *Server) APIGetUserPostHistory(w http.ResponseWriter, r *http.Request)
 		utility.Error(w, utility.HTTPError{
 			Public:  utility.PublicBadRequest,
 			Message: "Couldn't parse from",
-			Code:    400,
+			Status:  400,
 		})
 		return
 	}
@@ -481,57 +403,28 @@ func (srv *Server) APIGetUserPostHistory(w http.ResponseWriter, r *http.Request)
 		utility.Error(w, utility.HTTPError{
 			Public:  utility.PublicBadRequest,
 			Message: "Couldn't range from",
-			Code:    400,
+			Status:  400,
 		})
 		return
 	}
 
-	const Query = `
-	SELECT *
-	FROM Posts
-	WHERE ParentId = -1
-	AND PostedBy = ?
-	ORDER BY id DESC
-	LIMIT ? OFFSET ?
-	`
-
-	rows, err := srv.Query(Query, userID, postRange, from)
+	Posts, err := srv.Posts.ByUser(userID, from, postRange)
 	if err != nil {
-		utility.Error(w, utility.HTTPError{
-			Public:  utility.PublicServerError,
-			Message: err.Error(),
-			Code:    400,
-		})
-		return
-	}
-
-	var Posts []PostDB
-	if err := scan.Rows(&Posts, rows); err != nil {
 		utility.SendScanErr(w, err, nil)
 		return
 	}
 
 	if len(Posts) == 0 {
-		w.Header().Set("Content-Type", "application/json")
-		w.Write([]byte("[]"))
+		utility.Send(w, http.StatusOK, []PostDB{})
 		return
 	}
 
-	json, err := json.Marshal(Posts)
-	if err != nil {
-		utility.Error(w, utility.HTTPError{
-			Public:  utility.PublicServerError,
-			Message: err.Error(),
-			Code:    500,
-		})
+	if sentErr := srv.attachPostImageMeta(Posts); sentErr != nil {
+		utility.Error(w, *sentErr)
 		return
 	}
 
-	zipped, err := utility.GZipBytes(json)
-
-	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("Content-Encoding", "gzip")
-	w.Write(zipped)
+	utility.Send(w, http.StatusOK, Posts)
 }
 
 // APISearchPost is an API call do not use outside of http requests
@@ -545,7 +438,7 @@ func (srv *Server) APISearchPost(w http.ResponseWriter, r *http.Request) {
 		utility.Error(w, utility.HTTPError{
 			Public:  utility.PublicBadRequest,
 			Message: err.Error(),
-			Code:    400,
+			Status:  400,
 		})
 		return
 	}
@@ -555,7 +448,7 @@ func (srv *Server) APISearchPost(w http.ResponseWriter, r *http.Request) {
 		utility.Error(w, utility.HTTPError{
 			Public:  utility.PublicBadRequest,
 			Message: "Couldn't parse from",
-			Code:    400,
+			Status:  400,
 		})
 		return
 	}
@@ -565,32 +458,13 @@ func (srv *Server) APISearchPost(w http.ResponseWriter, r *http.Request) {
 		utility.Error(w, utility.HTTPError{
 			Public:  utility.PublicBadRequest,
 			Message: "Couldn't range from",
-			Code:    400,
+			Status:  400,
 		})
 		return
 	}
 
-	const Query = `
-	SELECT *
-	FROM Posts
-	WHERE ParentId = -1
-	AND lower(content) LIKE lower(?)
-	ORDER BY id DESC
-	LIMIT ? OFFSET ?
-	`
-
-	rows, err := srv.Query(Query, fmt.Sprintf("%%%s%%", content), postRange, from)
+	Posts, err := srv.Posts.Search(content, from, postRange)
 	if err != nil {
-		utility.Error(w, utility.HTTPError{
-			Public:  utility.PublicServerError,
-			Message: err.Error(),
-			Code:    500,
-		})
-		return
-	}
-
-	var Posts []PostDB
-	if err := scan.Rows(&Posts, rows); err != nil {
 		utility.SendScanErr(w, err, nil)
 		return
 	}
@@ -599,32 +473,15 @@ func (srv *Server) APISearchPost(w http.ResponseWriter, r *http.Request) {
 		utility.Error(w, utility.HTTPError{
 			Public:  utility.PublicNotFoundError,
 			Message: "no rows found",
-			Code:    404,
+			Status:  404,
 		})
 		return
 	}
 
-	JSON, err := json.Marshal(Posts)
-	if err != nil {
-		utility.Error(w, utility.HTTPError{
-			Public:  utility.PublicServerError,
-			Message: err.Error(),
-			Code:    500,
-		})
-		return
-	}
-
-	zipped, err := utility.GZipBytes(JSON)
-	if err != nil {
-		utility.Error(w, utility.HTTPError{
-			Public:  utility.PublicServerError,
-			Message: err.Error(),
-			Code:    500,
-		})
+	if sentErr := srv.attachPostImageMeta(Posts); sentErr != nil {
+		utility.Error(w, *sentErr)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("Content-Encoding", "gzip")
-	w.Write(zipped)
+	utility.Send(w, http.StatusOK, Posts)
 }
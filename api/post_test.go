@@ -0,0 +1,132 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// addPost adds a post by the logged in user, returning it's ID
+func addPost(t *testing.T, handler http.Handler, auth *http.Cookie, post AddPostRequest) int {
+	t.Helper()
+
+	added := decodeData[map[string]int](t, request(t, handler, "POST", "/api/post/add", post, auth), http.StatusCreated)
+	return added["ID"]
+}
+
+func TestAddPost(t *testing.T) {
+	_, handler := newTestServer(t, testConfig())
+	ID, auth := signUp(t, handler, "coffee")
+	otherID, _ := signUp(t, handler, "tea")
+
+	postID := addPost(t, handler, auth, AddPostRequest{PostedBy: ID, Content: "Hello", ParentID: -1})
+	pst := decodeData[PostDB](t, request(t, handler, "GET", fmt.Sprintf("/api/post/get-post-from-id/%d", postID), nil), http.StatusOK)
+	if pst.Content != "Hello" || pst.PostedBy != ID || pst.ParentID != -1 {
+		t.Fatalf("got %+v", pst)
+	}
+
+	unknown := &http.Cookie{Name: authCookieName, Value: "unknown"}
+	tests := []struct {
+		name   string
+		body   any
+		auth   *http.Cookie
+		status int
+		code   string
+	}{
+		{"no cookie", AddPostRequest{PostedBy: ID, Content: "Hello", ParentID: -1}, nil, http.StatusUnauthorized, "not_logged_in"},
+		{"unknown auth", AddPostRequest{PostedBy: ID, Content: "Hello", ParentID: -1}, unknown, http.StatusUnauthorized, "not_logged_in"},
+		{"other user", AddPostRequest{PostedBy: otherID, Content: "Hello", ParentID: -1}, auth, http.StatusForbidden, "invalid_user"},
+		{"no content", AddPostRequest{PostedBy: ID, ParentID: -1}, auth, http.StatusBadRequest, "no_content"},
+		{"too long", AddPostRequest{PostedBy: ID, Content: strings.Repeat("a", maxPostLength+1), ParentID: -1}, auth, http.StatusBadRequest, "post_too_long"},
+		{"no parent", AddPostRequest{PostedBy: ID, Content: "Hello"}, auth, http.StatusBadRequest, "no_parent"},
+		{"parent not found", AddPostRequest{PostedBy: ID, Content: "Hello", ParentID: 999}, auth, http.StatusBadRequest, "parent_not_found"},
+		{"invalid fields", AddPostRequest{PostedBy: ID}, auth, http.StatusBadRequest, "invalid_fields"},
+		{"invalid body", []byte("{"), auth, http.StatusBadRequest, "invalid_body"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var cookies []*http.Cookie
+			if test.auth != nil {
+				cookies = append(cookies, test.auth)
+			}
+
+			expectError(t, request(t, handler, "POST", "/api/post/add", test.body, cookies...), test.status, test.code)
+		})
+	}
+
+}
+
+func TestPostFeed(t *testing.T) {
+	_, handler := newTestServer(t, testConfig())
+	ID, auth := signUp(t, handler, "coffee")
+
+	// Without posts, the feed can't be made
+	expectError(t, request(t, handler, "GET", "/api/post/feed", nil), http.StatusInternalServerError, "internal_error")
+
+	postID := addPost(t, handler, auth, AddPostRequest{PostedBy: ID, Content: "Hello", ParentID: -1})
+	addPost(t, handler, auth, AddPostRequest{PostedBy: ID, Content: "A comment", ParentID: postID})
+
+	// Comments aren't in the feed
+	pst := decodeData[PostDB](t, request(t, handler, "GET", "/api/post/feed", nil), http.StatusOK)
+	if pst.ID != postID {
+		t.Fatalf("feed sent %+v, expected post %d", pst, postID)
+	}
+
+	posts := decodeData[[]PostDB](t, request(t, handler, "GET", "/api/post/feedlist/3", nil), http.StatusOK)
+	if len(posts) != 3 {
+		t.Fatalf("feedlist sent %d posts, expected 3", len(posts))
+	}
+	for _, pst := range posts {
+		if pst.ID != postID {
+			t.Fatalf("feedlist sent %+v, expected post %d", pst, postID)
+		}
+	}
+
+	expectError(t, request(t, handler, "GET", "/api/post/feedlist/many", nil), http.StatusBadRequest, "bad_request")
+}
+
+func TestCommentsFromPost(t *testing.T) {
+	_, handler := newTestServer(t, testConfig())
+	ID, auth := signUp(t, handler, "coffee")
+
+	postID := addPost(t, handler, auth, AddPostRequest{PostedBy: ID, Content: "Hello", ParentID: -1})
+
+	target := fmt.Sprintf("/api/post/get-comments-from-post?ID=%d&from=0&range=10", postID)
+	if comments := decodeData[[]PostDB](t, request(t, handler, "GET", target, nil), http.StatusOK); len(comments) != 0 {
+		t.Fatalf("expected no comments, got %+v", comments)
+	}
+
+	var commentIDs []int
+	for i := 0; i < 3; i++ {
+		commentIDs = append(commentIDs, addPost(t, handler, auth, AddPostRequest{PostedBy: ID, Content: fmt.Sprint("Comment ", i), ParentID: postID}))
+	}
+
+	comments := decodeData[[]PostDB](t, request(t, handler, "GET", target, nil), http.StatusOK)
+	if len(comments) != len(commentIDs) {
+		t.Fatalf("got %d comments, expected %d", len(comments), len(commentIDs))
+	}
+	for i, comment := range comments {
+		if comment.ID != commentIDs[i] || comment.ParentID != postID {
+			t.Fatalf("comment %d is %+v, expected the oldest first", i, comment)
+		}
+	}
+
+	paged := fmt.Sprintf("/api/post/get-comments-from-post?ID=%d&from=1&range=1", postID)
+	if comments := decodeData[[]PostDB](t, request(t, handler, "GET", paged, nil), http.StatusOK); len(comments) != 1 || comments[0].ID != commentIDs[1] {
+		t.Fatalf("expected the 2nd comment, got %+v", comments)
+	}
+
+	for _, query := range []string{"ID=a&from=0&range=10", "ID=1&from=a&range=10", "ID=1&from=0"} {
+		w := request(t, handler, "GET", "/api/post/get-comments-from-post?"+query, nil)
+		expectError(t, w, http.StatusBadRequest, "bad_request")
+	}
+}
+
+func TestPostFromID(t *testing.T) {
+	_, handler := newTestServer(t, testConfig())
+
+	expectError(t, request(t, handler, "GET", "/api/post/get-post-from-id/999", nil), http.StatusNotFound, "not_found")
+	expectError(t, request(t, handler, "GET", "/api/post/get-post-from-id/a", nil), http.StatusBadRequest, "bad_request")
+}
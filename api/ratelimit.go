@@ -0,0 +1,262 @@
+package api
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Blockitifluy/CoffeeCo/utility"
+)
+
+// LimitKey is how a [RateLimit] tells clients apart
+type LimitKey int
+
+const (
+	// LimitByIP limits each client IP (see [Server.ClientIP])
+	LimitByIP LimitKey = iota
+	// LimitByUser limits each logged in user (from the `AuthToken` cookie), other clients are limited by IP
+	LimitByUser
+)
+
+// RateLimit is how many requests a client can send to a route, as a token bucket:
+// each request takes a token, and the bucket is refilled with Requests tokens every Per (up to Burst)
+type RateLimit struct {
+	Requests int           // The amount of requests every Per, 0 isn't limited
+	Per      time.Duration // e.g.: time.Minute
+	Burst    int           // The most requests sent at once (the size of the bucket), Requests when 0
+	By       LimitKey
+}
+
+// capacity is the size of the bucket
+func (limit RateLimit) capacity() float64 {
+	if limit.Burst > 0 {
+		return float64(limit.Burst)
+	}
+	return float64(limit.Requests)
+}
+
+// refill is the time taken for one token to be added
+func (limit RateLimit) refill() time.Duration {
+	return limit.Per / time.Duration(limit.Requests)
+}
+
+// limitSweepInterval is how often full buckets are removed (a full bucket is the same as no bucket)
+const limitSweepInterval = time.Minute
+
+// tokenBucket is the tokens of a client
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// rateLimiter is the buckets of every client of a route
+type rateLimiter struct {
+	limit RateLimit
+
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+	swept   time.Time
+}
+
+func newRateLimiter(limit RateLimit) *rateLimiter {
+	return &rateLimiter{limit: limit, buckets: map[string]*tokenBucket{}, swept: time.Now()}
+}
+
+// limitResult is the state of a client's bucket after a request
+type limitResult struct {
+	Allowed   bool
+	Remaining int           // The tokens left
+	Retry     time.Duration // How long until a token is added, when the request isn't allowed
+	Reset     time.Duration // How long until the bucket is full
+}
+
+// take takes a token from the key's bucket, the request is allowed if there was a token
+func (l *rateLimiter) take(key string, now time.Time) limitResult {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	capacity, refill := l.limit.capacity(), l.limit.refill()
+	if now.Sub(l.swept) >= limitSweepInterval {
+		l.sweep(now)
+	}
+
+	bucket, ok := l.buckets[key]
+	if !ok {
+		bucket = &tokenBucket{tokens: capacity, updated: now}
+		l.buckets[key] = bucket
+	}
+
+	bucket.tokens = math.Min(capacity, bucket.tokens+float64(now.Sub(bucket.updated))/float64(refill))
+	bucket.updated = now
+
+	result := limitResult{Allowed: bucket.tokens >= 1}
+	if result.Allowed {
+		bucket.tokens--
+	} else {
+		result.Retry = time.Duration((1 - bucket.tokens) * float64(refill))
+	}
+
+	result.Remaining = int(bucket.tokens)
+	result.Reset = time.Duration((capacity - bucket.tokens) * float64(refill))
+	return result
+}
+
+// sweep removes the buckets that have refilled, whilst locked
+func (l *rateLimiter) sweep(now time.Time) {
+	capacity, refill := l.limit.capacity(), l.limit.refill()
+	for key, bucket := range l.buckets {
+		if bucket.tokens+float64(now.Sub(bucket.updated))/float64(refill) >= capacity {
+			delete(l.buckets, key)
+		}
+	}
+
+	l.swept = now
+}
+
+// ParseTrustedProxies parses `TRUSTED_PROXIES`, IPs or CIDRs separated by commas (e.g.: 10.0.0.0/8, 127.0.0.1)
+func ParseTrustedProxies(proxies string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, proxy := range strings.Split(proxies, ",") {
+		proxy = strings.TrimSpace(proxy)
+		if proxy == "" {
+			continue
+		}
+
+		if !strings.Contains(proxy, "/") {
+			addr, err := netip.ParseAddr(proxy)
+			if err != nil {
+				return nil, fmt.Errorf("%s isn't an IP or CIDR", proxy)
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+
+		prefix, err := netip.ParsePrefix(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("%s isn't an IP or CIDR", proxy)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+
+	return prefixes, nil
+}
+
+// isTrustedProxy checks if the address is one of `TRUSTED_PROXIES`
+func (srv *Server) isTrustedProxy(addr netip.Addr) bool {
+	for _, prefix := range srv.trustedProxies {
+		if prefix.Contains(addr.Unmap()) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ClientIP is the IP of the client sending the request. When the connection is from a trusted proxy
+// (see `TRUSTED_PROXIES`), `X-Forwarded-For` is read from the right, skipping the trusted proxies,
+// so clients can't choose their IP
+func (srv *Server) ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	addr, err := netip.ParseAddr(host)
+	if err != nil || !srv.isTrustedProxy(addr) {
+		return host
+	}
+
+	var forwarded []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		forwarded = append(forwarded, strings.Split(header, ",")...)
+	}
+
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		hop, err := netip.ParseAddr(strings.TrimSpace(forwarded[i]))
+		if err != nil { // Sent by the client, the proxy before it is the client
+			break
+		}
+
+		addr = hop.Unmap()
+		if !srv.isTrustedProxy(addr) {
+			break
+		}
+	}
+
+	return addr.String()
+}
+
+// limitKey is the bucket of the request, the user's ID or the client's IP
+func (srv *Server) limitKey(r *http.Request, by LimitKey) (string, error) {
+	if by == LimitByUser {
+		if cookie, err := r.Cookie(authCookieName); err == nil {
+			ID, err := srv.Users.IDFromAuth(cookie.Value)
+			if err == nil {
+				setRequestUser(r, ID)
+				return "user:" + strconv.Itoa(ID), nil
+			} else if err != sql.ErrNoRows {
+				return "", err
+			}
+		}
+	}
+
+	return "ip:" + srv.ClientIP(r), nil
+}
+
+// seconds rounds a duration up to whole seconds, for headers
+func seconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
+
+// rateLimit limits the requests sent to a route (see [RateLimit]). Every response has the
+// `RateLimit-Limit`, `RateLimit-Remaining`, `RateLimit-Reset` and `RateLimit-Policy` headers,
+// limited requests are sent a `429` (`too_many_requests`) with `Retry-After`
+func (srv *Server) rateLimit(limit RateLimit, next http.Handler) http.Handler {
+	limiter := newRateLimiter(limit)
+	policy := fmt.Sprintf("%d;w=%s", limit.Requests, seconds(limit.Per)) // Requests every Per (in seconds)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key, err := srv.limitKey(r, limit.By)
+		if err != nil {
+			utility.Error(w, utility.HTTPError{
+				Public:  utility.PublicServerError,
+				Message: err.Error(),
+				Status:  500,
+			})
+			return
+		}
+
+		result := limiter.take(key, time.Now())
+
+		header := w.Header()
+		header.Set("RateLimit-Limit", strconv.Itoa(int(limit.capacity())))
+		header.Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		header.Set("RateLimit-Reset", seconds(result.Reset))
+		header.Set("RateLimit-Policy", policy)
+
+		if !result.Allowed {
+			route := ""
+			if info := getRequestInfo(r); info != nil {
+				route = info.Route
+			}
+			srv.metrics.rateLimited.WithLabelValues(route).Inc()
+
+			header.Set("Retry-After", seconds(result.Retry))
+			utility.Error(w, utility.HTTPError{
+				Public:  "Too Many Requests, try again in " + seconds(result.Retry) + "s",
+				Message: "too many requests sent to the route",
+				Status:  http.StatusTooManyRequests,
+			})
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,201 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// limitedConfig is testConfig with rate limits, trusting 10.0.0.0/8 as proxies
+func limitedConfig() Config {
+	cfg := testConfig()
+	cfg.Limits.Enabled = true
+	cfg.Limits.TrustedProxies = "10.0.0.0/8"
+	return cfg
+}
+
+// requestFrom sends a request from remoteAddr, with an `X-Forwarded-For` when forwarded isn't empty
+func requestFrom(handler http.Handler, method, target, remoteAddr, forwarded string, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, target, nil)
+	r.RemoteAddr = remoteAddr
+	if forwarded != "" {
+		r.Header.Set("X-Forwarded-For", forwarded)
+	}
+	for _, cookie := range cookies {
+		r.AddCookie(cookie)
+	}
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	return w
+}
+
+func TestRateLimiterRefill(t *testing.T) {
+	limiter := newRateLimiter(RateLimit{Requests: 2, Per: time.Second})
+	now := time.Now()
+
+	for i := 0; i < 2; i++ {
+		if result := limiter.take("client", now); !result.Allowed || result.Remaining != 1-i {
+			t.Fatalf("request %d: got %+v, expected it to be allowed with %d remaining", i, result, 1-i)
+		}
+	}
+
+	result := limiter.take("client", now)
+	if result.Allowed || result.Retry != 500*time.Millisecond || result.Reset != time.Second {
+		t.Fatalf("got %+v, expected a retry after 500ms and a reset after 1s", result)
+	}
+
+	// Other clients have their own bucket
+	if result := limiter.take("other", now); !result.Allowed {
+		t.Fatalf("another client got %+v, expected it to be allowed", result)
+	}
+
+	// A token is added every 500ms
+	if result := limiter.take("client", now.Add(499*time.Millisecond)); result.Allowed {
+		t.Fatalf("got %+v before a token was added", result)
+	}
+	if result := limiter.take("client", now.Add(500*time.Millisecond)); !result.Allowed {
+		t.Fatalf("got %+v after a token was added", result)
+	}
+
+	// Refilled buckets are removed
+	limiter.take("client", now.Add(time.Hour))
+	if _, ok := limiter.buckets["other"]; ok {
+		t.Fatal("expected the refilled bucket to be swept")
+	}
+}
+
+func TestRateLimiterBurst(t *testing.T) {
+	limiter := newRateLimiter(RateLimit{Requests: 60, Per: time.Minute, Burst: 3})
+	now := time.Now()
+
+	for i := 0; i < 3; i++ {
+		if result := limiter.take("client", now); !result.Allowed {
+			t.Fatalf("request %d: got %+v, expected the burst to be allowed", i, result)
+		}
+	}
+
+	if result := limiter.take("client", now); result.Allowed || result.Retry != time.Second {
+		t.Fatalf("got %+v, expected a retry after 1s", result)
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	srv, _ := newTestServer(t, limitedConfig())
+
+	tests := []struct {
+		name, remoteAddr, forwarded string
+		want                        string
+	}{
+		{"no proxy", "203.0.113.5:1234", "", "203.0.113.5"},
+		{"spoofed by an untrusted peer", "203.0.113.5:1234", "198.51.100.1", "203.0.113.5"},
+		{"trusted proxy", "10.0.0.1:1234", "198.51.100.1", "198.51.100.1"},
+		{"trusted proxies", "10.0.0.1:1234", "198.51.100.1, 10.0.0.2", "198.51.100.1"},
+		{"spoofed through a trusted proxy", "10.0.0.1:1234", "192.0.2.9, 198.51.100.1", "198.51.100.1"},
+		{"garbage through a trusted proxy", "10.0.0.1:1234", "not-an-ip", "10.0.0.1"},
+		{"ipv6", "[2001:db8::1]:1234", "198.51.100.1", "2001:db8::1"},
+	}
+
+	for _, test := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = test.remoteAddr
+		if test.forwarded != "" {
+			r.Header.Set("X-Forwarded-For", test.forwarded)
+		}
+
+		if got := srv.ClientIP(r); got != test.want {
+			t.Errorf("%s: ClientIP = %s, expected %s", test.name, got, test.want)
+		}
+	}
+}
+
+func TestRateLimitHeaders(t *testing.T) {
+	_, handler := newTestServer(t, limitedConfig())
+	const signUpLimit = 5 // See the `/api/user/add` route
+
+	for i := 0; i < signUpLimit; i++ {
+		w := requestFrom(handler, "POST", "/api/user/add", "203.0.113.5:1234", "")
+		if w.Code == http.StatusTooManyRequests {
+			t.Fatalf("request %d was limited", i)
+		}
+
+		header := w.Header()
+		if header.Get("RateLimit-Limit") != strconv.Itoa(signUpLimit) || header.Get("RateLimit-Remaining") != strconv.Itoa(signUpLimit-1-i) {
+			t.Fatalf("request %d: got RateLimit-Limit %q and RateLimit-Remaining %q", i, header.Get("RateLimit-Limit"), header.Get("RateLimit-Remaining"))
+		}
+		if header.Get("RateLimit-Policy") != fmt.Sprintf("%d;w=3600", signUpLimit) || header.Get("RateLimit-Reset") == "" {
+			t.Fatalf("request %d: got RateLimit-Policy %q and RateLimit-Reset %q", i, header.Get("RateLimit-Policy"), header.Get("RateLimit-Reset"))
+		}
+	}
+
+	w := requestFrom(handler, "POST", "/api/user/add", "203.0.113.5:1234", "")
+	expectError(t, w, http.StatusTooManyRequests, "too_many_requests")
+	if retry := w.Header().Get("Retry-After"); retry != "720" { // A token is added every 12 minutes
+		t.Fatalf("Retry-After is %q, expected 720", retry)
+	}
+
+	// Routes without a limit aren't limited
+	if w := requestFrom(handler, "GET", "/api/user/search?name=a&from=0&range=1", "203.0.113.5:1234", ""); w.Header().Get("RateLimit-Limit") != "" {
+		t.Fatal("expected an unlimited route to not have RateLimit headers")
+	}
+}
+
+func TestRateLimitSpoofedForwardedFor(t *testing.T) {
+	_, handler := newTestServer(t, limitedConfig())
+	const logInLimit = 10 // See the `/api/user/log-in` route
+
+	// A client changing X-Forwarded-For isn't a new client, it isn't sent from a trusted proxy
+	for i := 0; i <= logInLimit; i++ {
+		w := requestFrom(handler, "POST", "/api/user/log-in", "203.0.113.5:1234", fmt.Sprintf("198.51.100.%d", i))
+		if limited := w.Code == http.StatusTooManyRequests; limited != (i == logInLimit) {
+			t.Fatalf("request %d: status is %d", i, w.Code)
+		}
+	}
+
+	// Behind a trusted proxy, each forwarded client has it's own bucket
+	for i := 0; i <= logInLimit; i++ {
+		w := requestFrom(handler, "POST", "/api/user/log-in", "10.0.0.1:1234", fmt.Sprintf("198.51.100.%d", i))
+		if w.Code == http.StatusTooManyRequests {
+			t.Fatalf("forwarded client %d was limited", i)
+		}
+	}
+}
+
+func TestRateLimitByUser(t *testing.T) {
+	_, handler := newTestServer(t, limitedConfig())
+	const postBurst = 10 // See the `/api/post/add` route
+
+	// Logged in users are limited by their ID, not their IP
+	_, coffee := signUp(t, handler, "coffee")
+	_, tea := signUp(t, handler, "tea")
+	for i := 0; i < postBurst; i++ {
+		if w := requestFrom(handler, "POST", "/api/post/add", "203.0.113.5:1234", "", coffee); w.Code == http.StatusTooManyRequests {
+			t.Fatalf("request %d was limited", i)
+		}
+	}
+
+	w := requestFrom(handler, "POST", "/api/post/add", "203.0.113.5:1234", "", coffee)
+	expectError(t, w, http.StatusTooManyRequests, "too_many_requests")
+
+	// Another user from the same IP has their own bucket, so does a client that isn't logged in
+	if w := requestFrom(handler, "POST", "/api/post/add", "203.0.113.5:1234", "", tea); w.Code == http.StatusTooManyRequests {
+		t.Fatal("another user was limited")
+	}
+	if w := requestFrom(handler, "POST", "/api/post/add", "203.0.113.5:1234", ""); w.Code == http.StatusTooManyRequests {
+		t.Fatal("a client that isn't logged in was limited")
+	}
+
+	// The same user is limited from another IP
+	if w := requestFrom(handler, "POST", "/api/post/add", "198.51.100.1:1234", "", coffee); w.Code != http.StatusTooManyRequests {
+		t.Fatalf("status is %d from another IP, expected the user to be limited", w.Code)
+	}
+
+	// An unknown auth is limited by IP
+	unknown := &http.Cookie{Name: authCookieName, Value: "unknown"}
+	if w := requestFrom(handler, "POST", "/api/post/add", "203.0.113.5:1234", "", unknown); w.Code == http.StatusTooManyRequests {
+		t.Fatal("an unknown auth was limited as the user")
+	}
+}
@@ -0,0 +1,58 @@
+package api
+
+import (
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/Blockitifluy/CoffeeCo/utility"
+)
+
+// recoverMiddleware recovers a panicking handler, logging the panic with it's stack.
+// When nothing has been written a `500` (`internal_error`) is sent, otherwise the response is aborted
+// (see [http.ErrAbortHandler]), so the client doesn't mistake it for a complete response
+func recoverMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sw := &statusWriter{ResponseWriter: w}
+
+		defer func() {
+			p := recover()
+			if p == nil {
+				return
+			} else if p == http.ErrAbortHandler { // Already aborting
+				panic(p)
+			}
+
+			var ID string
+			if info := getRequestInfo(r); info != nil {
+				ID = info.ID
+			}
+
+			slog.Error("handler panicked",
+				"request_id", ID,
+				"method", r.Method,
+				"path", r.URL.Path,
+				"panic", p,
+				"stack", string(debug.Stack()),
+			)
+
+			if sw.status != 0 {
+				panic(http.ErrAbortHandler)
+			}
+
+			header := sw.Header() // Set by the handler, for the response it didn't send
+			for _, key := range []string{"Cache-Control", "Content-Length", "ETag", "Last-Modified"} {
+				header.Del(key)
+			}
+
+			utility.Error(sw, utility.HTTPError{
+				Code:    utility.CodeInternal,
+				Public:  utility.PublicServerError,
+				Message: "the handler panicked",
+				Status:  500,
+			})
+		}()
+
+		next.ServeHTTP(sw, r)
+	})
+}
@@ -0,0 +1,386 @@
+// Package seed generates realistic users, follows, posts, comments, reactions and images
+// for development, demos and load tests.
+//
+// Everything is written through the stores, so it's the same as data added by the api.
+// The same seed (with the same [Options]) generates the same data into an empty database.
+package seed
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"math/rand"
+	"net/url"
+	"strings"
+
+	"github.com/Blockitifluy/CoffeeCo/api"
+	"github.com/Blockitifluy/CoffeeCo/utility"
+	"github.com/google/uuid"
+)
+
+// Password is the password of every generated user
+const Password = "coffeeco"
+
+// Options is what (and how much) is generated
+type Options struct {
+	Seed      int64 // The random seed, the same seed generates the same data
+	Users     int   // The amount of users
+	Follows   int   // The most users a user follows
+	Posts     int   // The most posts a user posts
+	Comments  int   // The most comments (or replies) a post or comment has
+	Depth     int   // How deep replies are nested (1 is only comments)
+	Reactions int   // The most likes or dislikes a post or comment has
+	Images    int   // The amount of generated images, used by some posts
+}
+
+// DefaultOptions are a small instance, for demos and frontend work
+var DefaultOptions = Options{
+	Seed:      1,
+	Users:     25,
+	Follows:   10,
+	Posts:     5,
+	Comments:  3,
+	Depth:     3,
+	Reactions: 10,
+	Images:    10,
+}
+
+// Result is the amount of generated data
+type Result struct {
+	Users, Follows, Posts, Comments, Reactions, Images int
+}
+
+// maxContent is the longest a post can be (see the Posts table)
+const maxContent = 240
+
+// generator generates data using a seeded random source
+type generator struct {
+	stores  api.Stores
+	options Options
+	rng     *rand.Rand
+
+	users  []int    // The IDs of the generated users
+	images []string // The urls of the generated images
+	result Result
+}
+
+// Generate generates data into the stores, generated users can log in with [Password]
+func Generate(stores api.Stores, options Options) (Result, error) {
+	if options.Users < 1 {
+		return Result{}, errors.New("at least 1 user must be generated")
+	}
+
+	gen := &generator{
+		stores:  stores,
+		options: options,
+		rng:     rand.New(rand.NewSource(options.Seed)),
+	}
+
+	steps := []func() error{gen.addUsers, gen.addFollows, gen.addImages, gen.addPosts}
+	for _, step := range steps {
+		if err := step(); err != nil {
+			return gen.result, err
+		}
+	}
+
+	return gen.result, nil
+}
+
+// between gets a random number from min to max (inclusive)
+func (gen *generator) between(min, max int) int {
+	if max <= min {
+		return min
+	}
+
+	return min + gen.rng.Intn(max-min+1)
+}
+
+// pick gets a random item
+func pick[t any](rng *rand.Rand, items []t) t {
+	return items[rng.Intn(len(items))]
+}
+
+// otherUsers gets up to amount random users, excluding the user except
+func (gen *generator) otherUsers(except, amount int) []int {
+	var others []int
+	for _, index := range gen.rng.Perm(len(gen.users)) {
+		if len(others) == amount {
+			break
+		}
+
+		if ID := gen.users[index]; ID != except {
+			others = append(others, ID)
+		}
+	}
+
+	return others
+}
+
+// freeHandle gets a handle (name followed by a number) that isn't used yet,
+// so the database can be seeded more than once
+func (gen *generator) freeHandle(name string, number int) (string, error) {
+	for ; ; number += gen.options.Users {
+		handle := fmt.Sprintf("%s%d", name, number)
+
+		_, err := gen.stores.Users.ByHandle(handle)
+		if errors.Is(err, sql.ErrNoRows) {
+			return handle, nil
+		} else if err != nil {
+			return "", err
+		}
+	}
+}
+
+func (gen *generator) addUsers() error {
+	for i := 0; i < gen.options.Users; i++ {
+		first, last := pick(gen.rng, firstNames), pick(gen.rng, lastNames)
+
+		handle, err := gen.freeHandle(strings.ToLower(first)+strings.ToLower(last[:1]), i+1)
+		if err != nil {
+			return err
+		}
+
+		user := api.User{
+			PublicUser: &api.PublicUser{Username: first + " " + last, Handle: handle},
+			Email:      handle + "@example.com",
+		}
+		user.SetPassword(Password)
+
+		ID, err := gen.stores.Users.Add(user)
+		if err != nil {
+			return fmt.Errorf("couldn't add @%s: %w", handle, err)
+		}
+
+		gen.users = append(gen.users, ID)
+		gen.result.Users++
+	}
+
+	return nil
+}
+
+func (gen *generator) addFollows() error {
+	for _, follower := range gen.users {
+		for _, ID := range gen.otherUsers(follower, gen.between(0, gen.options.Follows)) {
+			if err := gen.stores.Users.Follow(ID, follower); err != nil {
+				return fmt.Errorf("couldn't follow user %d: %w", ID, err)
+			}
+
+			gen.result.Follows++
+		}
+	}
+
+	return nil
+}
+
+// imageWidth and imageHeight are the size of generated images, they're small so seeding is quick
+const imageWidth, imageHeight = 320, 200
+
+// randomImage draws a gradient with circles in it, as a PNG
+func (gen *generator) randomImage() ([]byte, error) {
+	randomColor := func() color.RGBA {
+		return color.RGBA{uint8(gen.rng.Intn(256)), uint8(gen.rng.Intn(256)), uint8(gen.rng.Intn(256)), 255}
+	}
+
+	from, to := randomColor(), randomColor()
+	lerp := func(a, b uint8, t float64) uint8 {
+		return uint8(float64(a) + (float64(b)-float64(a))*t)
+	}
+
+	type circle struct {
+		x, y, r int
+		fill    color.RGBA
+	}
+
+	circles := make([]circle, gen.between(1, 4))
+	for i := range circles {
+		circles[i] = circle{gen.rng.Intn(imageWidth), gen.rng.Intn(imageHeight), gen.between(15, 60), randomColor()}
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, imageWidth, imageHeight))
+	for y := 0; y < imageHeight; y++ {
+		t := float64(y) / imageHeight
+		background := color.RGBA{lerp(from.R, to.R, t), lerp(from.G, to.G, t), lerp(from.B, to.B, t), 255}
+
+		for x := 0; x < imageWidth; x++ {
+			pixel := background
+			for _, c := range circles {
+				if dx, dy := x-c.x, y-c.y; dx*dx+dy*dy <= c.r*c.r {
+					pixel = c.fill
+				}
+			}
+
+			img.SetRGBA(x, y, pixel)
+		}
+	}
+
+	var buf bytes.Buffer
+	err := png.Encode(&buf, img)
+	return buf.Bytes(), err
+}
+
+// addImages adds images, the same way as they're uploaded (see [api.Server.APIUploadImage])
+func (gen *generator) addImages() error {
+	for i := 0; i < gen.options.Images; i++ {
+		ID, err := uuid.NewRandomFromReader(gen.rng) // From the seed, so the urls are the same every time
+		if err != nil {
+			return err
+		}
+
+		content, err := gen.randomImage()
+		if err != nil {
+			return err
+		}
+
+		src := "/api/images/download/" + url.PathEscape(ID.String())
+
+		// Seeding again with the same seed generates the same images
+		if _, err := gen.stores.Images.Get(ID.String()); err == nil {
+			gen.images = append(gen.images, src)
+			continue
+		} else if !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+
+		info, err := utility.GetImageInfo(content)
+		if err != nil {
+			return err
+		}
+
+		zipped, err := utility.GZipBytes(content)
+		if err != nil {
+			return err
+		}
+
+		Image := api.ImageData{URL: ID.String(), Content: zipped, ContentType: "image/png", ETag: utility.GenerateETag(content)}
+		meta := api.ImageMeta{Width: info.Width, Height: info.Height, BlurHash: info.BlurHash, Color: info.Color}
+
+		if err := gen.stores.Images.Add(Image, meta); err != nil {
+			return fmt.Errorf("couldn't add an image: %w", err)
+		}
+
+		gen.images = append(gen.images, src)
+		gen.result.Images++
+	}
+
+	return nil
+}
+
+// sentence generates a post or comment, shorter than maxContent
+func (gen *generator) sentence() string {
+	content := pick(gen.rng, openers)
+
+	for words := gen.between(3, 12); words > 0; words-- {
+		word := pick(gen.rng, wordList)
+		if len(content)+len(word)+2 > maxContent {
+			break
+		}
+
+		content += " " + word
+	}
+
+	ending := pick(gen.rng, endings)
+	if len(content)+len(ending) <= maxContent {
+		content += ending
+	}
+
+	return content
+}
+
+// postImages gets the images string of a post (see [api.PostDB]), most posts don't have images
+func (gen *generator) postImages() string {
+	if len(gen.images) == 0 || gen.rng.Intn(4) != 0 {
+		return ""
+	}
+
+	var images []string
+	for i := gen.between(1, 2); i > 0; i-- {
+		images = append(images, fmt.Sprintf("%s (%s)", pick(gen.rng, gen.images), pick(gen.rng, altTexts)))
+	}
+
+	return strings.Join(images, ",")
+}
+
+// react adds likes and dislikes to a post or comment, most reactions are likes
+func (gen *generator) react(ID, postedBy int) error {
+	for _, user := range gen.otherUsers(postedBy, gen.between(0, gen.options.Reactions)) {
+		if err := gen.stores.Posts.React(ID, user, gen.rng.Intn(5) != 0); err != nil {
+			return fmt.Errorf("couldn't react to post %d: %w", ID, err)
+		}
+
+		gen.result.Reactions++
+	}
+
+	return nil
+}
+
+// addComments adds comments (and replies to them) to a post or comment, depth is how deep the parent is
+func (gen *generator) addComments(parentID, depth int) error {
+	if depth > gen.options.Depth {
+		return nil
+	}
+
+	amount := gen.between(0, gen.options.Comments)
+	if depth > 1 { // Replies are rarer
+		amount = gen.between(0, gen.options.Comments/depth)
+	}
+
+	for i := 0; i < amount; i++ {
+		postedBy := pick(gen.rng, gen.users)
+
+		ID, err := gen.stores.Posts.Add(api.AddPostRequest{PostedBy: postedBy, Content: gen.sentence(), ParentID: parentID})
+		if err != nil {
+			return fmt.Errorf("couldn't add a comment: %w", err)
+		}
+
+		gen.result.Comments++
+
+		if err := gen.react(ID, postedBy); err != nil {
+			return err
+		}
+
+		if err := gen.addComments(ID, depth+1); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// addPosts adds the posts of every user, mixed together so feeds aren't grouped by user
+func (gen *generator) addPosts() error {
+	var authors []int
+	for _, ID := range gen.users {
+		for i := gen.between(0, gen.options.Posts); i > 0; i-- {
+			authors = append(authors, ID)
+		}
+	}
+
+	gen.rng.Shuffle(len(authors), func(i, j int) {
+		authors[i], authors[j] = authors[j], authors[i]
+	})
+
+	for _, postedBy := range authors {
+		post := api.AddPostRequest{PostedBy: postedBy, Content: gen.sentence(), ParentID: -1, Images: gen.postImages()}
+
+		ID, err := gen.stores.Posts.Add(post)
+		if err != nil {
+			return fmt.Errorf("couldn't add a post: %w", err)
+		}
+
+		gen.result.Posts++
+
+		if err := gen.react(ID, postedBy); err != nil {
+			return err
+		}
+
+		if err := gen.addComments(ID, 1); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,35 @@
+package seed
+
+// The words generated users, posts and comments are made from
+
+var firstNames = []string{
+	"Ada", "Alex", "Amara", "Ben", "Chloe", "Dev", "Elena", "Finn", "Grace", "Hiro",
+	"Isla", "Jack", "Kai", "Lena", "Mateo", "Nia", "Omar", "Priya", "Quinn", "Rosa",
+	"Sam", "Tariq", "Uma", "Vera", "Wren", "Yusuf", "Zoe",
+}
+
+var lastNames = []string{
+	"Arabica", "Barista", "Crema", "Doppio", "Espresso", "Filter", "Grinder", "Honey",
+	"Latte", "Macchiato", "Mocha", "Ristretto", "Roast", "Steamer", "Tamper",
+}
+
+var openers = []string{
+	"Just made", "Can't stop thinking about", "Hot take:", "Today I tried", "Does anyone else love",
+	"Reminder:", "Currently drinking", "Unpopular opinion:", "Finally found", "Nothing beats",
+	"Agreed,", "Not sure about", "Honestly", "Wait,", "Same here,",
+}
+
+var wordList = []string{
+	"a", "the", "my", "this", "that", "really", "very", "so", "with", "and", "without", "before", "after",
+	"espresso", "cortado", "flat white", "cold brew", "pour over", "french press", "latte", "cappuccino",
+	"beans", "grinder", "roast", "crema", "milk", "oat milk", "foam", "cup", "mug", "café", "barista",
+	"morning", "afternoon", "weekend", "smooth", "bitter", "fruity", "nutty", "chocolatey", "bright",
+	"light roast", "dark roast", "single origin", "blend", "Ethiopian", "Colombian", "Kenyan", "Brazilian",
+	"is", "tastes", "feels", "makes", "needs", "deserves", "beats", "perfect", "underrated", "overrated",
+}
+
+var endings = []string{".", "!", "!!", "?", " ☕", " 😍", "...", ""}
+
+var altTexts = []string{
+	"My morning cup", "Latte art attempt", "The café", "Fresh beans", "Pour over setup", "Abstract art",
+}
@@ -1,28 +1,54 @@
 package api
 
 import (
-	"database/sql"
+	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
+	"io/fs"
+	"log/slog"
 	"net/http"
+	"net/netip"
 	"os"
-
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/Blockitifluy/CoffeeCo/api/database"
 	"github.com/Blockitifluy/CoffeeCo/utility"
-	"github.com/fatih/color"
-	"github.com/gorilla/handlers"
 	"github.com/gorilla/mux"
-	_ "github.com/mattn/go-sqlite3" // Used for a driver by database/sql
 )
 
 // Server contains:
 //
 //   - Server (Gorilla Mux),
-//   - Database (Sqlite)
+//   - Stores (the users, posts and images in SQLite or Postgres, see [Stores]),
+//   - Config (see [Config]),
+//   - Files (the frontend, either on disk or embedded)
 type Server struct {
 	*mux.Router
-	*sql.DB
-
-	Address string
-	Debug   bool
+	Stores
+
+	db          *database.DB // nil when the stores don't use a database
+	stopBackups func()       // Stops the scheduled backups, nil when there aren't any
+	closeOnce   sync.Once
+	closeErr    error
+	stopping    atomic.Bool // Set when the server is shutting down, so it isn't ready
+
+	Config   Config
+	Files    fs.FS    // Where the frontend is read from
+	Notifier Notifier // Tells users about their account (e.g. it's been locked), [LogNotifier] by default
+
+	metrics        *serverMetrics
+	trustedProxies []netip.Prefix // See `TRUSTED_PROXIES` and [Server.ClientIP]
+	logins         *loginGuard    // Failed log ins, see [LoginConfig]
+	certs          *certReloader  // The TLS certificate, nil when TLS isn't used
+	assets         *assetStore    // The cache of `ASSETS_PATH`
+	html           *constantFile  // The `HTML_PATH` file
+	pages          *pageCache     // Rendered pages with meta tags
 }
 
 // RouteTemplate is a server route, not yet loaded by the server
@@ -30,12 +56,11 @@ type RouteTemplate struct {
 	path    string
 	Methods []string
 	Funct   http.HandlerFunc
+	Limit   RateLimit // Not limited by default (or when `RATE_LIMIT` is false)
 }
 
 func (srv *Server) getHTMLRoutes() []string {
 	return []string{
-		"/user/{id}",
-		"/post/{id}",
 		"/add-post",
 		"/sign-up",
 		"/log-in",
@@ -43,6 +68,22 @@ func (srv *Server) getHTMLRoutes() []string {
 	}
 }
 
+// getPageRoutes are HTML routes with meta tags rendered by the server (for link previews)
+func (srv *Server) getPageRoutes() []RouteTemplate {
+	return []RouteTemplate{
+		{
+			path:    "/user/{id}",
+			Methods: []string{"GET"},
+			Funct:   srv.UserPage,
+		},
+		{
+			path:    "/post/{id}",
+			Methods: []string{"GET"},
+			Funct:   srv.PostPage,
+		},
+	}
+}
+
 func (srv *Server) getRouteTemplates() []RouteTemplate {
 	return []RouteTemplate{
 		// USER API
@@ -56,15 +97,27 @@ func (srv *Server) getRouteTemplates() []RouteTemplate {
 			Methods: []string{"GET"},
 			Funct:   srv.APIAuthToID,
 		},
+		{
+			path:    "/api/user/auth-to-id",
+			Methods: []string{"GET"},
+			Funct:   srv.APIAuthToID,
+		},
 		{
 			path:    "/api/user/log-in",
 			Methods: []string{"POST"},
 			Funct:   srv.APILoginUser,
+			Limit:   RateLimit{Requests: 10, Per: time.Minute, By: LimitByIP},
+		},
+		{
+			path:    "/api/user/log-out",
+			Methods: []string{"POST"},
+			Funct:   srv.APILogOutUser,
 		},
 		{
 			path:    "/api/user/add",
 			Methods: []string{"POST"},
 			Funct:   srv.APIAddUser,
+			Limit:   RateLimit{Requests: 5, Per: time.Hour, By: LimitByIP},
 		},
 		{
 			path:    "/api/user/search",
@@ -97,6 +150,7 @@ func (srv *Server) getRouteTemplates() []RouteTemplate {
 			path:    "/api/post/add",
 			Methods: []string{"POST"},
 			Funct:   srv.APIAddPost,
+			Limit:   RateLimit{Requests: 30, Per: time.Minute, Burst: 10, By: LimitByUser},
 		},
 		{
 			path:    "/api/post/get-posts-from-user",
@@ -114,72 +168,204 @@ func (srv *Server) getRouteTemplates() []RouteTemplate {
 			Funct:   srv.APISearchPost,
 		},
 
+		// HEALTH API
+		{
+			path:    "/healthz",
+			Methods: []string{"GET", "HEAD"},
+			Funct:   srv.APIHealth,
+		},
+		{
+			path:    "/readyz",
+			Methods: []string{"GET", "HEAD"},
+			Funct:   srv.APIReady,
+		},
+
 		// Image API
 		{
 			path:    "/api/images/upload",
 			Methods: []string{"POST"},
 			Funct:   srv.APIUploadImage,
+			Limit:   RateLimit{Requests: 20, Per: time.Minute, Burst: 10, By: LimitByUser},
 		},
 		{
 			path:    "/api/images/download/{url}",
-			Methods: []string{"GET"},
+			Methods: []string{"GET", "HEAD"},
 			Funct:   srv.APIDownloadImage,
 		},
 	}
 }
 
-// NewServer creates a server with the database and routes added
-func NewServer(address string, debug bool) *Server {
-	db, err := sql.Open("sqlite3", os.Getenv("DB_PATH"))
+// NewServer creates a server with the database and routes added, migrating the database and scheduling backups.
+//
+// The frontend is read from files, if nil the working directory is used
+func NewServer(cfg Config, files fs.FS) (*Server, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	db, err := OpenDatabase(cfg.DB)
+	if err != nil {
+		return nil, err
+	}
+
+	srv, err := NewServerWithStores(cfg, files, NewSQLStores(db))
 	if err != nil {
-		color.Red("Database could't be initalised: %s", err.Error())
-		os.Exit(1)
+		db.Close()
+		return nil, err
+	}
+	srv.db = db
+	db.Observe = srv.metrics.observeQuery
+
+	if err := srv.Migrate(); err != nil {
+		srv.Close()
+		return nil, err
+	}
+
+	if err := srv.ScheduleBackups(); err != nil {
+		srv.Close()
+		return nil, err
+	}
+
+	return srv, nil
+}
+
+// NewServerWithStores creates a server using stores instead of a database (e.g. [NewMemoryStores]),
+// so the server can be embedded or tested without a database file
+func NewServerWithStores(cfg Config, files fs.FS, stores Stores) (*Server, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	if files == nil {
+		files = utility.DiskFS{}
 	}
 
 	srv := &Server{
-		Router:  mux.NewRouter(),
-		DB:      db,
-		Address: address,
-		Debug:   debug,
+		Router:   mux.NewRouter(),
+		Stores:   stores,
+		Config:   cfg,
+		Files:    files,
+		Notifier: LogNotifier{},
+		logins:   newLoginGuard(cfg.Login),
+	}
+	srv.metrics = newServerMetrics(srv)
+
+	proxies, err := ParseTrustedProxies(cfg.Limits.TrustedProxies)
+	if err != nil {
+		return nil, err
+	}
+	srv.trustedProxies = proxies
+
+	if cfg.TLSEnabled() {
+		certs, err := newCertReloader(cfg.TLS.CertPath, cfg.TLS.KeyPath)
+		if err != nil {
+			return nil, err
+		}
+		srv.certs = certs
+	}
+
+	if cfg.PublicURL == "" {
+		slog.Warn("PUBLIC_URL isn't set, link previews won't have urls or images")
 	}
 
-	srv.InitTable()
+	if cfg.Debug && cfg.Admin.Address == "" && cfg.Admin.MetricsToken == "" {
+		slog.Warn("/debug/ isn't served publicly without METRICS_TOKEN, set it or ADMIN_ADDRESS")
+	}
 
-	srv.Routes()
-	color.Cyan("\nServer Created\nRoutes Created\n\n")
+	if err := srv.Routes(); err != nil {
+		return nil, err
+	}
+	slog.Info("Server created")
 
-	return srv
+	return srv, nil
 }
 
-// InitTable adds tables to the database if the database already has been initated
-func (srv *Server) InitTable() {
-	initRead, initErr := os.ReadFile(os.Getenv("DB_INIT"))
-	read, _ := os.ReadFile(os.Getenv("DB_PATH"))
+// OpenDatabase opens the database (sqlite3 or postgres).
+// SQLite uses the file at `DB_PATH` (creating it's directory if needed), Postgres connects to `DB_URL`
+func OpenDatabase(cfg DatabaseConfig) (*database.DB, error) {
+	source := cfg.URL
+	if cfg.Driver == database.SQLite {
+		source = cfg.Path
+		if err := os.MkdirAll(filepath.Dir(source), 0o755); err != nil {
+			return nil, fmt.Errorf("database directory couldn't be created: %w", err)
+		}
+	}
+
+	db, err := database.Open(cfg.Driver, source)
+	if err != nil {
+		return nil, fmt.Errorf("database couldn't be initalised: %w", err)
+	}
+
+	return db, nil
+}
+
+// Migrate applies the database migrations that haven't been applied yet
+func (srv *Server) Migrate() error {
+	applied, err := database.Up(srv.db)
+	for _, migration := range applied {
+		slog.Info("Applied migration", "version", migration.Version, "name", migration.Name)
+	}
 
-	if initErr != nil {
-		color.Red("Database couldn't be read: %s", initErr.Error())
-		os.Exit(1)
-	} else if len(read) != 0 { // Hasn't been inited
-		color.Green("Database has already been initialised\n\n")
-		return
+	if err != nil {
+		return fmt.Errorf("database couldn't be migrated: %w", err)
 	}
 
-	color.Green("Computing Database...\n")
+	slog.Info("Database is up to date")
+	return nil
+}
+
+// ScheduleBackups takes a backup of the database every `BACKUP_INTERVAL` (e.g. 24h) into `BACKUP_DIR`,
+// keeping the newest `BACKUP_KEEP` backups. Nothing happens if `BACKUP_INTERVAL` isn't set
+func (srv *Server) ScheduleBackups() error {
+	cfg := srv.Config.Backup
+	if cfg.Interval == 0 || srv.db == nil {
+		return nil
+	}
 
-	if _, err := srv.Exec(string(initRead)); err != nil {
-		color.Red(err.Error())
+	if srv.db.Dialect != database.SQLite {
+		slog.Warn("Scheduled backups are skipped", "error", database.ErrBackupUnsupported)
+		return nil
+	}
 
-		os.Exit(1)
+	schedule := database.BackupSchedule{
+		Dir:      cfg.Dir,
+		Interval: cfg.Interval,
+		Keep:     cfg.Keep,
 	}
 
-	fmt.Printf("Success!\n\n")
+	srv.stopBackups = srv.db.ScheduleBackups(schedule, func(path string, err error) {
+		if err != nil {
+			slog.Error("Backup failed", "path", path, "error", err)
+			return
+		}
+
+		slog.Info("Backed up the database", "path", path)
+	})
+
+	slog.Info("Scheduled backups", "interval", schedule.Interval, "dir", schedule.Dir)
+	return nil
+}
+
+// Close stops the scheduled backups and closes the database, only the first call closes the server
+func (srv *Server) Close() error {
+	srv.closeOnce.Do(func() {
+		if srv.stopBackups != nil {
+			srv.stopBackups()
+		}
+
+		if srv.db != nil {
+			srv.closeErr = srv.db.Close()
+		}
+	})
+
+	return srv.closeErr
 }
 
 func (srv *Server) notFound() http.HandlerFunc {
 	NotFoundError := utility.HTTPError{
 		Public:  "Method Couldn't Be Found",
 		Message: "Page/Method not found",
-		Code:    404,
+		Status:  404,
 	}
 
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -191,7 +377,7 @@ func (srv *Server) methodNotAllowed() http.HandlerFunc {
 	MethodNotAllowedError := utility.HTTPError{
 		Public:  "Method was incorrect",
 		Message: "Illegal method for route",
-		Code:    405,
+		Status:  405,
 	}
 
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -200,42 +386,179 @@ func (srv *Server) methodNotAllowed() http.HandlerFunc {
 }
 
 // Routes method adds routes to the server (Self explainitary)
-func (srv *Server) Routes() {
+func (srv *Server) Routes() error {
 	var Routes []RouteTemplate = srv.getRouteTemplates()
 
 	srv.NotFoundHandler = srv.notFound()
-	color.Cyan("NotFound Method loaded")
+	slog.Debug("NotFound Method loaded")
 
 	srv.MethodNotAllowedHandler = srv.methodNotAllowed()
-	color.Cyan("IllegalMethod Method loaded")
+	slog.Debug("IllegalMethod Method loaded")
+
+	srv.Use(routeMiddleware)
+
+	if srv.Config.Admin.MetricsToken != "" && srv.Config.Admin.Address == "" {
+		srv.Handle("/metrics", srv.metricsHandler()).Methods("GET")
+	}
+
+	// The profiler and the config are never public, they're on the admin listener or require the token
+	if srv.Config.Debug && srv.Config.Admin.MetricsToken != "" && srv.Config.Admin.Address == "" {
+		srv.PathPrefix("/debug/").Handler(srv.debugHandler())
+	}
 
 	for _, rout := range Routes {
-		handle := srv.HandleFunc(rout.path, rout.Funct).
+		var handler http.Handler = rout.Funct
+		if rout.Limit.Requests > 0 && srv.Config.Limits.Enabled {
+			handler = srv.rateLimit(rout.Limit, handler)
+		}
+
+		handle := srv.Handle(rout.path, handler).
 			Methods(rout.Methods...)
 
 		if err := handle.GetError(); err != nil {
-			color.Red("Couldn't load route %s: %s", rout.path, err.Error())
-			os.Exit(1)
+			return fmt.Errorf("couldn't load route %s: %w", rout.path, err)
 		}
 
-		if srv.Debug {
+		if srv.Config.Debug {
 			fmt.Printf("> %s\n", rout.path)
 		}
 	}
 
-	srv.LoadAssets()
+	return srv.LoadAssets()
 }
 
-// Run runs the server
-func (srv *Server) Run() {
-	fmt.Printf("Hosting on port %s\nPress Ctrl + C to stop server\n\n", srv.Address)
+// Handler is the server with it's middleware (request IDs and logging, compression, CORS and CSRF protection,
+// HSTS when TLS is used and recovering panics)
+func (srv *Server) Handler() http.Handler {
+	CompressMiddleware := utility.CompressHandler(recoverMiddleware(srv), srv.metrics.observeCompression)
+	handler := srv.corsMiddleware(srv.crossOriginMiddleware(CompressMiddleware))
 
-	CorsMiddleware := handlers.CORS()(srv)
+	if srv.Config.TLSEnabled() && srv.Config.TLS.HSTSMaxAge > 0 {
+		handler = srv.hstsMiddleware(handler)
+	}
 
-	err := http.ListenAndServe(srv.Address, CorsMiddleware)
+	return srv.requestMiddleware(handler)
+}
 
-	if err != nil {
-		color.Red(err.Error())
-		os.Exit(1)
+// HTTPServer creates the http server, with the timeouts and header limit in the config.
+// When TLS is used, the server has the TLS config (with HTTP/2)
+func (srv *Server) HTTPServer() *http.Server {
+	cfg := srv.Config.HTTP
+
+	var tlsConfig *tls.Config
+	if srv.certs != nil {
+		tlsConfig = srv.tlsConfig()
+	}
+
+	return &http.Server{
+		TLSConfig:         tlsConfig,
+		Addr:              srv.Config.Address,
+		Handler:           srv.Handler(),
+		ReadTimeout:       cfg.ReadTimeout,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+		MaxHeaderBytes:    cfg.MaxHeaderBytes,
+	}
+}
+
+// Run runs the server until it's interrupted (Ctrl + C) or terminated, then shuts it down (see [Server.Serve])
+func (srv *Server) Run() error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	return srv.Serve(ctx)
+}
+
+// Serve runs the server until ctx is done, then shuts it down:
+// new connections are refused, in-flight requests have `SHUTDOWN_TIMEOUT` to finish (then they're closed),
+// the scheduled backups are stopped and the database is closed.
+//
+// When TLS is used, the server is served over https and http requests to `HTTP_REDIRECT_ADDRESS` are redirected.
+//
+// If the server fails (e.g. the port is used), it's closed and the error is returned
+func (srv *Server) Serve(ctx context.Context) error {
+	httpServer := srv.HTTPServer()
+	servers := []*http.Server{httpServer}
+
+	failed := make(chan error, 3)
+	go func() {
+		if srv.certs != nil {
+			failed <- httpServer.ListenAndServeTLS("", "") // The certificate is from TLSConfig
+			return
+		}
+
+		failed <- httpServer.ListenAndServe()
+	}()
+
+	slog.Info("Hosting, press Ctrl + C to stop server", "address", srv.Config.Address, "https", srv.certs != nil)
+
+	if srv.certs != nil && srv.Config.TLS.RedirectAddress != "" {
+		redirectServer := srv.redirectServer()
+		servers = append(servers, redirectServer)
+
+		go func() {
+			failed <- redirectServer.ListenAndServe()
+		}()
+
+		slog.Info("Redirecting http to https", "address", redirectServer.Addr)
+	}
+
+	if srv.Config.Admin.Address != "" {
+		adminServer := srv.adminServer()
+		servers = append(servers, adminServer)
+
+		go func() {
+			failed <- adminServer.ListenAndServe()
+		}()
+
+		slog.Info("Serving metrics and debug endpoints", "address", adminServer.Addr)
 	}
+
+	select {
+	case err := <-failed:
+		for _, server := range servers {
+			server.Close()
+		}
+
+		return errors.Join(err, srv.Close())
+	case <-ctx.Done():
+	}
+
+	srv.stopping.Store(true)
+
+	timeout := srv.Config.HTTP.ShutdownTimeout
+	slog.Info("Shutting down, waiting for requests to finish", "timeout", timeout)
+
+	shutdownCtx, cancel := context.Background(), func() {}
+	if timeout > 0 {
+		shutdownCtx, cancel = context.WithTimeout(shutdownCtx, timeout)
+	}
+	defer cancel()
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(servers))
+	for i, server := range servers {
+		wg.Add(1)
+		go func(i int, server *http.Server) {
+			defer wg.Done()
+			errs[i] = server.Shutdown(shutdownCtx)
+		}(i, server)
+	}
+	wg.Wait()
+
+	err := errors.Join(errs...)
+	if errors.Is(err, context.DeadlineExceeded) {
+		for _, server := range servers {
+			server.Close()
+		}
+		err = fmt.Errorf("requests didn't finish within %s, they were closed", timeout)
+	}
+
+	if err := errors.Join(err, srv.Close()); err != nil {
+		return err
+	}
+
+	slog.Info("Server stopped")
+	return nil
 }
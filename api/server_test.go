@@ -0,0 +1,141 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"testing/fstest"
+
+	"github.com/Blockitifluy/CoffeeCo/utility"
+)
+
+func TestMain(m *testing.M) {
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil))) // The server logs every request
+	os.Exit(m.Run())
+}
+
+// testFiles is a built frontend, so servers can be created without running Vite
+var testFiles = fstest.MapFS{
+	"dist/index.html":             {Data: []byte("<html><head><title>CoffeeCo</title></head><body></body></html>")},
+	"dist/manifest.json":          {Data: []byte(`{"index.html": {"file": "assets/index-abc123.js"}}`)},
+	"dist/assets/index-abc123.js": {Data: []byte("console.log('CoffeeCo')")},
+	"manifest.json":               {Data: []byte(`{"name": "CoffeeCo"}`)},
+}
+
+// testConfig is the config of test servers, without rate limits (tests send many requests from one IP)
+func testConfig() Config {
+	cfg := DefaultConfig()
+	cfg.Log.Access = false
+	cfg.PublicURL = "https://coffeeco.example" // Link previews have urls
+	cfg.Limits.Enabled = false
+	return cfg
+}
+
+// newTestServer creates a server using memory stores (see [NewMemoryStores]), returning it's handler with every middleware
+func newTestServer(t *testing.T, cfg Config) (*Server, http.Handler) {
+	t.Helper()
+
+	srv, err := NewServerWithStores(cfg, testFiles, NewMemoryStores())
+	if err != nil {
+		t.Fatalf("couldn't create the server: %v", err)
+	}
+
+	return srv, srv.Handler()
+}
+
+// request sends a request to the handler. body is sent as is when it's []byte, otherwise as JSON (nil has no body)
+func request(t *testing.T, handler http.Handler, method, target string, body any, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+	t.Helper()
+
+	var reader io.Reader
+	switch body := body.(type) {
+	case nil:
+	case []byte:
+		reader = bytes.NewReader(body)
+	default:
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			t.Fatalf("couldn't encode the body: %v", err)
+		}
+		reader = bytes.NewReader(encoded)
+	}
+
+	r := httptest.NewRequest(method, target, reader)
+	for _, cookie := range cookies {
+		r.AddCookie(cookie)
+	}
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	return w
+}
+
+// decodeData decodes the data of a successful response (see [utility.Send]), failing if the status isn't status
+func decodeData[t any](test *testing.T, w *httptest.ResponseRecorder, status int) t {
+	test.Helper()
+
+	if w.Code != status {
+		test.Fatalf("status is %d, expected %d: %s", w.Code, status, w.Body.String())
+	}
+
+	var res struct {
+		Data t `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+		test.Fatalf("couldn't decode the response: %v: %s", err, w.Body.String())
+	}
+
+	return res.Data
+}
+
+// expectError checks a response is an error (see [utility.Error]) with the status, code and a public message,
+// returning the error
+func expectError(t *testing.T, w *httptest.ResponseRecorder, status int, code string) utility.HTTPError {
+	t.Helper()
+
+	var sent utility.HTTPError
+	if err := json.Unmarshal(w.Body.Bytes(), &sent); err != nil {
+		t.Fatalf("couldn't decode the error: %v: %s", err, w.Body.String())
+	}
+
+	if w.Code != status || sent.Code != code || sent.Public == "" {
+		t.Fatalf("got %d %q, expected %d %q: %s", w.Code, sent.Code, status, code, w.Body.String())
+	}
+
+	return sent
+}
+
+// findCookie gets a cookie set by a response
+func findCookie(w *httptest.ResponseRecorder, name string) *http.Cookie {
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.Name == name {
+			return cookie
+		}
+	}
+
+	return nil
+}
+
+// signUp adds a user and logs in, returning the user's ID and `AuthToken` cookie
+func signUp(t *testing.T, handler http.Handler, handle string) (int, *http.Cookie) {
+	t.Helper()
+
+	user := map[string]string{"handle": handle, "username": handle, "password": handle + "-password"}
+	added := decodeData[map[string]int](t, request(t, handler, "POST", "/api/user/add", user), http.StatusCreated)
+
+	login := map[string]string{"handle": handle, "password": handle + "-password"}
+	w := request(t, handler, "POST", "/api/user/log-in", login)
+	decodeData[map[string]int](t, w, http.StatusOK)
+
+	cookie := findCookie(w, authCookieName)
+	if cookie == nil {
+		t.Fatal("logging in didn't set the auth cookie")
+	}
+
+	return added["ID"], cookie
+}
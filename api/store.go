@@ -0,0 +1,80 @@
+package api
+
+// The stores separate the database from the handlers, handlers should only use these interfaces.
+//
+// Methods getting a single item return [database/sql.ErrNoRows] when it doesn't exist
+// (so [utility.SendScanErr] sends a 404), methods getting a list return an empty list instead.
+
+// UserStore stores the users
+type UserStore interface {
+	// Get gets the public information of a user
+	Get(ID int) (PublicUser, error)
+	// User gets all the information of a user
+	User(ID int) (User, error)
+	// ByHandle gets all the information of the user with the handle
+	ByHandle(handle string) (User, error)
+	// IDFromAuth gets the ID of the user with the authorisation token, banned users aren't found
+	IDFromAuth(auth string) (int, error)
+	// Add adds a user (the ID is ignored) and returns it's ID
+	Add(user User) (int, error)
+	// Search gets users with a handle or username containing name (case insensitive), in order of ID
+	Search(name string, from, amount int) ([]PublicUser, error)
+	// Follow makes followerID follow the user, returns [database/sql.ErrNoRows]
+	// when the user doesn't exist or is already followed by followerID
+	Follow(ID, followerID int) error
+	// SetBanned bans or unbans a user
+	SetBanned(ID int, banned bool) error
+	// SetPassword changes the hashed password and authorisation token of a user
+	SetPassword(ID int, password []byte, auth string) error
+	// List gets every user in order of ID (used by exports)
+	List(from, amount int) ([]User, error)
+	// Import adds a user keeping every field, including it's ID (used by imports)
+	Import(user User) error
+}
+
+// PostStore stores the posts and comments
+type PostStore interface {
+	// Get gets a post or comment
+	Get(ID int) (PostDB, error)
+	// Add adds a post and returns it's ID
+	Add(post AddPostRequest) (int, error)
+	// Random gets a random post (not a comment), from any user when postedBy is 0
+	Random(postedBy int) (PostDB, error)
+	// Comments gets the comments of a post, oldest first
+	Comments(parentID, from, amount int) ([]PostDB, error)
+	// ByUser gets the posts (not comments) of a user, newest first
+	ByUser(postedBy, from, amount int) ([]PostDB, error)
+	// Search gets posts (not comments) containing content (case insensitive), newest first
+	Search(content string, from, amount int) ([]PostDB, error)
+	// React likes (or dislikes) a post or comment, returns [database/sql.ErrNoRows]
+	// when it doesn't exist or userID has already reacted the same way
+	React(ID, userID int, like bool) error
+	// List gets every post and comment in order of ID (used by exports)
+	List(from, amount int) ([]PostDB, error)
+	// Import adds a post keeping every field, including it's ID (used by imports).
+	// A comment's parent must be imported first
+	Import(post PostDB) error
+}
+
+// ImageStore stores the uploaded images
+type ImageStore interface {
+	// Get gets an image
+	Get(ID string) (ImageData, error)
+	// Meta gets the ImageMeta of multiple images, images that don't exist are left out
+	Meta(IDs []string) (map[string]ImageMeta, error)
+	// ETag gets the ETag of an image (without it's content), empty for images uploaded before ETags were stored
+	ETag(ID string) (string, error)
+	// SetETag stores the ETag of an image
+	SetETag(ID, eTag string) error
+	// Add adds an image, meta.URL is ignored
+	Add(image ImageData, meta ImageMeta) error
+	// List gets every image in order of URL (used by exports)
+	List(from, amount int) ([]ImageData, error)
+}
+
+// Stores contains every store used by the server
+type Stores struct {
+	Users  UserStore
+	Posts  PostStore
+	Images ImageStore
+}
@@ -0,0 +1,492 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"math/rand"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// NewMemoryStores creates stores kept in memory, nothing is saved.
+// Used to run the handlers without a database file (e.g. in tests)
+func NewMemoryStores() Stores {
+	return Stores{
+		Users:  &memoryUserStore{users: map[int]User{}},
+		Posts:  &memoryPostStore{posts: map[int]PostDB{}},
+		Images: &memoryImageStore{images: map[string]memoryImage{}},
+	}
+}
+
+// page gets a page (offset by from, limited by amount) of a list
+func page[t any](items []t, from, amount int) []t {
+	if from < 0 || from >= len(items) || amount <= 0 {
+		return []t{}
+	}
+
+	end := min(from+amount, len(items))
+	return items[from:end]
+}
+
+func containsFold(s, substr string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
+}
+
+type memoryUserStore struct {
+	mu     sync.RWMutex
+	users  map[int]User
+	lastID int
+}
+
+func (store *memoryUserStore) Get(ID int) (PublicUser, error) {
+	u, err := store.User(ID)
+	if err != nil {
+		return PublicUser{}, err
+	}
+
+	return *u.PublicUser, nil
+}
+
+func (store *memoryUserStore) User(ID int) (User, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	u, ok := store.users[ID]
+	if !ok {
+		return User{}, sql.ErrNoRows
+	}
+
+	public := *u.PublicUser // Copied, so the stored user can't be modified
+	u.PublicUser = &public
+
+	return u, nil
+}
+
+func (store *memoryUserStore) ByHandle(handle string) (User, error) {
+	store.mu.RLock()
+	var (
+		ID    int
+		found bool
+	)
+	for _, u := range store.users {
+		if u.Handle == handle {
+			ID, found = u.ID, true
+			break
+		}
+	}
+	store.mu.RUnlock()
+
+	if !found {
+		return User{}, sql.ErrNoRows
+	}
+
+	return store.User(ID)
+}
+
+func (store *memoryUserStore) IDFromAuth(auth string) (int, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	for ID, u := range store.users {
+		if u.Auth == auth && !u.Banned {
+			return ID, nil
+		}
+	}
+
+	return 0, sql.ErrNoRows
+}
+
+func (store *memoryUserStore) Add(user User) (int, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if user.PublicUser == nil {
+		return 0, errors.New("user has no public information")
+	}
+
+	for _, u := range store.users {
+		if u.Handle == user.Handle {
+			return 0, errors.New("handle is already used")
+		}
+	}
+
+	store.lastID++
+
+	public := *user.PublicUser
+	public.ID = store.lastID
+	user.PublicUser = &public
+	user.TimeCreated = time.Now()
+	user.Banned = false
+
+	store.users[public.ID] = user
+	return public.ID, nil
+}
+
+func (store *memoryUserStore) Search(name string, from, amount int) ([]PublicUser, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	var Users []PublicUser
+	for _, u := range store.users {
+		if containsFold(u.Handle, name) || containsFold(u.Username, name) {
+			Users = append(Users, *u.PublicUser)
+		}
+	}
+
+	sort.Slice(Users, func(i, j int) bool {
+		return Users[i].ID < Users[j].ID
+	})
+
+	return page(Users, from, amount), nil
+}
+
+// update changes a user, returns [sql.ErrNoRows] when it doesn't exist
+func (store *memoryUserStore) update(ID int, change func(u *User)) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	u, ok := store.users[ID]
+	if !ok {
+		return sql.ErrNoRows
+	}
+
+	change(&u)
+	store.users[ID] = u
+
+	return nil
+}
+
+// addToIDList adds an ID to a comma separated list of IDs (e.g. whoLiked), false if it's already in the list
+func addToIDList(list *string, ID int) bool {
+	item := strconv.Itoa(ID)
+	if slices.Contains(strings.Split(*list, ","), item) {
+		return false
+	}
+
+	if *list == "" {
+		*list = item
+	} else {
+		*list += "," + item
+	}
+
+	return true
+}
+
+func (store *memoryUserStore) Follow(ID, followerID int) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	u, ok := store.users[ID]
+	if !ok {
+		return sql.ErrNoRows
+	}
+
+	public := *u.PublicUser
+	if !addToIDList(&public.WhoFollowed, followerID) {
+		return sql.ErrNoRows
+	}
+
+	public.Followers++
+	u.PublicUser = &public
+	store.users[ID] = u
+
+	return nil
+}
+
+func (store *memoryUserStore) SetBanned(ID int, banned bool) error {
+	return store.update(ID, func(u *User) {
+		u.Banned = banned
+	})
+}
+
+func (store *memoryUserStore) SetPassword(ID int, password []byte, auth string) error {
+	return store.update(ID, func(u *User) {
+		u.password, u.Auth = password, auth
+	})
+}
+
+func (store *memoryUserStore) List(from, amount int) ([]User, error) {
+	store.mu.RLock()
+	IDs := make([]int, 0, len(store.users))
+	for ID := range store.users {
+		IDs = append(IDs, ID)
+	}
+	store.mu.RUnlock()
+
+	sort.Ints(IDs)
+
+	var Users []User
+	for _, ID := range page(IDs, from, amount) {
+		if u, err := store.User(ID); err == nil {
+			Users = append(Users, u)
+		}
+	}
+
+	if Users == nil {
+		return []User{}, nil
+	}
+
+	return Users, nil
+}
+
+func (store *memoryUserStore) Import(user User) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if user.PublicUser == nil {
+		return errors.New("user has no public information")
+	}
+
+	for _, u := range store.users {
+		if u.ID == user.ID || u.Handle == user.Handle {
+			return errors.New("user already exists")
+		}
+	}
+
+	public := *user.PublicUser
+	user.PublicUser = &public
+
+	store.users[public.ID] = user
+	store.lastID = max(store.lastID, public.ID)
+
+	return nil
+}
+
+type memoryPostStore struct {
+	mu     sync.RWMutex
+	posts  map[int]PostDB
+	lastID int
+}
+
+// filter gets the posts matching keep, sorted by ID
+func (store *memoryPostStore) filter(keep func(pst PostDB) bool, newestFirst bool) []PostDB {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	var Posts []PostDB
+	for _, pst := range store.posts {
+		if keep(pst) {
+			Posts = append(Posts, pst)
+		}
+	}
+
+	sort.Slice(Posts, func(i, j int) bool {
+		if newestFirst {
+			return Posts[i].ID > Posts[j].ID
+		}
+		return Posts[i].ID < Posts[j].ID
+	})
+
+	return Posts
+}
+
+func (store *memoryPostStore) Get(ID int) (PostDB, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	pst, ok := store.posts[ID]
+	if !ok {
+		return PostDB{}, sql.ErrNoRows
+	}
+
+	return pst, nil
+}
+
+func (store *memoryPostStore) Add(post AddPostRequest) (int, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	store.lastID++
+	store.posts[store.lastID] = PostDB{
+		ID:          store.lastID,
+		PostedBy:    post.PostedBy,
+		Content:     post.Content,
+		TimeCreated: time.Now(),
+		ParentID:    post.ParentID,
+		Images:      post.Images,
+	}
+
+	return store.lastID, nil
+}
+
+func (store *memoryPostStore) Random(postedBy int) (PostDB, error) {
+	Posts := store.filter(func(pst PostDB) bool {
+		return pst.ParentID == -1 && (postedBy == 0 || pst.PostedBy == postedBy)
+	}, false)
+
+	if len(Posts) == 0 {
+		return PostDB{}, sql.ErrNoRows
+	}
+
+	return Posts[rand.Intn(len(Posts))], nil
+}
+
+func (store *memoryPostStore) Comments(parentID, from, amount int) ([]PostDB, error) {
+	Posts := store.filter(func(pst PostDB) bool {
+		return pst.ParentID == parentID
+	}, false)
+
+	return page(Posts, from, amount), nil
+}
+
+func (store *memoryPostStore) ByUser(postedBy, from, amount int) ([]PostDB, error) {
+	Posts := store.filter(func(pst PostDB) bool {
+		return pst.ParentID == -1 && pst.PostedBy == postedBy
+	}, true)
+
+	return page(Posts, from, amount), nil
+}
+
+func (store *memoryPostStore) Search(content string, from, amount int) ([]PostDB, error) {
+	Posts := store.filter(func(pst PostDB) bool {
+		return pst.ParentID == -1 && containsFold(pst.Content, content)
+	}, true)
+
+	return page(Posts, from, amount), nil
+}
+
+func (store *memoryPostStore) React(ID, userID int, like bool) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	pst, ok := store.posts[ID]
+	if !ok {
+		return sql.ErrNoRows
+	}
+
+	list, count := &pst.WhoDisliked, &pst.Dislikes
+	if like {
+		list, count = &pst.WhoLiked, &pst.Likes
+	}
+
+	if !addToIDList(list, userID) {
+		return sql.ErrNoRows
+	}
+
+	*count++
+	store.posts[ID] = pst
+
+	return nil
+}
+
+func (store *memoryPostStore) List(from, amount int) ([]PostDB, error) {
+	Posts := store.filter(func(pst PostDB) bool {
+		return true
+	}, false)
+
+	return page(Posts, from, amount), nil
+}
+
+func (store *memoryPostStore) Import(post PostDB) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if _, exists := store.posts[post.ID]; exists {
+		return errors.New("post already exists")
+	}
+
+	if _, exists := store.posts[post.ParentID]; post.ParentID != -1 && !exists {
+		return errors.New("the post's parent doesn't exist")
+	}
+
+	store.posts[post.ID] = post
+	store.lastID = max(store.lastID, post.ID)
+
+	return nil
+}
+
+type memoryImage struct {
+	data ImageData
+	meta ImageMeta
+}
+
+type memoryImageStore struct {
+	mu     sync.RWMutex
+	images map[string]memoryImage
+}
+
+func (store *memoryImageStore) Get(ID string) (ImageData, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	image, ok := store.images[ID]
+	if !ok {
+		return ImageData{}, sql.ErrNoRows
+	}
+
+	return image.data, nil
+}
+
+func (store *memoryImageStore) ETag(ID string) (string, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	image, ok := store.images[ID]
+	if !ok {
+		return "", sql.ErrNoRows
+	}
+
+	return image.data.ETag, nil
+}
+
+func (store *memoryImageStore) SetETag(ID, eTag string) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	image, ok := store.images[ID]
+	if !ok {
+		return sql.ErrNoRows
+	}
+
+	image.data.ETag = eTag
+	store.images[ID] = image
+	return nil
+}
+
+func (store *memoryImageStore) Meta(IDs []string) (map[string]ImageMeta, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	metas := map[string]ImageMeta{}
+	for _, ID := range IDs {
+		if image, ok := store.images[ID]; ok {
+			metas[ID] = image.meta
+		}
+	}
+
+	return metas, nil
+}
+
+func (store *memoryImageStore) Add(image ImageData, meta ImageMeta) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if _, exists := store.images[image.URL]; exists {
+		return errors.New("image already exists")
+	}
+
+	meta.URL = image.URL
+	store.images[image.URL] = memoryImage{data: image, meta: meta}
+
+	return nil
+}
+
+func (store *memoryImageStore) List(from, amount int) ([]ImageData, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	Images := make([]ImageData, 0, len(store.images))
+	for _, image := range store.images {
+		Images = append(Images, image.data)
+	}
+
+	sort.Slice(Images, func(i, j int) bool {
+		return Images[i].URL < Images[j].URL
+	})
+
+	return page(Images, from, amount), nil
+}
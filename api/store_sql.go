@@ -0,0 +1,433 @@
+package api
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Blockitifluy/CoffeeCo/api/database"
+	"github.com/blockloop/scan"
+)
+
+// NewSQLStores creates the stores using a database (SQLite or Postgres)
+func NewSQLStores(db *database.DB) Stores {
+	return Stores{
+		Users:  &sqlUserStore{db: db},
+		Posts:  &sqlPostStore{db: db},
+		Images: &sqlImageStore{db: db},
+	}
+}
+
+// The columns are aliased, because Postgres changes unquoted names to lowercase.
+//
+// Posts (not comments) have a NULL parentID in the database, but -1 in [PostDB]
+const (
+	userColumns = `id AS "ID", username, handle, bio, Followers AS "followers", whoFollowed AS "whoFollowed", banner, profile`
+	// userFullColumns are scanned by hand (in order), see [sqlUserStore.queryUsers]
+	userFullColumns = `id, username, handle, bio, Followers, whoFollowed, banner, profile, password, email, auth, timeCreated, banned`
+	postColumns     = `id AS "ID", PostedBy AS "postedBy", content, timeCreated AS "timeCreated", COALESCE(parentID, -1) AS "parentID",
+	whoLiked AS "whoLiked", whoDisliked AS "whoDisliked", likes, dislikes, images`
+)
+
+// scanRow queries a single row into v using a prepared statement,
+// returns [sql.ErrNoRows] when there are no rows
+func scanRow(db *database.DB, v any, query string, args ...any) error {
+	rows, err := db.QueryPrepared(query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	return scan.Row(v, rows)
+}
+
+// scanRows queries rows into v (a pointer to a slice) using a prepared statement
+func scanRows(db *database.DB, v any, query string, args ...any) error {
+	rows, err := db.QueryPrepared(query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	return scan.Rows(v, rows)
+}
+
+// likeContains formats text to be used with LIKE, matching anything containing text
+func likeContains(text string) string {
+	return fmt.Sprintf("%%%s%%", text)
+}
+
+type sqlUserStore struct {
+	db *database.DB
+}
+
+func (store *sqlUserStore) Get(ID int) (PublicUser, error) {
+	var u PublicUser
+	err := scanRow(store.db, &u, "SELECT "+userColumns+" FROM Users WHERE id = ?", ID)
+	return u, err
+}
+
+// queryUsers queries users with every column (selected using userFullColumns) using a prepared statement.
+// [User] is scanned by hand, because the password isn't exported
+func (store *sqlUserStore) queryUsers(query string, args ...any) ([]User, error) {
+	rows, err := store.db.QueryPrepared(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	Users := []User{}
+	for rows.Next() {
+		u := User{PublicUser: &PublicUser{}}
+
+		var email sql.NullString
+		err := rows.Scan(
+			&u.ID, &u.Username, &u.Handle, &u.Bio, &u.Followers, &u.WhoFollowed, &u.Banner, &u.Profile,
+			&u.password, &email, &u.Auth, &u.TimeCreated, &u.Banned,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		u.Email = email.String
+		Users = append(Users, u)
+	}
+
+	return Users, rows.Err()
+}
+
+// queryUser queries a single user, returns [sql.ErrNoRows] when there are no rows
+func (store *sqlUserStore) queryUser(query string, args ...any) (User, error) {
+	Users, err := store.queryUsers(query, args...)
+	if err != nil {
+		return User{}, err
+	}
+
+	if len(Users) == 0 {
+		return User{}, sql.ErrNoRows
+	}
+
+	return Users[0], nil
+}
+
+func (store *sqlUserStore) User(ID int) (User, error) {
+	return store.queryUser("SELECT "+userFullColumns+" FROM Users WHERE id = ?", ID)
+}
+
+func (store *sqlUserStore) ByHandle(handle string) (User, error) {
+	return store.queryUser("SELECT "+userFullColumns+" FROM Users WHERE handle = ?", handle)
+}
+
+func (store *sqlUserStore) IDFromAuth(auth string) (int, error) {
+	var ID int
+	err := scanRow(store.db, &ID, "SELECT id FROM Users WHERE auth = ? AND NOT banned", auth)
+	return ID, err
+}
+
+func (store *sqlUserStore) Add(user User) (int, error) {
+	const Query = `
+	INSERT INTO Users (username, handle, password, email, timeCreated, auth)
+	VALUES (?, ?, ?, ?, ?, ?)
+	RETURNING id
+	`
+
+	var ID int
+	err := store.db.QueryRow(Query, user.Username, user.Handle, user.password, user.Email, time.Now(), user.Auth).Scan(&ID)
+	return ID, err
+}
+
+func (store *sqlUserStore) Search(name string, from, amount int) ([]PublicUser, error) {
+	const Query = `
+	SELECT ` + userColumns + ` FROM Users
+	WHERE lower(handle) LIKE lower(?) OR
+	lower(username) LIKE lower(?)
+	ORDER BY id ASC
+	LIMIT ? OFFSET ?
+	`
+
+	Users := []PublicUser{}
+	err := scanRows(store.db, &Users, Query, likeContains(name), likeContains(name), amount, from)
+	return Users, err
+}
+
+// execOne executes a query changing a single row, returns [sql.ErrNoRows] when no rows were changed
+func execOne(db *database.DB, query string, args ...any) error {
+	res, err := db.Exec(query, args...)
+	if err != nil {
+		return err
+	}
+
+	changed, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if changed == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// resetSequence sets the next ID of a Postgres table after the largest ID,
+// needed after inserting rows with their ID. SQLite doesn't need this
+func resetSequence(db *database.DB, table string) error {
+	if db.Dialect != database.Postgres {
+		return nil
+	}
+
+	query := fmt.Sprintf(
+		"SELECT setval(pg_get_serial_sequence('%[1]s', 'id'), (SELECT MAX(id) FROM %[1]s))",
+		strings.ToLower(table),
+	)
+
+	_, err := db.Exec(query)
+	return err
+}
+
+// sqlAddToList is a SET clause adding an ID to a comma separated list of IDs (e.g. whoLiked),
+// used with sqlNotInList. The arguments are the ID twice (as a string)
+func sqlAddToList(column string) string {
+	return fmt.Sprintf("%[1]s = CASE WHEN %[1]s = '' THEN ? ELSE %[1]s || ',' || ? END", column)
+}
+
+// sqlNotInList is a WHERE clause checking an ID isn't in a comma separated list of IDs,
+// the argument is the ID formatted by listPattern
+func sqlNotInList(column string) string {
+	return fmt.Sprintf("',' || %s || ',' NOT LIKE ?", column)
+}
+
+// listPattern matches an ID in a comma separated list of IDs, see sqlNotInList
+func listPattern(ID string) string {
+	return "%," + ID + ",%"
+}
+
+func (store *sqlUserStore) Follow(ID, followerID int) error {
+	query := `
+	UPDATE Users SET Followers = Followers + 1, ` + sqlAddToList("whoFollowed") + `
+	WHERE id = ? AND ` + sqlNotInList("whoFollowed")
+
+	follower := strconv.Itoa(followerID)
+	return execOne(store.db, query, follower, follower, ID, listPattern(follower))
+}
+
+func (store *sqlUserStore) SetBanned(ID int, banned bool) error {
+	return execOne(store.db, "UPDATE Users SET banned = ? WHERE id = ?", banned, ID)
+}
+
+func (store *sqlUserStore) SetPassword(ID int, password []byte, auth string) error {
+	return execOne(store.db, "UPDATE Users SET password = ?, auth = ? WHERE id = ?", password, auth, ID)
+}
+
+func (store *sqlUserStore) List(from, amount int) ([]User, error) {
+	return store.queryUsers("SELECT "+userFullColumns+" FROM Users ORDER BY id LIMIT ? OFFSET ?", amount, from)
+}
+
+func (store *sqlUserStore) Import(user User) error {
+	const Query = `
+	INSERT INTO Users (id, username, handle, bio, Followers, whoFollowed, banner, profile, password, email, auth, timeCreated, banned)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+
+	_, err := store.db.Exec(Query,
+		user.ID, user.Username, user.Handle, user.Bio, user.Followers, user.WhoFollowed, user.Banner, user.Profile,
+		user.password, user.Email, user.Auth, user.TimeCreated, user.Banned,
+	)
+	if err != nil {
+		return err
+	}
+
+	return resetSequence(store.db, "Users")
+}
+
+type sqlPostStore struct {
+	db *database.DB
+}
+
+// queryPosts queries a list of posts using a prepared statement
+func (store *sqlPostStore) queryPosts(query string, args ...any) ([]PostDB, error) {
+	Posts := []PostDB{}
+	err := scanRows(store.db, &Posts, query, args...)
+	return Posts, err
+}
+
+func (store *sqlPostStore) Get(ID int) (PostDB, error) {
+	var pst PostDB
+	err := scanRow(store.db, &pst, "SELECT "+postColumns+" FROM Posts WHERE id = ?", ID)
+	return pst, err
+}
+
+func (store *sqlPostStore) Add(post AddPostRequest) (int, error) {
+	const Query = `
+	INSERT INTO Posts (PostedBy, Content, TimeCreated, ParentId, images)
+	VALUES (?, ?, ?, NULLIF(?, -1), ?)
+	RETURNING id
+	`
+
+	var ID int
+	err := store.db.QueryRow(Query, post.PostedBy, post.Content, time.Now(), post.ParentID, post.Images).Scan(&ID)
+	return ID, err
+}
+
+func (store *sqlPostStore) Random(postedBy int) (PostDB, error) {
+	const Query = `
+	SELECT ` + postColumns + `
+	FROM Posts
+	WHERE ParentId IS NULL
+	AND (? = 0 OR PostedBy = ?)
+	ORDER BY RANDOM()
+	LIMIT 1
+	`
+
+	var pst PostDB
+	err := scanRow(store.db, &pst, Query, postedBy, postedBy)
+	return pst, err
+}
+
+func (store *sqlPostStore) Comments(parentID, from, amount int) ([]PostDB, error) {
+	const Query = `
+	SELECT ` + postColumns + `
+	FROM Posts
+	WHERE ParentId = ?
+	ORDER BY id
+	LIMIT ? OFFSET ?
+	`
+
+	return store.queryPosts(Query, parentID, amount, from)
+}
+
+func (store *sqlPostStore) ByUser(postedBy, from, amount int) ([]PostDB, error) {
+	const Query = `
+	SELECT ` + postColumns + `
+	FROM Posts
+	WHERE ParentId IS NULL
+	AND PostedBy = ?
+	ORDER BY id DESC
+	LIMIT ? OFFSET ?
+	`
+
+	return store.queryPosts(Query, postedBy, amount, from)
+}
+
+func (store *sqlPostStore) Search(content string, from, amount int) ([]PostDB, error) {
+	const Query = `
+	SELECT ` + postColumns + `
+	FROM Posts
+	WHERE ParentId IS NULL
+	AND lower(content) LIKE lower(?)
+	ORDER BY id DESC
+	LIMIT ? OFFSET ?
+	`
+
+	return store.queryPosts(Query, likeContains(content), amount, from)
+}
+
+func (store *sqlPostStore) React(ID, userID int, like bool) error {
+	count, list := "dislikes", "whoDisliked"
+	if like {
+		count, list = "likes", "whoLiked"
+	}
+
+	query := fmt.Sprintf(`
+	UPDATE Posts SET %[1]s = %[1]s + 1, %[2]s
+	WHERE id = ? AND %[3]s`, count, sqlAddToList(list), sqlNotInList(list))
+
+	user := strconv.Itoa(userID)
+	return execOne(store.db, query, user, user, ID, listPattern(user))
+}
+
+func (store *sqlPostStore) List(from, amount int) ([]PostDB, error) {
+	return store.queryPosts("SELECT "+postColumns+" FROM Posts ORDER BY id LIMIT ? OFFSET ?", amount, from)
+}
+
+func (store *sqlPostStore) Import(post PostDB) error {
+	const Query = `
+	INSERT INTO Posts (id, PostedBy, content, timeCreated, parentID, whoLiked, whoDisliked, likes, dislikes, images)
+	VALUES (?, ?, ?, ?, NULLIF(?, -1), ?, ?, ?, ?, ?)
+	`
+
+	_, err := store.db.Exec(Query,
+		post.ID, post.PostedBy, post.Content, post.TimeCreated, post.ParentID,
+		post.WhoLiked, post.WhoDisliked, post.Likes, post.Dislikes, post.Images,
+	)
+	if err != nil {
+		return err
+	}
+
+	return resetSequence(store.db, "Posts")
+}
+
+type sqlImageStore struct {
+	db *database.DB
+}
+
+func (store *sqlImageStore) Get(ID string) (ImageData, error) {
+	var Image ImageData
+	err := scanRow(store.db, &Image, `SELECT url AS "URL", content, mimetype, etag FROM Images WHERE url = ?`, ID)
+	return Image, err
+}
+
+func (store *sqlImageStore) ETag(ID string) (string, error) {
+	var eTag string
+	err := scanRow(store.db, &eTag, "SELECT etag FROM Images WHERE url = ?", ID)
+	return eTag, err
+}
+
+func (store *sqlImageStore) SetETag(ID, eTag string) error {
+	_, err := store.db.Exec("UPDATE Images SET etag = ? WHERE url = ?", eTag, ID)
+	return err
+}
+
+func (store *sqlImageStore) Meta(IDs []string) (map[string]ImageMeta, error) {
+	metas := map[string]ImageMeta{}
+	if len(IDs) == 0 {
+		return metas, nil
+	}
+
+	args := make([]any, len(IDs))
+	for i, ID := range IDs {
+		args[i] = ID
+	}
+
+	query := fmt.Sprintf(
+		`SELECT url AS "URL", width, height, blurHash AS "blurHash", color FROM Images WHERE url IN (?%s)`,
+		strings.Repeat(", ?", len(IDs)-1),
+	)
+
+	rows, err := store.db.Query(query, args...) // Not prepared, the query changes with the amount of IDs
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var Images []ImageMeta
+	if err := scan.Rows(&Images, rows); err != nil {
+		return nil, err
+	}
+
+	for _, meta := range Images {
+		metas[meta.URL] = meta
+	}
+
+	return metas, nil
+}
+
+func (store *sqlImageStore) Add(image ImageData, meta ImageMeta) error {
+	const Query = `
+	INSERT INTO Images (url, content, mimetype, etag, width, height, blurHash, color)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`
+
+	_, err := store.db.Exec(Query, image.URL, image.Content, image.ContentType, image.ETag, meta.Width, meta.Height, meta.BlurHash, meta.Color)
+	return err
+}
+
+func (store *sqlImageStore) List(from, amount int) ([]ImageData, error) {
+	const Query = `SELECT url AS "URL", content, mimetype, etag FROM Images ORDER BY url LIMIT ? OFFSET ?`
+
+	Images := []ImageData{}
+	err := scanRows(store.db, &Images, Query, amount, from)
+	return Images, err
+}
@@ -0,0 +1,319 @@
+package api
+
+import (
+	"database/sql"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Blockitifluy/CoffeeCo/api/database"
+	"github.com/Blockitifluy/CoffeeCo/api/database/dbtest"
+)
+
+// testUser creates a user with a handle (their password is the handle)
+func testUser(handle string) User {
+	u := User{PublicUser: &PublicUser{Username: handle, Handle: handle}}
+	u.SetPassword(handle)
+	return u
+}
+
+func TestSQLUserStore(t *testing.T) {
+	dbtest.Run(t, func(t *testing.T, dialect database.Dialect) {
+		store := NewSQLStores(dbtest.Migrated(t, dialect)).Users
+
+		coffee := testUser("coffee")
+		ID, err := store.Add(coffee)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		otherID, err := store.Add(testUser("tea"))
+		if err != nil || otherID != ID+1 {
+			t.Fatalf("added user %d (%v), expected ID %d", otherID, err, ID+1)
+		}
+
+		if _, err := store.Add(testUser("coffee")); err == nil {
+			t.Fatal("expected a duplicate handle to fail")
+		}
+
+		if u, err := store.Get(ID); err != nil || u.Handle != "coffee" || u.ID != ID {
+			t.Fatalf("got %+v (%v)", u, err)
+		}
+
+		if u, err := store.ByHandle("coffee"); err != nil || u.ID != ID || string(u.password) != string(coffee.password) {
+			t.Fatalf("got %+v (%v)", u, err)
+		}
+
+		if authID, err := store.IDFromAuth(coffee.Auth); err != nil || authID != ID {
+			t.Fatalf("auth is user %d (%v), expected %d", authID, err, ID)
+		}
+
+		if _, err := store.Get(999); err != sql.ErrNoRows {
+			t.Fatalf("expected sql.ErrNoRows, got %v", err)
+		}
+
+		if _, err := store.ByHandle("nobody"); err != sql.ErrNoRows {
+			t.Fatalf("expected sql.ErrNoRows, got %v", err)
+		}
+
+		if err := store.Follow(ID, otherID); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.Follow(ID, otherID); err != sql.ErrNoRows {
+			t.Fatalf("following twice should be sql.ErrNoRows, got %v", err)
+		}
+		if u, _ := store.Get(ID); u.Followers != 1 || u.WhoFollowed != fmt.Sprint(otherID) {
+			t.Fatalf("got %d followers (%q)", u.Followers, u.WhoFollowed)
+		}
+
+		if err := store.SetBanned(ID, true); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := store.IDFromAuth(coffee.Auth); err != sql.ErrNoRows {
+			t.Fatalf("banned users' auth should be sql.ErrNoRows, got %v", err)
+		}
+
+		found, err := store.Search("TE", 0, 10)
+		if err != nil || len(found) != 1 || found[0].ID != otherID {
+			t.Fatalf("search found %+v (%v)", found, err)
+		}
+	})
+}
+
+func TestSQLPostStore(t *testing.T) {
+	dbtest.Run(t, func(t *testing.T, dialect database.Dialect) {
+		stores := NewSQLStores(dbtest.Migrated(t, dialect))
+		userID, err := stores.Users.Add(testUser("coffee"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := stores.Posts.Random(0); err != sql.ErrNoRows {
+			t.Fatalf("random post without posts should be sql.ErrNoRows, got %v", err)
+		}
+
+		postID, err := stores.Posts.Add(AddPostRequest{PostedBy: userID, Content: "Hello", ParentID: -1})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		pst, err := stores.Posts.Get(postID)
+		if err != nil || pst.ParentID != -1 || pst.Content != "Hello" || pst.PostedBy != userID {
+			t.Fatalf("got %+v (%v)", pst, err)
+		}
+
+		var commentIDs []int
+		for _, content := range []string{"First", "Second", "Third"} {
+			ID, err := stores.Posts.Add(AddPostRequest{PostedBy: userID, Content: content, ParentID: postID})
+			if err != nil {
+				t.Fatal(err)
+			}
+			commentIDs = append(commentIDs, ID)
+		}
+
+		if commentIDs[0] != postID+1 {
+			t.Fatalf("Add sent %v, expected IDs after %d", commentIDs, postID)
+		}
+
+		comments, err := stores.Posts.Comments(postID, 1, 2)
+		if err != nil || len(comments) != 2 || comments[0].ID != commentIDs[1] || comments[1].ID != commentIDs[2] {
+			t.Fatalf("got comments %+v (%v)", comments, err)
+		}
+
+		for i := 0; i < 5; i++ {
+			if random, err := stores.Posts.Random(0); err != nil || random.ID != postID {
+				t.Fatalf("random post is %+v (%v), comments aren't in the feed", random, err)
+			}
+		}
+
+		if _, err := stores.Posts.Random(userID + 1); err != sql.ErrNoRows {
+			t.Fatalf("random post of a user without posts should be sql.ErrNoRows, got %v", err)
+		}
+
+		if byUser, err := stores.Posts.ByUser(userID, 0, 10); err != nil || len(byUser) != 1 || byUser[0].ID != postID {
+			t.Fatalf("user's posts are %+v (%v)", byUser, err)
+		}
+
+		if err := stores.Posts.React(postID, userID, true); err != nil {
+			t.Fatal(err)
+		}
+		if err := stores.Posts.React(postID, userID, true); err != sql.ErrNoRows {
+			t.Fatalf("liking twice should be sql.ErrNoRows, got %v", err)
+		}
+		if pst, _ := stores.Posts.Get(postID); pst.Likes != 1 {
+			t.Fatalf("got %d likes", pst.Likes)
+		}
+
+		if found, err := stores.Posts.Search("hell", 0, 10); err != nil || len(found) != 1 {
+			t.Fatalf("search found %+v (%v)", found, err)
+		}
+
+		if _, err := stores.Posts.Get(999); err != sql.ErrNoRows {
+			t.Fatalf("expected sql.ErrNoRows, got %v", err)
+		}
+	})
+}
+
+// Importing rows with their IDs resets Postgres' sequences, so the next IDs don't collide
+func TestSQLImport(t *testing.T) {
+	dbtest.Run(t, func(t *testing.T, dialect database.Dialect) {
+		stores := NewSQLStores(dbtest.Migrated(t, dialect))
+
+		imported := testUser("coffee")
+		imported.ID, imported.TimeCreated = 10, time.Now()
+		if err := stores.Users.Import(imported); err != nil {
+			t.Fatal(err)
+		}
+
+		userID, err := stores.Users.Add(testUser("tea"))
+		if err != nil || userID != 11 {
+			t.Fatalf("added user %d (%v) after importing user 10", userID, err)
+		}
+
+		post := PostDB{ID: 20, PostedBy: 10, Content: "Hello", TimeCreated: time.Now(), ParentID: -1}
+		if err := stores.Posts.Import(post); err != nil {
+			t.Fatal(err)
+		}
+
+		comment := PostDB{ID: 21, PostedBy: 10, Content: "A comment", TimeCreated: time.Now(), ParentID: 20}
+		if err := stores.Posts.Import(comment); err != nil {
+			t.Fatal(err)
+		}
+
+		postID, err := stores.Posts.Add(AddPostRequest{PostedBy: userID, Content: "Hi", ParentID: -1})
+		if err != nil || postID != 22 {
+			t.Fatalf("added post %d (%v) after importing post 21", postID, err)
+		}
+
+		if pst, err := stores.Posts.Get(20); err != nil || pst.ParentID != -1 {
+			t.Fatalf("imported post is %+v (%v)", pst, err)
+		}
+	})
+}
+
+func TestSQLImageStore(t *testing.T) {
+	dbtest.Run(t, func(t *testing.T, dialect database.Dialect) {
+		store := NewSQLStores(dbtest.Migrated(t, dialect)).Images
+
+		image := ImageData{URL: "image", Content: []byte{1, 2, 3}, ContentType: "image/png"}
+		meta := ImageMeta{Width: 16, Height: 8, BlurHash: "hash", Color: "#ffffff"}
+		if err := store.Add(image, meta); err != nil {
+			t.Fatal(err)
+		}
+
+		if eTag, err := store.ETag("image"); err != nil || eTag != "" {
+			t.Fatalf("ETag is %q (%v), expected none", eTag, err)
+		}
+
+		if err := store.SetETag("image", `"etag"`); err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := store.Get("image")
+		if err != nil || got.ETag != `"etag"` || got.ContentType != "image/png" || string(got.Content) != string(image.Content) {
+			t.Fatalf("got %+v (%v)", got, err)
+		}
+
+		metas, err := store.Meta([]string{"image", "missing"})
+		if err != nil || len(metas) != 1 || metas["image"].Width != 16 || metas["image"].BlurHash != "hash" {
+			t.Fatalf("got %+v (%v)", metas, err)
+		}
+
+		if _, err := store.ETag("missing"); err != sql.ErrNoRows {
+			t.Fatalf("expected sql.ErrNoRows, got %v", err)
+		}
+
+		if err := store.Add(ImageData{URL: "text", Content: []byte{1}, ContentType: "text/plain"}, ImageMeta{}); err == nil {
+			t.Fatal("expected a mimetype that isn't an image to fail")
+		}
+	})
+}
+
+// Writes wait for each other (see the busy timeout of [database.Open]), so concurrent requests never fail with
+// `database is locked` (SQLITE_BUSY)
+func TestSQLiteConcurrentWrites(t *testing.T) {
+	const writers, readers, iterations = 8, 8, 40
+
+	stores := NewSQLStores(dbtest.Migrated(t, database.SQLite))
+
+	ownerID, err := stores.Users.Add(testUser("owner"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	postID, err := stores.Posts.Add(AddPostRequest{PostedBy: ownerID, Content: "Hello", ParentID: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	errs := make(chan error, (writers+readers)*iterations*4)
+	var wg sync.WaitGroup
+
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+
+			userID, err := stores.Users.Add(testUser(fmt.Sprint("writer", w)))
+			if err != nil {
+				errs <- err
+				return
+			}
+
+			errs <- stores.Posts.React(postID, userID, w%2 == 0)
+			errs <- stores.Users.Follow(ownerID, userID)
+
+			for i := 0; i < iterations; i++ {
+				ID, err := stores.Posts.Add(AddPostRequest{PostedBy: userID, Content: fmt.Sprint("Post ", i), ParentID: -1})
+				errs <- err
+
+				_, err = stores.Posts.Add(AddPostRequest{PostedBy: userID, Content: fmt.Sprint("Comment ", i), ParentID: postID})
+				errs <- err
+
+				if err == nil {
+					errs <- stores.Posts.React(ID, ownerID, true)
+				}
+			}
+		}(w)
+	}
+
+	for r := 0; r < readers; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for i := 0; i < iterations; i++ {
+				_, err := stores.Posts.Get(postID)
+				errs <- err
+
+				_, err = stores.Posts.Comments(postID, 0, 20)
+				errs <- err
+
+				_, err = stores.Posts.Random(0)
+				errs <- err
+
+				_, err = stores.Users.Get(ownerID)
+				errs <- err
+			}
+		}()
+	}
+
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Errorf("concurrent query failed: %v", err)
+		}
+	}
+
+	comments, err := stores.Posts.Comments(postID, 0, writers*iterations+1)
+	if err != nil || len(comments) != writers*iterations {
+		t.Fatalf("got %d comments (%v), expected %d", len(comments), err, writers*iterations)
+	}
+
+	if owner, err := stores.Users.Get(ownerID); err != nil || owner.Followers != writers {
+		t.Fatalf("owner has %d followers (%v), expected %d", owner.Followers, err, writers)
+	}
+}
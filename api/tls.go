@@ -0,0 +1,175 @@
+package api
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// certCheckInterval is how often the certificate files are checked for changes (when a connection is made)
+const certCheckInterval = 10 * time.Second
+
+// certReloader loads a certificate from files and reloads it when the files are modified,
+// so renewed certificates (e.g. from Let's Encrypt) are used without restarting
+type certReloader struct {
+	certPath, keyPath string
+
+	mu        sync.Mutex
+	cert      *tls.Certificate
+	modTime   time.Time // The latest modification time of the files
+	checkedAt time.Time
+}
+
+// newCertReloader loads the certificate, returns an error if it's invalid
+func newCertReloader(certPath, keyPath string) (*certReloader, error) {
+	reloader := &certReloader{certPath: certPath, keyPath: keyPath}
+	if err := reloader.load(); err != nil {
+		return nil, err
+	}
+
+	return reloader, nil
+}
+
+// filesModTime gets the latest modification time of the certificate and key
+func (reloader *certReloader) filesModTime() (time.Time, error) {
+	var latest time.Time
+	for _, path := range []string{reloader.certPath, reloader.keyPath} {
+		info, err := os.Stat(path)
+		if err != nil {
+			return latest, err
+		}
+
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+
+	return latest, nil
+}
+
+// load reads the certificate, should be called whilst locked (or before it's used)
+func (reloader *certReloader) load() error {
+	modTime, err := reloader.filesModTime()
+	if err != nil {
+		return fmt.Errorf("TLS certificate couldn't be read: %w", err)
+	}
+
+	cert, err := tls.LoadX509KeyPair(reloader.certPath, reloader.keyPath)
+	if err != nil {
+		return fmt.Errorf("TLS certificate couldn't be loaded: %w", err)
+	}
+
+	reloader.cert, reloader.modTime, reloader.checkedAt = &cert, modTime, time.Now()
+	return nil
+}
+
+// GetCertificate is used by [crypto/tls.Config], the files are checked every certCheckInterval.
+// If the modified files can't be loaded (e.g. only the certificate has been replaced), the old certificate is used
+func (reloader *certReloader) GetCertificate(_ *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	reloader.mu.Lock()
+	defer reloader.mu.Unlock()
+
+	if time.Since(reloader.checkedAt) < certCheckInterval {
+		return reloader.cert, nil
+	}
+	reloader.checkedAt = time.Now()
+
+	modTime, err := reloader.filesModTime()
+	if err != nil || !modTime.After(reloader.modTime) {
+		return reloader.cert, nil
+	}
+
+	if err := reloader.load(); err != nil {
+		slog.Warn("Using the old TLS certificate", "error", err)
+		return reloader.cert, nil
+	}
+
+	slog.Info("Reloaded the TLS certificate")
+	return reloader.cert, nil
+}
+
+// TLSEnabled is true when the server is served over https (`TLS_CERT` and `TLS_KEY` are set)
+func (cfg Config) TLSEnabled() bool {
+	return cfg.TLS.CertPath != "" && cfg.TLS.KeyPath != ""
+}
+
+// tlsConfig creates the TLS config of the server, with HTTP/2 enabled
+func (srv *Server) tlsConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: srv.certs.GetCertificate,
+		NextProtos:     []string{"h2", "http/1.1"},
+	}
+}
+
+// hstsMiddleware adds `Strict-Transport-Security`, so browsers only use https after the first visit
+func (srv *Server) hstsMiddleware(next http.Handler) http.Handler {
+	header := fmt.Sprintf("max-age=%d", int(srv.Config.TLS.HSTSMaxAge.Seconds()))
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Strict-Transport-Security", header)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// redirectServer creates the http server redirecting every request to https (on `HTTP_REDIRECT_ADDRESS`)
+func (srv *Server) redirectServer() *http.Server {
+	_, httpsPort, _ := net.SplitHostPort(srv.Config.Address)
+
+	redirect := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.Host)
+		if err != nil { // No port
+			host = r.Host
+		}
+
+		if httpsPort != "" && httpsPort != "443" {
+			host = net.JoinHostPort(host, httpsPort)
+		}
+
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusPermanentRedirect)
+	})
+
+	cfg := srv.Config.HTTP
+	return &http.Server{
+		Addr:              srv.Config.TLS.RedirectAddress,
+		Handler:           redirect,
+		ReadTimeout:       cfg.ReadTimeout,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+		MaxHeaderBytes:    cfg.MaxHeaderBytes,
+	}
+}
+
+// authCookieName is the cookie containing the user's auth,
+// loggedInCookieName is readable by the frontend (even when the auth cookie is `HttpOnly`) and only shows the user has logged in
+const authCookieName, loggedInCookieName = "AuthToken", "LoggedIn"
+
+// setAuthCookies sets the auth cookies, which are `SameSite=Lax` (so other sites' requests don't send them),
+// and `Secure` (and the auth is `HttpOnly`) when served over https. A negative maxAge removes the cookies
+func (srv *Server) setAuthCookies(w http.ResponseWriter, auth string, maxAge int) {
+	loggedIn := "true"
+	if maxAge < 0 {
+		loggedIn = ""
+	}
+
+	cookies := []*http.Cookie{
+		{Name: authCookieName, Value: auth, MaxAge: maxAge, Path: "/"},
+		{Name: loggedInCookieName, Value: loggedIn, MaxAge: maxAge, Path: "/"},
+	}
+
+	for _, cookie := range cookies {
+		cookie.SameSite = http.SameSiteLaxMode
+		if srv.Config.TLSEnabled() {
+			cookie.Secure = true
+			cookie.HttpOnly = cookie.Name == authCookieName // The frontend uses `/api/user/auth-to-id` and `/api/user/log-out` instead
+		}
+
+		http.SetCookie(w, cookie)
+	}
+}
@@ -1,6 +1,8 @@
 package api
 
 import (
+	"crypto/subtle"
+	"database/sql"
 	"encoding/json"
 	"fmt"
 	"hash/fnv"
@@ -10,7 +12,6 @@ import (
 	"time"
 
 	"github.com/Blockitifluy/CoffeeCo/utility"
-	"github.com/blockloop/scan"
 	"github.com/gorilla/mux"
 )
 
@@ -30,11 +31,17 @@ type PublicUser struct {
 	Handle      string `json:"handle" db:"handle"`     // An unique handle
 	Bio         string `json:"bio" db:"bio"`           // The description (biography)
 	Followers   int    `json:"followers" db:"followers"`
-	WhoFollowed string `json:"whoFollowed" db:"whoFollowed"` // How many users following
+	WhoFollowed string `json:"whoFollowed" db:"whoFollowed"` // The IDs of the followers (comma separated)
 	Banner      string `json:"Banner" db:"banner"`           // Url to the Banner
 	Profile     string `json:"Profile" db:"profile"`         // Url to the Profile
+
+	ProfileMeta *ImageMeta `json:"ProfileMeta,omitempty" db:"-"` // The placeholder of the Profile (if uploaded)
+	BannerMeta  *ImageMeta `json:"BannerMeta,omitempty" db:"-"`  // The placeholder of the Banner (if uploaded)
 }
 
+// maxHandleLength is the most bytes a handle can have
+const maxHandleLength = 24
+
 // SentUser contains all the regular information from [coffeecoserver/api.PublicUser] as well as:
 //
 //   - Password
@@ -50,9 +57,11 @@ type SentUser struct {
 type User struct {
 	*PublicUser
 
-	password []byte `db:"password"` // hashed password
-	Email    string `json:"email" db:"email"`
-	Auth     string `json:"auth" db:"auth"` // Authorisation Token
+	password    []byte    `db:"password"` // hashed password
+	Email       string    `json:"email" db:"email"`
+	Auth        string    `json:"auth" db:"auth"` // Authorisation Token
+	TimeCreated time.Time `json:"timeCreated" db:"timeCreated"`
+	Banned      bool      `json:"banned" db:"banned"` // Banned users can't log in or use their Auth
 }
 
 func hashString(b []byte) uint32 {
@@ -61,6 +70,20 @@ func hashString(b []byte) uint32 {
 	return h.Sum32()
 }
 
+// HashPassword hashes an unhashed password, the way it's stored in the database
+func HashPassword(password string) []byte {
+	return utility.I32toB(hashString([]byte(password)))
+}
+
+// unknownUserPassword is compared with the sent password when the handle isn't found (see [Server.APILoginUser])
+var unknownUserPassword = HashPassword("")
+
+// SetPassword hashes the password and generates a new auth token (logging out the user everywhere)
+func (u *User) SetPassword(password string) {
+	u.password = HashPassword(password)
+	u.Auth = u.GenerateAuth()
+}
+
 // GenerateAuth generates an auth token from the user
 func (u *User) GenerateAuth() string {
 	byteConverted := [][]byte{
@@ -80,36 +103,6 @@ func (u *User) GenerateAuth() string {
 	return hashed
 }
 
-// IDToUser get the ID from the User
-func (srv *Server) IDToUser(ID int) (*User, error) {
-	res, err := srv.Query("SELECT * FROM Users WHERE id = ?", ID)
-	if err != nil {
-		return nil, err
-	}
-
-	var user User
-	if err := scan.Row(user, res); err != nil {
-		return nil, err
-	}
-
-	return &user, nil
-}
-
-// AuthToID is the non-api version of APIAuthToID
-func (srv *Server) AuthToID(auth string) (int, error) {
-	rows, err := srv.Query("SELECT id AS ID FROM Users WHERE auth = ?", auth)
-	if err != nil {
-		return 0, err
-	}
-
-	var ID int
-	if err := scan.Row(&ID, rows); err != nil {
-		return 0, err
-	}
-
-	return ID, nil
-}
-
 // APIUserFromID is an api call. Doesn't work as expected when called outside an API context
 //
 // Get a user based on the id given via url.
@@ -119,169 +112,209 @@ func (srv *Server) APIUserFromID(w http.ResponseWriter, r *http.Request) {
 		utility.Error(w, utility.HTTPError{
 			Public:  utility.PublicBadRequest,
 			Message: err.Error(),
-			Code:    400,
+			Status:  400,
 		})
 		return
 	}
 
-	rows, err := srv.Query("SELECT * FROM Users WHERE id = ?", id)
+	u, err := srv.Users.Get(id)
 	if err != nil {
 		utility.SendScanErr(w, err, nil)
 		return
 	}
 
-	var u PublicUser
-	if err := scan.Row(&u, rows); err != nil {
-		utility.SendScanErr(w, err, nil)
-		return
-	}
-
-	json, err := json.Marshal(u)
-	if err != nil {
-		utility.Error(w, utility.HTTPError{
-			Public:  "No User Found",
-			Message: err.Error(),
-			Code:    500,
-		})
+	Users := []PublicUser{u}
+	if sentErr := srv.attachUserImageMeta(Users); sentErr != nil {
+		utility.Error(w, *sentErr)
 		return
 	}
 
 	w.Header().Set("Cache-Control", fmt.Sprintf("max-age=%d", utility.MinuteCache))
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(json)
+	utility.Send(w, http.StatusOK, Users[0])
 }
 
 // APIAddUser is an api call. Doesn't work as expected when called outside an API context
 //
-// Add user using the SentUser struct
+// Add user using the SentUser struct, sending the user's ID
 func (srv *Server) APIAddUser(w http.ResponseWriter, r *http.Request) {
 	var user SentUser
 	decoder := json.NewDecoder(r.Body)
 	err := decoder.Decode(&user)
 	if err != nil {
 		utility.Error(w, utility.HTTPError{
+			Code:    "invalid_body",
 			Public:  utility.PublicBadRequest,
 			Message: err.Error(),
-			Code:    400,
+			Status:  400,
 		})
 		return
 	}
 
-	if len(user.Handle) > 24 {
-		utility.Error(w, utility.HTTPError{
-			Public:  "Username Too Long (24 limit)",
-			Message: "Username to long",
-			Code:    400,
+	if user.PublicUser == nil {
+		user.PublicUser = &PublicUser{}
+	}
+
+	var details []utility.FieldError
+	if user.Handle == "" {
+		details = append(details, utility.FieldError{Field: "handle", Code: "no_handle", Message: "No Handle"})
+	} else if len(user.Handle) > maxHandleLength {
+		details = append(details, utility.FieldError{
+			Field:   "handle",
+			Code:    "handle_too_long",
+			Message: fmt.Sprintf("Handle Too Long (%d limit)", maxHandleLength),
 		})
-		return
 	}
 
-	hashedPass := utility.I32toB(hashString([]byte(user.Password)))
+	if user.Password == "" {
+		details = append(details, utility.FieldError{Field: "password", Code: "no_password", Message: "No Password"})
+	}
+
+	if len(details) > 0 {
+		utility.Error(w, utility.InvalidFields(details...))
+		return
+	}
 
 	var hashedUser User = User{
 		PublicUser: user.PublicUser,
 
-		password: hashedPass,
-		Email:    user.Email,
+		Email: user.Email,
 	}
 
-	nowDate := time.Now()
+	hashedUser.SetPassword(user.Password)
 
-	var Options []any = []any{
-		hashedUser.Username,
-		hashedUser.Handle,
-		hashedUser.password,
-		hashedUser.Email,
-		nowDate,
-		hashedUser.GenerateAuth(),
-	}
-	_, execErr := srv.Exec("INSERT INTO Users (username, handle, password, email, timeCreated, auth) VALUES (?, ?, ?, ?, ?, ?)", Options...)
+	ID, execErr := srv.Users.Add(hashedUser)
 
 	if execErr != nil {
 		utility.Error(w, utility.HTTPError{
+			Code:    "user_not_added",
 			Public:  "Unable to Add User",
 			Message: execErr.Error(),
-			Code:    400,
+			Status:  400,
 		})
 		return
 	}
+
+	utility.Send(w, http.StatusCreated, map[string]int{"ID": ID})
 }
 
 // APIAuthToID is an api call. Doesn't work as expected when called outside an API context
 //
-// Get a user's id using authorisation token via url
+// Get a user's id using authorisation token via url, or the `AuthToken` cookie when the url doesn't have one
 func (srv *Server) APIAuthToID(w http.ResponseWriter, r *http.Request) {
-	sentAuth := mux.Vars(r)["auth"]
-
-	row := srv.QueryRow("SELECT id FROM Users WHERE auth = ?", sentAuth)
-	if row.Err() != nil {
-		utility.Error(w, utility.HTTPError{
-			Public:  utility.PublicServerError,
-			Message: row.Err().Error(),
-			Code:    500,
-		})
-		return
+	sentAuth, ok := mux.Vars(r)["auth"]
+	if !ok {
+		cookie, err := r.Cookie(authCookieName)
+		if err != nil {
+			utility.Error(w, utility.HTTPError{
+				Code:    "not_logged_in",
+				Public:  "Not Logged In",
+				Message: "no auth cookie",
+				Status:  401,
+			})
+			return
+		}
+
+		sentAuth = cookie.Value
 	}
 
-	var ID int
-	if err := row.Scan(&ID); err != nil {
+	ID, err := srv.Users.IDFromAuth(sentAuth)
+	if err != nil {
 		utility.SendScanErr(w, err, nil)
 		return
 	}
+	setRequestUser(r, ID)
 
-	w.Header().Set("Content-Type", "text/text")
-	w.Write([]byte(fmt.Sprintf("%d", ID)))
+	utility.Send(w, http.StatusOK, map[string]int{"ID": ID})
 }
 
 // APILoginUser is an api call. Doesn't work as expected when called outside an API context
 //
-// Logs in user via password and username
+// Logs in user via password and username, sending the user's ID.
+// An unknown handle and an incorrect password are the same error, so handles can't be found by logging in.
+// Too many failures lock out the handle or IP (see [LoginConfig]), telling the owner (see [Notifier])
 func (srv *Server) APILoginUser(w http.ResponseWriter, r *http.Request) {
 	var Req LoginUser
 
 	if err := json.NewDecoder(r.Body).Decode(&Req); err != nil {
 		utility.Error(w, utility.HTTPError{
+			Code:    "invalid_body",
 			Public:  utility.PublicBadRequest,
 			Message: err.Error(),
-			Code:    400,
+			Status:  400,
 		})
 		return
 	}
 
-	response := srv.QueryRow("SELECT password, auth FROM Users WHERE handle = ?", Req.Handle)
+	ip := srv.ClientIP(r)
+	if wait := srv.logins.lockedFor(Req.Handle, ip, time.Now()); wait > 0 {
+		srv.metrics.loginFailures.WithLabelValues("locked").Inc()
 
-	var (
-		password []byte
-		auth     string
-	)
+		w.Header().Set("Retry-After", seconds(wait))
+		utility.Error(w, utility.HTTPError{
+			Code:    "login_locked",
+			Public:  "Too many failed log ins, try again in " + seconds(wait) + "s",
+			Message: "handle or ip locked out",
+			Status:  http.StatusTooManyRequests,
+		})
+		return
+	}
 
-	if err := response.Scan(&password, &auth); err != nil {
-		var sendErr string = "Couldn't find User"
-		utility.SendScanErr(w, err, &sendErr)
+	user, err := srv.Users.ByHandle(Req.Handle)
+	if err != nil && err != sql.ErrNoRows {
+		utility.SendScanErr(w, err, nil)
 		return
 	}
 
-	hashedPass := utility.I32toB(hashString([]byte(Req.Password)))
-	if string(hashedPass) != string(password) {
+	found := err == nil
+	expected := unknownUserPassword
+	if found {
+		expected = user.password
+	}
+
+	// Compared even when the handle isn't found, so it doesn't respond sooner
+	correct := subtle.ConstantTimeCompare(HashPassword(Req.Password), expected) == 1
+	if !found || !correct {
+		srv.metrics.loginFailures.WithLabelValues("invalid_credentials").Inc()
+
+		lockedFor, firstLock := srv.logins.fail(Req.Handle, ip, time.Now())
+		if found && firstLock {
+			srv.notifyLocked(user, lockedFor, ip)
+		}
+
+		utility.Error(w, utility.HTTPError{
+			Code:    "invalid_credentials",
+			Public:  "Incorrect Handle or Password",
+			Message: "handle not found or password wrong",
+			Status:  401,
+		})
+		return
+	}
+	srv.logins.succeed(Req.Handle)
+
+	if user.Banned {
 		utility.Error(w, utility.HTTPError{
-			Public:  "Incorrect Password",
-			Message: "password wrong",
-			Code:    401,
+			Code:    "user_banned",
+			Public:  "User is Banned",
+			Message: "user banned",
+			Status:  403,
 		})
 		return
 	}
 
+	setRequestUser(r, user.ID)
+
 	const maxAge int = 365 * 24 * 60 * 60
 
-	cookie := &http.Cookie{
-		Name:   "AuthToken",
-		Value:  auth,
-		MaxAge: maxAge,
-		Path:   "/",
-	}
+	srv.setAuthCookies(w, user.Auth, maxAge)
+	utility.Send(w, http.StatusOK, map[string]int{"ID": user.ID})
+}
 
-	http.SetCookie(w, cookie)
-	w.Write([]byte("Auth Cookie added successfully"))
+// APILogOutUser is an api call. Doesn't work as expected when called outside an API context
+//
+// Logs out the user by removing the auth cookie (which can't be removed by the frontend over https)
+func (srv *Server) APILogOutUser(w http.ResponseWriter, r *http.Request) {
+	srv.setAuthCookies(w, "", -1)
+	utility.Send(w, http.StatusOK, nil)
 }
 
 // APISearchForUsers is an api call. Doesn't work as expected when called outside an API context
@@ -294,7 +327,7 @@ func (srv *Server) APISearchForUsers(w http.ResponseWriter, r *http.Request) {
 		utility.Error(w, utility.HTTPError{
 			Public:  utility.PublicBadRequest,
 			Message: err.Error(),
-			Code:    400,
+			Status:  400,
 		})
 		return
 	}
@@ -304,7 +337,7 @@ func (srv *Server) APISearchForUsers(w http.ResponseWriter, r *http.Request) {
 		utility.Error(w, utility.HTTPError{
 			Public:  utility.PublicBadRequest,
 			Message: "Couldn't parse from",
-			Code:    400,
+			Status:  400,
 		})
 		return
 	}
@@ -314,33 +347,13 @@ func (srv *Server) APISearchForUsers(w http.ResponseWriter, r *http.Request) {
 		utility.Error(w, utility.HTTPError{
 			Public:  utility.PublicBadRequest,
 			Message: "Couldn't range from",
-			Code:    400,
+			Status:  400,
 		})
 		return
 	}
 
-	const Query = `
-	SELECT * FROM Users
-	WHERE lower(handle) LIKE lower(?) OR
-	lower(username) LIKE lower(?)
-	ORDER BY id ASC
-	LIMIT ? OFFSET ?
-	`
-
-	formatedName := fmt.Sprintf("%%%s%%", name)
-
-	rows, err := srv.Query(Query, formatedName, formatedName, userRange, from)
+	Users, err := srv.Users.Search(name, from, userRange)
 	if err != nil {
-		utility.Error(w, utility.HTTPError{
-			Public:  utility.PublicServerError,
-			Message: err.Error(),
-			Code:    500,
-		})
-		return
-	}
-
-	var Users []PublicUser
-	if err := scan.Rows(&Users, rows); err != nil {
 		utility.SendScanErr(w, err, nil)
 		return
 	}
@@ -349,32 +362,15 @@ func (srv *Server) APISearchForUsers(w http.ResponseWriter, r *http.Request) {
 		utility.Error(w, utility.HTTPError{
 			Public:  utility.PublicNotFoundError,
 			Message: "no rows found",
-			Code:    404,
-		})
-		return
-	}
-
-	JSON, err := json.Marshal(Users)
-	if err != nil {
-		utility.Error(w, utility.HTTPError{
-			Public:  utility.PublicServerError,
-			Message: err.Error(),
-			Code:    500,
+			Status:  404,
 		})
 		return
 	}
 
-	zipped, err := utility.GZipBytes(JSON)
-	if err != nil {
-		utility.Error(w, utility.HTTPError{
-			Public:  utility.PublicServerError,
-			Message: err.Error(),
-			Code:    500,
-		})
+	if sentErr := srv.attachUserImageMeta(Users); sentErr != nil {
+		utility.Error(w, *sentErr)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("Content-Encoding", "gzip")
-	w.Write(zipped)
+	utility.Send(w, http.StatusOK, Users)
 }
@@ -0,0 +1,164 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestAddUser(t *testing.T) {
+	srv, handler := newTestServer(t, testConfig())
+
+	added := decodeData[map[string]int](t, request(t, handler, "POST", "/api/user/add", map[string]string{
+		"handle": "coffee", "username": "Coffee", "password": "beans",
+	}), http.StatusCreated)
+
+	if user, err := srv.Users.ByHandle("coffee"); err != nil || user.ID != added["ID"] {
+		t.Fatalf("the user wasn't stored as %v: %v", added, err)
+	}
+
+	tests := []struct {
+		name string
+		body any
+		code string
+	}{
+		{"no handle", map[string]string{"password": "beans"}, "no_handle"},
+		{"handle too long", map[string]string{"handle": strings.Repeat("a", maxHandleLength+1), "password": "beans"}, "handle_too_long"},
+		{"no password", map[string]string{"handle": "tea"}, "no_password"},
+		{"duplicate handle", map[string]string{"handle": "coffee", "password": "beans"}, "user_not_added"},
+		{"invalid body", []byte("{"), "invalid_body"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			expectError(t, request(t, handler, "POST", "/api/user/add", test.body), http.StatusBadRequest, test.code)
+		})
+	}
+
+	t.Run("invalid fields", func(t *testing.T) {
+		w := request(t, handler, "POST", "/api/user/add", map[string]string{})
+		sent := expectError(t, w, http.StatusBadRequest, "invalid_fields")
+		if len(sent.Details) != 2 {
+			t.Fatalf("expected 2 details, got %v", sent.Details)
+		}
+	})
+}
+
+func TestLoginUser(t *testing.T) {
+	srv, handler := newTestServer(t, testConfig())
+	ID, _ := signUp(t, handler, "coffee")
+
+	t.Run("logged in", func(t *testing.T) {
+		w := request(t, handler, "POST", "/api/user/log-in", map[string]string{"handle": "coffee", "password": "coffee-password"})
+		if logged := decodeData[map[string]int](t, w, http.StatusOK); logged["ID"] != ID {
+			t.Fatalf("logged in as %v, expected %d", logged, ID)
+		}
+
+		for _, name := range []string{authCookieName, loggedInCookieName} {
+			cookie := findCookie(w, name)
+			if cookie == nil || cookie.SameSite != http.SameSiteLaxMode {
+				t.Fatalf("expected a SameSite=Lax %s cookie, got %v", name, cookie)
+			}
+		}
+
+		auth := findCookie(w, authCookieName)
+
+		for _, target := range []string{"/api/user/auth-to-id/" + auth.Value, "/api/user/auth-to-id"} {
+			toID := decodeData[map[string]int](t, request(t, handler, "GET", target, nil, auth), http.StatusOK)
+			if toID["ID"] != ID {
+				t.Fatalf("%s sent %v, expected %d", target, toID, ID)
+			}
+		}
+	})
+
+	t.Run("invalid credentials", func(t *testing.T) {
+		// Unknown handles aren't told apart from incorrect passwords
+		for _, login := range []map[string]string{
+			{"handle": "coffee", "password": "wrong"},
+			{"handle": "nobody", "password": "coffee-password"},
+		} {
+			expectError(t, request(t, handler, "POST", "/api/user/log-in", login), http.StatusUnauthorized, "invalid_credentials")
+		}
+	})
+
+	t.Run("invalid body", func(t *testing.T) {
+		expectError(t, request(t, handler, "POST", "/api/user/log-in", []byte("{")), http.StatusBadRequest, "invalid_body")
+	})
+
+	t.Run("not logged in", func(t *testing.T) {
+		expectError(t, request(t, handler, "GET", "/api/user/auth-to-id", nil), http.StatusUnauthorized, "not_logged_in")
+		expectError(t, request(t, handler, "GET", "/api/user/auth-to-id/unknown", nil), http.StatusNotFound, "not_found")
+	})
+
+	t.Run("banned", func(t *testing.T) {
+		bannedID, _ := signUp(t, handler, "banned")
+		if err := srv.Users.SetBanned(bannedID, true); err != nil {
+			t.Fatal(err)
+		}
+
+		login := map[string]string{"handle": "banned", "password": "banned-password"}
+		expectError(t, request(t, handler, "POST", "/api/user/log-in", login), http.StatusForbidden, "user_banned")
+	})
+}
+
+func TestUserFromID(t *testing.T) {
+	_, handler := newTestServer(t, testConfig())
+	ID, _ := signUp(t, handler, "coffee")
+
+	user := decodeData[PublicUser](t, request(t, handler, "GET", fmt.Sprintf("/api/user/get-user-from-id/%d", ID), nil), http.StatusOK)
+	if user.ID != ID || user.Handle != "coffee" {
+		t.Fatalf("got %+v, expected coffee (%d)", user, ID)
+	}
+
+	expectError(t, request(t, handler, "GET", "/api/user/get-user-from-id/999", nil), http.StatusNotFound, "not_found")
+	expectError(t, request(t, handler, "GET", "/api/user/get-user-from-id/a", nil), http.StatusBadRequest, "bad_request")
+}
+
+func TestSearchForUsers(t *testing.T) {
+	_, handler := newTestServer(t, testConfig())
+	signUp(t, handler, "coffee")
+	signUp(t, handler, "tea")
+
+	users := decodeData[[]PublicUser](t, request(t, handler, "GET", "/api/user/search?name=cof&from=0&range=10", nil), http.StatusOK)
+	if len(users) != 1 || users[0].Handle != "coffee" {
+		t.Fatalf("expected coffee, got %+v", users)
+	}
+
+	expectError(t, request(t, handler, "GET", "/api/user/search?name=milk&from=0&range=10", nil), http.StatusNotFound, "not_found")
+	expectError(t, request(t, handler, "GET", "/api/user/search?name=cof&from=a&range=10", nil), http.StatusBadRequest, "bad_request")
+}
+
+// notifications records the notifications sent to users
+type notifications chan string
+
+func (n notifications) Notify(user User, subject, message string) error {
+	n <- user.Handle + ": " + subject
+	return nil
+}
+
+func TestLoginLockout(t *testing.T) {
+	cfg := testConfig()
+	srv, handler := newTestServer(t, cfg)
+	signUp(t, handler, "coffee")
+
+	sent := make(notifications, 1)
+	srv.Notifier = sent
+
+	wrong := map[string]string{"handle": "coffee", "password": "wrong"}
+	for i := 0; i < cfg.Login.MaxAttempts; i++ {
+		expectError(t, request(t, handler, "POST", "/api/user/log-in", wrong), http.StatusUnauthorized, "invalid_credentials")
+	}
+
+	// Locked out, even with the correct password
+	correct := map[string]string{"handle": "coffee", "password": "coffee-password"}
+	w := request(t, handler, "POST", "/api/user/log-in", correct)
+	expectError(t, w, http.StatusTooManyRequests, "login_locked")
+	if w.Header().Get("Retry-After") == "" {
+		t.Fatal("expected Retry-After")
+	}
+
+	if notification := <-sent; notification != "coffee: Your account has been locked" {
+		t.Fatalf("got the notification %q", notification)
+	}
+}
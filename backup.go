@@ -0,0 +1,78 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/Blockitifluy/CoffeeCo/api/database"
+	"github.com/fatih/color"
+)
+
+// backupCommand backs up the database whilst the server is running and checks the backup.
+//
+// Usage: `coffeeco backup [path]`, by default the backup is put in `BACKUP_DIR`
+func backupCommand(args []string) int {
+	path := filepath.Join(mustLoadConfig().Backup.Dir, database.BackupName(time.Now()))
+	if len(args) > 0 {
+		path = args[0]
+	}
+
+	db := openDatabase()
+	defer db.Close()
+
+	if err := db.Backup(path); err != nil {
+		color.Red("Couldn't back up the database: %s", err.Error())
+		return 1
+	}
+
+	if err := database.CheckIntegrity(path); err != nil {
+		color.Red("The backup is corrupted (it's been removed): %s", err.Error())
+		os.Remove(path)
+		return 1
+	}
+
+	color.Green("Backed up the database to %s", path)
+	return 0
+}
+
+// restoreCommand checks a backup and restores it into a path that doesn't exist.
+//
+// Usage: `coffeeco restore {backup} [path]`, by default the backup is restored to `DB_PATH`
+// (stop the server and move the old database first)
+func restoreCommand(args []string) int {
+	if len(args) == 0 {
+		return usageError("restore")
+	}
+
+	dest := mustLoadConfig().DB.Path
+	if len(args) > 1 {
+		dest = args[1]
+	}
+
+	if err := database.Restore(args[0], dest); err != nil {
+		color.Red("Couldn't restore the backup: %s", err.Error())
+		return 1
+	}
+
+	color.Green("Restored %s to %s", args[0], dest)
+	return 0
+}
+
+// checkCommand checks the integrity of a database or backup.
+//
+// Usage: `coffeeco check [path]`, by default `DB_PATH` is checked
+func checkCommand(args []string) int {
+	path := mustLoadConfig().DB.Path
+	if len(args) > 0 {
+		path = args[0]
+	}
+
+	if err := database.CheckIntegrity(path); err != nil {
+		color.Red(err.Error())
+		return 1
+	}
+
+	color.Green("%s passed the integrity check", path)
+	return 0
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"sort"
+	"strconv"
+
+	"github.com/Blockitifluy/CoffeeCo/api"
+	"github.com/Blockitifluy/CoffeeCo/api/database"
+	"github.com/Blockitifluy/CoffeeCo/utility"
+	"github.com/fatih/color"
+)
+
+// command is run using `coffeeco {name} [args]`
+type command struct {
+	usage string                  // The arguments, e.g.: {backup} [path]
+	about string                  // What the command does (one line)
+	run   func(args []string) int // Returns the exit code, so deferred calls (e.g. closing the database) run before exiting
+}
+
+// commands are run using `coffeeco {command} [args]`, exiting with the code they return. Without a command the server is started
+var commands map[string]command
+
+func init() { // commands is set in init, because helpCommand uses it
+	commands = map[string]command{
+		"serve": {
+			usage: "[-config file.json] [-port :8000] [-debug] [-embed] ...",
+			about: "Starts the server (the default command)",
+			run:   serveCommand,
+		},
+		"migrate": {
+			usage: "[up|down|{version}]",
+			about: "Migrates the database up (default), down (reverts the last migration) or to a version",
+			run:   migrateCommand,
+		},
+		"user": {
+			usage: "{create|ban|unban|reset-password} ...",
+			about: "Creates, bans and resets the password of users",
+			run:   userCommand,
+		},
+		"seed": {
+			usage: "[-seed 1] [-users 25] [-follows 10] [-posts 5] [-comments 3] [-depth 3] [-reactions 10] [-images 10]",
+			about: "Generates users, follows, posts, comments, reactions and images (the same seed generates the same data)",
+			run:   seedCommand,
+		},
+		"export": {
+			usage: "[path]",
+			about: "Exports the users, posts and images as JSON (to stdout by default)",
+			run:   exportCommand,
+		},
+		"import": {
+			usage: "{path}",
+			about: "Imports an export into an empty database",
+			run:   importCommand,
+		},
+		"backup": {
+			usage: "[path]",
+			about: "Backs up the database (SQLite only) and checks the backup",
+			run:   backupCommand,
+		},
+		"restore": {
+			usage: "{backup} [path]",
+			about: "Checks a backup then restores it to a path that doesn't exist",
+			run:   restoreCommand,
+		},
+		"check": {
+			usage: "[path]",
+			about: "Checks the integrity of a database or backup",
+			run:   checkCommand,
+		},
+		"help": {
+			usage: "",
+			about: "Shows the commands",
+			run:   helpCommand,
+		},
+	}
+}
+
+// runCommand runs the command in args (without the executable), starting the server if there isn't one.
+// Returns the exit code
+func runCommand(args []string) int {
+	if len(args) == 0 || args[0] == "" || args[0][0] == '-' { // Only flags
+		return serveCommand(args)
+	}
+
+	cmd, ok := commands[args[0]]
+	if !ok {
+		color.Red("Unknown command %s, run `coffeeco help` to see the commands", args[0])
+		return 1
+	}
+
+	return cmd.run(args[1:])
+}
+
+// helpCommand shows the usage of every command
+func helpCommand(_ []string) int {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Printf("Usage: coffeeco {command} [args]\n\n")
+	for _, name := range names {
+		cmd := commands[name]
+		fmt.Printf("  %s %s\n      %s\n", name, cmd.usage, cmd.about)
+	}
+
+	return 0
+}
+
+// usageError shows how to use a command, returning the exit code
+func usageError(name string) int {
+	color.Red("Usage: coffeeco %s %s", name, commands[name].usage)
+	return 1
+}
+
+// openDatabase opens the database in the config, exiting if it can't be opened
+func openDatabase() *database.DB {
+	db, err := api.OpenDatabase(mustLoadConfig().DB)
+	if err != nil {
+		color.Red(err.Error())
+		os.Exit(1)
+	}
+
+	return db
+}
+
+// openStores opens the database (migrating it to the latest version) and creates the stores.
+// The database should be closed afterwards (unless there's an error)
+func openStores() (api.Stores, *database.DB, error) {
+	db := openDatabase()
+
+	applied, err := database.Up(db)
+	for _, migration := range applied {
+		fmt.Fprintf(os.Stderr, "Applied migration %d_%s\n", migration.Version, migration.Name) // Stdout may be an export
+	}
+
+	if err != nil {
+		db.Close()
+		return api.Stores{}, nil, fmt.Errorf("database couldn't be migrated: %w", err)
+	}
+
+	return api.NewSQLStores(db), db, nil
+}
+
+// serveCommand starts the server.
+//
+// Usage: `coffeeco serve [-config file.json] [-port :8000] [-debug] [-embed] ...`, see [api.ConfigFlags] for every flag
+func serveCommand(args []string) int {
+	var (
+		configPath string
+		embedded   bool
+		overrides  = map[string]string{}
+	)
+
+	flags := flag.NewFlagSet("serve", flag.ExitOnError)
+	flags.StringVar(&configPath, "config", "", "A JSON config file (CONFIG_FILE)")
+	flags.BoolVar(&embedded, "embed", embeddedFiles != nil, "Serves the frontend embedded in the executable, instead of the working directory")
+	api.ConfigFlags(flags, overrides)
+	flags.Parse(args)
+
+	cfg, err := loadConfig(configPath, overrides)
+	if err != nil {
+		color.Red("Invalid config: %s", err.Error())
+		return 1
+	}
+
+	slog.SetDefault(api.NewLogger(cfg.Log, os.Stderr))
+
+	var files fs.FS = utility.DiskFS{}
+	if embedded {
+		if embeddedFiles == nil {
+			color.Red("The frontend isn't embedded, build with `go build -tags embed`")
+			return 1
+		}
+		files = embeddedFiles
+	}
+
+	srv, err := api.NewServer(cfg, files)
+	if err != nil {
+		color.Red("Server couldn't be created: %s", err.Error())
+		return 1
+	}
+
+	if err := srv.Run(); err != nil { // Closes the server when it stops
+		color.Red(err.Error())
+		return 1
+	}
+
+	return 0
+}
+
+// migrateCommand migrates the database "up" (to the latest version), "down" (reverts the last migration) or to a version.
+// Returns the exit code, so the database is closed before exiting.
+//
+// Usage: `coffeeco migrate [up|down|{version}]`
+func migrateCommand(args []string) int {
+	target := "up"
+	if len(args) > 0 {
+		target = args[0]
+	}
+
+	version, convErr := strconv.Atoi(target)
+	if target != "up" && target != "down" && convErr != nil {
+		return usageError("migrate")
+	}
+
+	db := openDatabase()
+	defer db.Close()
+
+	var (
+		done []database.Migration
+		err  error
+	)
+
+	switch target {
+	case "up":
+		done, err = database.Up(db)
+	case "down":
+		done, err = database.Down(db)
+	default:
+		done, err = database.To(db, version)
+	}
+
+	for _, migration := range done {
+		fmt.Printf("Migrated %d_%s\n", migration.Version, migration.Name)
+	}
+
+	if err != nil {
+		color.Red("Couldn't migrate the database: %s", err.Error())
+		return 1
+	}
+
+	version, err = database.Version(db)
+	if err != nil {
+		color.Red("Couldn't get the database's version: %s", err.Error())
+		return 1
+	}
+
+	color.Green("Database is at version %d", version)
+	return 0
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"os"
+	"time"
+
+	"github.com/Blockitifluy/CoffeeCo/api"
+	"github.com/Blockitifluy/CoffeeCo/api/seed"
+	"github.com/fatih/color"
+)
+
+// seedCommand generates users, follows, posts, comments, reactions and images (see [seed.Generate]).
+// The same seed generates the same data into an empty database.
+//
+// Usage: `coffeeco seed [-seed 1] [-users 25] [-follows 10] [-posts 5] [-comments 3] [-depth 3] [-reactions 10] [-images 10]`
+func seedCommand(args []string) int {
+	options := seed.DefaultOptions
+
+	flags := flag.NewFlagSet("seed", flag.ExitOnError)
+	flags.Int64Var(&options.Seed, "seed", options.Seed, "The random seed, the same seed generates the same data")
+	flags.IntVar(&options.Users, "users", options.Users, "The amount of users")
+	flags.IntVar(&options.Follows, "follows", options.Follows, "The most users a user follows")
+	flags.IntVar(&options.Posts, "posts", options.Posts, "The most posts a user posts")
+	flags.IntVar(&options.Comments, "comments", options.Comments, "The most comments (or replies) a post or comment has")
+	flags.IntVar(&options.Depth, "depth", options.Depth, "How deep replies are nested (1 is only comments)")
+	flags.IntVar(&options.Reactions, "reactions", options.Reactions, "The most likes or dislikes a post or comment has")
+	flags.IntVar(&options.Images, "images", options.Images, "The amount of generated images")
+	flags.Parse(args)
+
+	stores, db, err := openStores()
+	if err != nil {
+		color.Red(err.Error())
+		return 1
+	}
+	defer db.Close()
+
+	start := time.Now()
+
+	result, err := seed.Generate(stores, options)
+	if err != nil {
+		color.Red("Couldn't seed the database: %s", err.Error())
+		return 1
+	}
+
+	color.Green(
+		"Generated %d users, %d follows, %d posts, %d comments, %d reactions and %d images in %s (password: %s)",
+		result.Users, result.Follows, result.Posts, result.Comments, result.Reactions, result.Images,
+		time.Since(start).Round(time.Millisecond), seed.Password,
+	)
+	return 0
+}
+
+// exportCommand exports the users, posts and images as JSON.
+//
+// Usage: `coffeeco export [path]`, by default the export is written to stdout
+func exportCommand(args []string) int {
+	stores, db, err := openStores()
+	if err != nil {
+		color.Red(err.Error())
+		return 1
+	}
+	defer db.Close()
+
+	var out io.Writer = os.Stdout
+	if len(args) > 0 {
+		file, err := os.OpenFile(args[0], os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600) // Contains passwords
+		if err != nil {
+			color.Red("Couldn't create the export: %s", err.Error())
+			return 1
+		}
+		defer file.Close()
+
+		out = file
+	}
+
+	data, err := api.ExportData(stores, out)
+	if err != nil {
+		color.Red("Couldn't export: %s", err.Error())
+		return 1
+	}
+
+	if len(args) > 0 { // Stdout only contains the export
+		color.Green("Exported %d users, %d posts and %d images to %s", len(data.Users), len(data.Posts), len(data.Images), args[0])
+	}
+
+	return 0
+}
+
+// importCommand imports an export into an empty database, keeping the IDs.
+//
+// Usage: `coffeeco import {path}`
+func importCommand(args []string) int {
+	if len(args) == 0 {
+		return usageError("import")
+	}
+
+	file, err := os.Open(args[0])
+	if err != nil {
+		color.Red("Couldn't open the export: %s", err.Error())
+		return 1
+	}
+	defer file.Close()
+
+	stores, db, err := openStores()
+	if err != nil {
+		color.Red(err.Error())
+		return 1
+	}
+	defer db.Close()
+
+	data, err := api.ImportData(stores, file)
+	if err != nil {
+		color.Red("Couldn't import: %s", err.Error())
+		return 1
+	}
+
+	color.Green("Imported %d users, %d posts and %d images", len(data.Users), len(data.Posts), len(data.Images))
+	return 0
+}
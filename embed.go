@@ -0,0 +1,18 @@
+//go:build embed
+
+package main
+
+import (
+	"embed"
+	"io/fs"
+)
+
+// embeddedFiles is the built frontend, so a release is a single executable.
+// `.env` isn't embedded (it can have secrets), it's read from the working directory.
+//
+// Build with `go build -tags embed` after running `npm run build`
+//
+//go:embed all:dist manifest.json
+var embedded embed.FS
+
+var embeddedFiles fs.FS = embedded
@@ -1,38 +1,74 @@
 package main
 
 import (
-	"flag"
+	"errors"
+	"io/fs"
 	"os"
 
 	"github.com/Blockitifluy/CoffeeCo/api"
-
 	"github.com/fatih/color"
 	"github.com/joho/godotenv"
 )
 
-func loadEnv() {
-	err := godotenv.Load()
-	if err != nil {
-		color.Red("Couldn't load env variables: %s", err.Error())
-		os.Exit(1)
+// readDotEnv reads `.env` in the working directory, nothing is read if it doesn't exist
+func readDotEnv() (map[string]string, error) {
+	env, err := godotenv.Read()
+	if errors.Is(err, fs.ErrNotExist) {
+		return map[string]string{}, nil
 	}
-	return
+
+	return env, err
 }
 
-func main() {
-	loadEnv()
+// loadConfig loads the config from (in order, later sources override earlier ones) the defaults, `.env`,
+// the config file (configPath or `CONFIG_FILE`), environment variables and flags (overrides)
+func loadConfig(configPath string, overrides map[string]string) (api.Config, error) {
+	cfg := api.DefaultConfig()
 
-	var (
-		port  string
-		debug bool
-	)
+	env, err := readDotEnv()
+	if err != nil {
+		return cfg, err
+	}
 
-	flag.StringVar(&port, "port", os.Getenv("DEFAULT_PORT"), "The hosted port")
-	flag.BoolVar(&debug, "debug", false, "Debugs the server")
+	if err := cfg.Apply(env); err != nil {
+		return cfg, err
+	}
+
+	if configPath == "" {
+		configPath = os.Getenv("CONFIG_FILE")
+	}
+	if configPath == "" {
+		configPath = env["CONFIG_FILE"]
+	}
 
-	flag.Parse()
+	if configPath != "" {
+		if err := cfg.LoadFile(configPath); err != nil {
+			return cfg, err
+		}
+	}
 
-	srv := api.NewServer(port, debug)
-	defer srv.Close() // Closes until the script ends
-	srv.Run()
+	if err := cfg.LoadEnv(); err != nil {
+		return cfg, err
+	}
+
+	if err := cfg.Apply(overrides); err != nil {
+		return cfg, err
+	}
+
+	return cfg, cfg.Validate()
+}
+
+// mustLoadConfig loads the config without flags (see loadConfig), exiting if it's invalid
+func mustLoadConfig() api.Config {
+	cfg, err := loadConfig("", nil)
+	if err != nil {
+		color.Red("Invalid config: %s", err.Error())
+		os.Exit(1)
+	}
+
+	return cfg
+}
+
+func main() {
+	os.Exit(runCommand(os.Args[1:]))
 }
@@ -2,12 +2,8 @@
 import subprocess
 import shutil
 import os
-from pathlib import Path
 from dotenv import load_dotenv
 
-DB_PATH = "temp/api/database/db.sql"
-TABLE_INIT_PATH = "temp/api/database/db-init"
-
 def clear_folder(folder: str):
     """Clears the contents of a folder
 
@@ -36,7 +32,7 @@ def does_file_exists(path: str) -> bool:
     return os.path.isfile(path)
 
 def build_with_vite() -> bool:
-    """Build a website using Vite
+    """Build a website using Vite (into `dist`, so it can be embedded)
 
     Returns:
         bool: successful
@@ -44,39 +40,20 @@ def build_with_vite() -> bool:
     vite_path = os.getenv("PATH_TO_VITE")
     if vite_path is None:
         return False
-    command = f"{vite_path} build --outDir temp/dist --manifest files.json"
+    command = f"{vite_path} build"
     code = subprocess.call(command.split(" "), shell=True)
     return code == 0
 
 def create_exe() -> bool:
-    """Build the server exe using Go
+    """Build the server exe using Go, with the frontend embedded (not .env)
 
     Returns:
         bool: successful
     """
-    code = subprocess.call(["go", "build", "-o", "temp/server.exe"], shell=True)
+    command = ["go", "build", "-tags", "embed", "-o", "temp/server.exe"]
+    code = subprocess.call(command, shell=True)
     return code == 0
 
-def create_database():
-    """Creates the database directory"""
-    os.mkdir("temp/api")
-    os.mkdir("temp/api/database")
-
-    Path(DB_PATH).touch()
-    Path(TABLE_INIT_PATH).touch()
-
-    shutil.copyfile("api/database/db-init", TABLE_INIT_PATH)
-
-def copy_from(src: str, dst: str):
-    """Copies a file
-
-    Args:
-        src (str): Copies from
-        dst (str): Pastes to
-    """
-    Path(dst).touch()
-    shutil.copyfile(src, dst)
-
 def start(name: str) -> tuple[bool, str]:
     """Starts the build process
 
@@ -101,12 +78,8 @@ def start(name: str) -> tuple[bool, str]:
 
     print("Building server")
     exe_success = create_exe()
-    if exe_success == 0:
-        return False, "Empty exe"
-
-    create_database()
-    copy_from(".env", "temp/.env")
-    copy_from("manifest.json", "temp/manifest.json")
+    if not exe_success:
+        return False, "Error with Go"
 
     return True, "Success"
 
@@ -22,7 +22,7 @@ def upload_post() -> str:
     upload_req = requests.post(UPLOAD_URL, data=content, headers=header, timeout=10)
     upload_req.raise_for_status()
 
-    return upload_req.text
+    return upload_req.json()["data"]["url"]
 
 def download_file(file_name: str):
     """Downloads and writes a jpeg
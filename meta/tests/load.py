@@ -0,0 +1,99 @@
+"""Concurrent load test, checks the database doesn't fail (e.g. `database is locked`) under load.
+
+Run whilst the server is running without rate limits (`RATE_LIMIT=false`): `python meta/tests/load.py`
+"""
+import random
+import string
+import sys
+from concurrent.futures import ThreadPoolExecutor
+
+import requests
+
+BASE_URL = "http://localhost:8000"
+WORKERS = 32
+REQUESTS_PER_WORKER = 50
+
+
+def random_handle() -> str:
+    """Creates a random handle, so the test can be run multiple times
+
+    Returns:
+        str: the handle
+    """
+    return "load" + "".join(random.choices(string.ascii_lowercase + string.digits, k=12))
+
+
+def create_user() -> tuple[int, str]:
+    """Creates and logs in an user
+
+    Returns:
+        tuple[int, str]: the user's ID and auth token
+    """
+    handle = random_handle()
+    user = {"username": "Load Test", "handle": handle, "password": "load", "email": ""}
+
+    requests.post(f"{BASE_URL}/api/user/add", json=user, timeout=10).raise_for_status()
+
+    login = requests.post(f"{BASE_URL}/api/user/log-in",
+                          json={"handle": handle, "password": "load"}, timeout=10)
+    login.raise_for_status()
+
+    auth = login.cookies["AuthToken"]
+    user_id = requests.get(f"{BASE_URL}/api/user/auth-to-id/{auth}", timeout=10)
+    user_id.raise_for_status()
+
+    return user_id.json()["data"]["ID"], auth
+
+
+def worker(user_id: int, auth: str) -> list[str]:
+    """Sends a mix of reads and writes
+
+    Args:
+        user_id (int): the user posting
+        auth (str): the user's auth token
+
+    Returns:
+        list[str]: the failed requests
+    """
+    errors: list[str] = []
+    session = requests.Session()
+    session.cookies.set("AuthToken", auth)
+
+    for i in range(REQUESTS_PER_WORKER):
+        kind = i % 5
+        if kind == 0:
+            post = {"postedBy": user_id, "content": f"Load test {i}", "parentID": -1, "images": ""}
+            res = session.post(f"{BASE_URL}/api/post/add", json=post, timeout=30)
+        elif kind == 1:
+            post = {"postedBy": user_id, "content": f"Load comment {i}", "parentID": 1, "images": ""}
+            res = session.post(f"{BASE_URL}/api/post/add", json=post, timeout=30)
+        elif kind == 2:
+            res = session.get(f"{BASE_URL}/api/post/feedlist/5", timeout=30)
+        elif kind == 3:
+            res = session.get(f"{BASE_URL}/api/post/get-user-post-history",
+                              params={"ID": user_id, "from": 0, "range": 10}, timeout=30)
+        else:
+            res = session.get(f"{BASE_URL}/api/user/get-user-from-id/{user_id}", timeout=30)
+
+        if res.status_code >= 500 or "locked" in res.text:
+            errors.append(f"{res.request.method} {res.url}: {res.status_code} {res.text}")
+
+    return errors
+
+
+if __name__ == "__main__":
+    print("Creating Users...")
+    users = [create_user() for _ in range(WORKERS)]
+
+    print(f"Sending {WORKERS * REQUESTS_PER_WORKER} requests...")
+    with ThreadPoolExecutor(max_workers=WORKERS) as pool:
+        results = pool.map(lambda user: worker(*user), users)
+        failed = [err for errors in results for err in errors]
+
+    if failed:
+        print(f"{len(failed)} requests failed:")
+        for err in failed[:20]:
+            print(err)
+        sys.exit(1)
+
+    print("Success!")
@@ -0,0 +1,58 @@
+"""Query plan tests, checks the hot queries use an index instead of scanning a table.
+
+Run after the server has migrated the database: `python meta/tests/query_plan.py [path to database]`
+"""
+import sqlite3
+import sys
+
+DB_PATH = "api/database/db.sql"
+
+# The hot queries of `api/store_sql.go`, with their expected index
+HOT_QUERIES: list[tuple[str, str]] = [
+    ("SELECT * FROM Users WHERE id = 1", "INTEGER PRIMARY KEY"),
+    ("SELECT id FROM Users WHERE auth = 'token'", "Users_auth"),
+    ("SELECT password, auth FROM Users WHERE handle = 'handle'", "sqlite_autoindex_Users"),
+    ("SELECT * FROM Posts WHERE id = 1", "INTEGER PRIMARY KEY"),
+    ("SELECT * FROM Posts WHERE ParentId IS NULL ORDER BY RANDOM() LIMIT 1", "Posts_parentID"),
+    ("SELECT * FROM Posts WHERE ParentId = 1 ORDER BY id LIMIT 10 OFFSET 0", "Posts_parentID"),
+    ("SELECT * FROM Posts WHERE ParentId IS NULL AND PostedBy = 1 ORDER BY id DESC LIMIT 10 OFFSET 0",
+     "Posts_PostedBy"),
+    ("SELECT * FROM Images WHERE url = 'url'", "sqlite_autoindex_Images"),
+]
+
+
+def query_plan(db: sqlite3.Connection, query: str) -> str:
+    """Gets the query plan of a query
+
+    Args:
+        db (sqlite3.Connection): the database
+        query (str): the query
+
+    Returns:
+        str: every step of the plan, one per line
+    """
+    rows = db.execute(f"EXPLAIN QUERY PLAN {query}").fetchall()
+    return "\n".join(row[-1] for row in rows)
+
+
+if __name__ == "__main__":
+    path = sys.argv[1] if len(sys.argv) > 1 else DB_PATH
+    connection = sqlite3.connect(f"file:{path}?mode=ro", uri=True)
+
+    failed = 0
+    for hot_query, index in HOT_QUERIES:
+        plan = query_plan(connection, hot_query)
+
+        if index not in plan or "SCAN" in plan:
+            failed += 1
+            print(f"FAIL {hot_query}\n  expected {index}, got:\n  {plan}")
+        else:
+            print(f"ok   {hot_query}")
+
+    connection.close()
+
+    if failed:
+        print(f"{failed} queries don't use an index")
+        sys.exit(1)
+
+    print("Success!")
@@ -0,0 +1,8 @@
+//go:build !embed
+
+package main
+
+import "io/fs"
+
+// embeddedFiles is nil, because the executable wasn't built with `-tags embed`
+var embeddedFiles fs.FS
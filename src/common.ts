@@ -1,8 +1,45 @@
 import { JSX } from 'solid-js';
 
+/**
+ * An invalid field of a request's body
+ */
+export interface FieldError {
+  /** The name of the field */
+  field: string;
+  /** A stable code, e.g. `post_too_long` */
+  code: string;
+  /** Shown to the user */
+  message: string;
+}
+
+/**
+ * The body of a failed api call
+ */
 export interface FetchError {
+  /** A stable code, e.g. `post_too_long` (see SERVER_METHODS.md) */
+  code: string;
   public: string;
-  message: string;
+  /** The invalid fields, if the body was invalid */
+  details?: FieldError[];
+  /** The request's `X-Request-ID` */
+  requestID?: string;
+}
+
+/**
+ * The body of a successful api call
+ */
+export interface FetchData<T> {
+  data: T;
+}
+
+/**
+ * Reads the `data` of a successful api call
+ * @param Res The response
+ * @returns The data
+ */
+export async function readData<T>(Res: Response): Promise<T> {
+  const body: FetchData<T> = await Res.json();
+  return body.data;
 }
 
 /**
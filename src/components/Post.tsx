@@ -1,5 +1,5 @@
 import { OcComment2, OcThumbsdown2, OcThumbsup2 } from 'solid-icons/oc';
-import { deformatImages, ValidImages } from '../requests/images';
+import { deformatImages, ImageMeta, ValidImages } from '../requests/images';
 import { DefaultUser, getUserFromID, User } from '../requests/user';
 import { Show, Component, createResource, For, createMemo } from 'solid-js';
 import ProfileIcon from '../assets/default-profile.png';
@@ -129,26 +129,45 @@ export interface PostImageProps {
    * @see ValidImages
    */
   images: string;
+  /**
+   * The placeholders of the uploaded images
+   */
+  meta?: ImageMeta[];
 }
 
 /**
  * A subcomponent of a {@link PostUI Post's} images
- * @param props an `images` string
+ * @param props an `images` string and it's placeholders
  */
 const PostImages: Component<PostImageProps> = (props) => {
   const images = createMemo(() => deformatImages(props.images));
 
+  const findMeta = (src: string) =>
+    props.meta?.find((meta) => src.endsWith(encodeURIComponent(meta.url)));
+
   return (
     <section class='flex justify-center gap-2'>
       <For each={images()}>
-        {(image) => (
-          <img
-            src={image.src}
-            width={400 / images().length}
-            class='rounded-lg'
-            alt={image.alt}
-          />
-        )}
+        {(image) => {
+          const meta = findMeta(image.src);
+
+          return (
+            <img
+              src={image.src}
+              width={400 / images().length}
+              class='rounded-lg'
+              alt={image.alt}
+              style={
+                meta
+                  ? {
+                      'aspect-ratio': `${meta.width} / ${meta.height}`,
+                      'background-color': meta.color,
+                    }
+                  : undefined
+              }
+            />
+          );
+        }}
       </For>
     </section>
   );
@@ -195,7 +214,7 @@ const PostUI: Component<PostProps> = (props) => {
           </RichText>
 
           <Show when={ValidImages.test(pst().images)}>
-            <PostImages images={pst().images} />
+            <PostImages images={pst().images} meta={pst().imageMeta} />
           </Show>
 
           <div class='flex-rows flex gap-3 text-lg'>
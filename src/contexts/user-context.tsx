@@ -1,6 +1,5 @@
 import * as Solid from 'solid-js';
 import * as UserReq from '../requests/user';
-import Cookies from 'js-cookie';
 import { ChildrenProps } from '../common';
 
 /**
@@ -18,7 +17,7 @@ async function GetUser(): Promise<UserReq.User | undefined> {
 
     if (!User) {
       // refresh page
-      Cookies.remove('AuthToken');
+      await UserReq.logOut();
 
       console.warn('GetUser: Invalid `AuthToken`, refreshing');
 
@@ -1,4 +1,4 @@
-import { FetchError } from '../common';
+import { FetchError, readData } from '../common';
 
 /**
  * Regex for Validating multiple images
@@ -27,6 +27,32 @@ export interface ImageObj {
   alt: string;
 }
 
+/**
+ * The placeholder information of an uploaded image, used before the image loads
+ */
+export interface ImageMeta {
+  /**
+   * The ID of the uploaded image
+   */
+  url: string;
+  /**
+   * The width of the image (in pixels)
+   */
+  width: number;
+  /**
+   * The height of the image (in pixels)
+   */
+  height: number;
+  /**
+   * The BlurHash of the image
+   */
+  blurHash: string;
+  /**
+   * The dominant colour of the image (hex)
+   */
+  color: string;
+}
+
 /**
  * A {@link ImageObj} represented as a string used for RegExp
  */
@@ -101,7 +127,8 @@ export async function uploadImage(img: Blob): Promise<string> {
     throw new Error(ResError.public);
   }
 
-  return Res.text();
+  const { url } = await readData<{ url: string }>(Res);
+  return url;
 }
 
 /**
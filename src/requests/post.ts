@@ -1,5 +1,5 @@
-import { ValidImages } from './images';
-import { FetchError } from '../common';
+import { ImageMeta, ValidImages } from './images';
+import { FetchError, readData } from '../common';
 
 /**
  * Database posts from The Database
@@ -18,6 +18,8 @@ export interface Post {
   whoDisliked: string;
 
   images: string;
+  /** The placeholders of the uploaded images */
+  imageMeta?: ImageMeta[];
 }
 
 /**
@@ -60,7 +62,7 @@ export async function getPostFromID(ID: number): Promise<Post> {
     throw new Error(ResError.public);
   }
 
-  return Res.json();
+  return readData<Post>(Res);
 }
 
 /**
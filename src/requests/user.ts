@@ -1,6 +1,7 @@
 import Cookies from 'js-cookie';
 import DefaultProfile from '../assets/default-profile.png';
-import { FetchError } from '../common';
+import { FetchError, readData } from '../common';
+import { ImageMeta } from './images';
 
 /**
  * Properties of a User:
@@ -34,6 +35,14 @@ export interface User {
    * A image link to the User's Profile
    */
   Profile: string;
+  /**
+   * The placeholder of the Profile (if uploaded)
+   */
+  ProfileMeta?: ImageMeta;
+  /**
+   * The placeholder of the Banner (if uploaded)
+   */
+  BannerMeta?: ImageMeta;
 
   /**
    * The followers count
@@ -57,18 +66,18 @@ export const DefaultUser: User = {
 
 /**
  * Get the Auth Token cookie
- * @returns The auth token (could be undefined)
+ * @returns The auth token (undefined when served over https, because the cookie is `HttpOnly`)
  */
 export function getAuth(): string | undefined {
   return Cookies.get('AuthToken');
 }
 
 /**
- * Checks if the user is logged in using the {@link getAuth} method
+ * Checks if the user is logged in using the `LoggedIn` cookie (set with the `AuthToken` cookie)
  * @returns Is logged in
  */
 export function isLoggedIn(): boolean {
-  return getAuth() !== undefined;
+  return Cookies.get('LoggedIn') !== undefined || getAuth() !== undefined;
 }
 
 /**
@@ -147,27 +156,37 @@ export async function newUser(handle: string, password: string, email: string) {
 
 /**
  * AuthToID goes through the database for a user with the same auth (as provided) and returns the id
- * @param auth (Optional) The `AuthToken` cookie
+ * @param auth (Optional) The auth, by default the `AuthToken` cookie is sent
  * @returns User's ID (-1 then there was an error)
  */
 export async function authToID(auth?: string): Promise<number> {
-  const authToken = auth ?? Cookies.get('AuthToken');
+  const URL =
+    auth === undefined
+      ? 'http://localhost:8000/api/user/auth-to-id'
+      : `http://localhost:8000/api/user/auth-to-id/${auth}`;
 
-  if (!authToken) throw new Error('AuthToken is undefined');
+  const Res = await fetch(URL, {
+    method: 'GET',
+    mode: 'no-cors',
+  });
 
-  const Res = await fetch(
-    `http://localhost:8000/api/user/auth-to-id/${authToken}`,
-    {
-      method: 'GET',
-      mode: 'no-cors',
-    },
-  );
+  if (Res.status === 401) throw new Error('AuthToken is undefined');
 
   if (!Res.ok) {
     return -1;
   }
 
-  return parseInt(await Res.text());
+  const { ID } = await readData<{ ID: number }>(Res);
+  return ID;
+}
+
+/**
+ * LogOut removes the `AuthToken` cookie (which can't be removed by the frontend over https)
+ */
+export async function logOut(): Promise<void> {
+  await fetch('http://localhost:8000/api/user/log-out', {
+    method: 'POST',
+  });
 }
 
 /**
@@ -186,15 +205,15 @@ export async function getUserFromID(ID: number): Promise<User> {
     },
   );
 
-  const json = await Res.json();
-
   if (!Res.ok) {
-    console.error(json);
+    const ResError: FetchError = await Res.json();
 
-    throw new Error(json.public);
+    console.error(ResError);
+
+    throw new Error(ResError.public);
   }
 
-  return json;
+  return readData<User>(Res);
 }
 
 /**
@@ -6,6 +6,7 @@ import { Component, createResource, For, Show } from 'solid-js';
 import { getPostsFromQuery, Post, postFeedList } from '../requests/post';
 import PostUI from '../components/post';
 import { searchForUsers, User } from '../requests/user';
+import { readData } from '../common';
 
 const LoadAmount = 10;
 
@@ -24,7 +25,7 @@ const handleScrollSearch: PostListHandler = async (get, set) => {
       get.times * LoadAmount,
       10,
     ),
-    json: Post[] = await NewComments.json();
+    json: Post[] = await readData(NewComments);
 
   if (!NewComments.ok) {
     console.error('PostList: Could not load posts');
@@ -56,7 +57,7 @@ const handleScrollAll: PostListHandler = async (get, set) => {
 
   try {
     const Res = await postFeedList(LoadAmount),
-      Posts: Post[] = await Res.json();
+      Posts: Post[] = await readData(Res);
 
     set('Posts', get.Posts.concat(...Posts));
   } catch (error) {
@@ -106,7 +107,7 @@ const UserList: Component<{ search: string }> = (props) => {
   const [users] = createResource<User[]>(async () => {
     try {
       const Res = await searchForUsers(props.search, 0, 5);
-      return await Res.json();
+      return await readData<User[]>(Res);
     } catch (error) {
       console.error(error);
       return [];
@@ -22,7 +22,7 @@ import { useParams } from '@solidjs/router';
 import { DefaultUser, getUserFromID, isLoggedIn, User } from '../requests/user';
 import { Meta, Title } from '@solidjs/meta';
 import { createStore } from 'solid-js/store';
-import { NoEnter, Status, Statuses } from '../common';
+import { NoEnter, readData, Status, Statuses } from '../common';
 import { OcPaperairplane2 } from 'solid-icons/oc';
 import TextareaAutosize from 'solid-textarea-autosize';
 import PostList, { PostListHandler } from '../components/post-list';
@@ -119,7 +119,7 @@ const Main: Component = () => {
       10,
     );
 
-    const json: Post[] = await NewComments.json();
+    const json: Post[] = await readData(NewComments);
 
     if (!NewComments.ok) {
       console.error('PostList: Could not load posts');
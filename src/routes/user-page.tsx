@@ -15,6 +15,7 @@ import { Meta, Title } from '@solidjs/meta';
 import { getUserPostHistory, Post } from '../requests/post';
 import PostUI from '../components/post';
 import PostList, { PostListHandler } from '../components/post-list';
+import { readData } from '../common';
 
 /**
  * The Page User (Stored in a Context)
@@ -85,7 +86,7 @@ const UserPage: Component = () => {
     set('loading', true);
 
     const NewComments = await getUserPostHistory(ID, get.times * postsLoad, 10),
-      json: Post[] = await NewComments.json();
+      json: Post[] = await readData(NewComments);
 
     if (!NewComments.ok) {
       console.error('PostList: Could not load posts');
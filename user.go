@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/Blockitifluy/CoffeeCo/api"
+	"github.com/fatih/color"
+)
+
+// userCommands are run using `coffeeco user {command} {handle} [flags]`
+var userCommands = map[string]func(stores api.Stores, handle string, args []string) int{
+	"create":         createUser,
+	"ban":            func(stores api.Stores, handle string, _ []string) int { return banUser(stores, handle, true) },
+	"unban":          func(stores api.Stores, handle string, _ []string) int { return banUser(stores, handle, false) },
+	"reset-password": resetPassword,
+}
+
+// userCommand administers users.
+//
+// Usage:
+//
+//   - `coffeeco user create {handle} [-username name] [-email email] [-password password]`
+//   - `coffeeco user ban {handle}`, the user can't log in or use their auth token
+//   - `coffeeco user unban {handle}`
+//   - `coffeeco user reset-password {handle} [-password password]`, logs out the user everywhere (a new auth token)
+//
+// Passwords are read from stdin when -password isn't given
+func userCommand(args []string) int {
+	if len(args) < 2 {
+		return usageError("user")
+	}
+
+	run, ok := userCommands[args[0]]
+	if !ok {
+		return usageError("user")
+	}
+
+	stores, db, err := openStores()
+	if err != nil {
+		color.Red(err.Error())
+		return 1
+	}
+	defer db.Close()
+
+	return run(stores, args[1], args[2:])
+}
+
+// readPassword reads a password from stdin (a line), when password is empty
+func readPassword(password string) (string, error) {
+	if password != "" {
+		return password, nil
+	}
+
+	fmt.Print("Password: ")
+
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return "", fmt.Errorf("couldn't read the password: %w", err)
+	}
+
+	password = strings.TrimRight(line, "\r\n")
+	if password == "" {
+		return "", errors.New("the password is empty")
+	}
+
+	return password, nil
+}
+
+func createUser(stores api.Stores, handle string, args []string) int {
+	var username, email, password string
+
+	flags := flag.NewFlagSet("user create", flag.ExitOnError)
+	flags.StringVar(&username, "username", handle, "The non-unique name of the user")
+	flags.StringVar(&email, "email", "", "The email of the user")
+	flags.StringVar(&password, "password", "", "The password (read from stdin if not given)")
+	flags.Parse(args)
+
+	if len(handle) > 24 {
+		color.Red("The handle is too long (24 limit)")
+		return 1
+	}
+
+	password, err := readPassword(password)
+	if err != nil {
+		color.Red(err.Error())
+		return 1
+	}
+
+	user := api.User{
+		PublicUser: &api.PublicUser{Username: username, Handle: handle},
+		Email:      email,
+	}
+	user.SetPassword(password)
+
+	ID, err := stores.Users.Add(user)
+	if err != nil {
+		color.Red("Couldn't create the user: %s", err.Error())
+		return 1
+	}
+
+	color.Green("Created @%s (ID %d)", handle, ID)
+	return 0
+}
+
+// findUser gets the user with the handle, showing an error if it doesn't exist
+func findUser(stores api.Stores, handle string) (api.User, bool) {
+	user, err := stores.Users.ByHandle(handle)
+	if err != nil {
+		color.Red("Couldn't find @%s: %s", handle, err.Error())
+		return user, false
+	}
+
+	return user, true
+}
+
+func banUser(stores api.Stores, handle string, banned bool) int {
+	user, ok := findUser(stores, handle)
+	if !ok {
+		return 1
+	}
+
+	if err := stores.Users.SetBanned(user.ID, banned); err != nil {
+		color.Red("Couldn't change the ban of @%s: %s", handle, err.Error())
+		return 1
+	}
+
+	if banned {
+		color.Green("Banned @%s", handle)
+	} else {
+		color.Green("Unbanned @%s", handle)
+	}
+
+	return 0
+}
+
+func resetPassword(stores api.Stores, handle string, args []string) int {
+	var password string
+
+	flags := flag.NewFlagSet("user reset-password", flag.ExitOnError)
+	flags.StringVar(&password, "password", "", "The new password (read from stdin if not given)")
+	flags.Parse(args)
+
+	user, ok := findUser(stores, handle)
+	if !ok {
+		return 1
+	}
+
+	password, err := readPassword(password)
+	if err != nil {
+		color.Red(err.Error())
+		return 1
+	}
+
+	oldAuth := user.Auth
+
+	user.SetPassword(password)
+	if err := stores.Users.SetPassword(user.ID, api.HashPassword(password), user.Auth); err != nil {
+		color.Red("Couldn't reset the password of @%s: %s", handle, err.Error())
+		return 1
+	}
+
+	if user.Auth == oldAuth { // The auth token is generated from the password, so it only changes with it
+		color.Green("Reset the password of @%s (unchanged)", handle)
+		return 0
+	}
+
+	color.Green("Reset the password of @%s, they have been logged out", handle)
+	return 0
+}
@@ -0,0 +1,331 @@
+package utility
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/andybalholm/brotli"
+)
+
+// CompressMinSize is the smallest body (in bytes) that is compressed,
+// smaller bodies aren't worth the overhead
+const CompressMinSize int = 1024
+
+// Supported Content-Encodings, in order of preference
+const (
+	EncodingBrotli   = "br"
+	EncodingGZip     = "gzip"
+	EncodingIdentity = "identity"
+)
+
+// dynamicBrotliLevel is the brotli level used on responses, higher levels are too slow
+const dynamicBrotliLevel = 5
+
+var (
+	gzipPool = sync.Pool{
+		New: func() any { return gzip.NewWriter(io.Discard) },
+	}
+	brotliPool = sync.Pool{
+		New: func() any { return brotli.NewWriterLevel(io.Discard, dynamicBrotliLevel) },
+	}
+)
+
+// NegotiateEncoding picks the best supported encoding from an `Accept-Encoding` header.
+//
+// Returns [EncodingIdentity] when neither brotli or gzip are accepted
+func NegotiateEncoding(acceptEncoding string) string {
+	qualities := map[string]float64{}
+
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+
+		quality := 1.0
+		if key, value, ok := strings.Cut(strings.TrimSpace(params), "="); ok && strings.TrimSpace(key) == "q" {
+			if q, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil {
+				quality = q
+			}
+		}
+
+		qualities[name] = quality
+	}
+
+	best, bestQuality := EncodingIdentity, 0.0
+	for _, encoding := range []string{EncodingBrotli, EncodingGZip} {
+		quality, ok := qualities[encoding]
+		if !ok {
+			quality, ok = qualities["*"]
+		}
+
+		if ok && quality > bestQuality {
+			best, bestQuality = encoding, quality
+		}
+	}
+
+	return best
+}
+
+// BrotliBytes compress a byte array using brotli (at the best compression),
+// only use on content that is compressed once
+func BrotliBytes(content []byte) ([]byte, error) {
+	var b bytes.Buffer
+	bw := brotli.NewWriterLevel(&b, brotli.BestCompression)
+	_, err := bw.Write(content)
+	if closeErr := bw.Close(); err == nil {
+		err = closeErr
+	}
+
+	return b.Bytes(), err
+}
+
+// IsCompressedMime checks if a Content-Type is already compressed (images, video, archives etc.),
+// so compressing it again would only waste time
+func IsCompressedMime(contentType string) bool {
+	mime, _, _ := strings.Cut(contentType, ";")
+	mime = strings.ToLower(strings.TrimSpace(mime))
+
+	switch {
+	case mime == "image/svg+xml":
+		return false
+	case strings.HasPrefix(mime, "image/"),
+		strings.HasPrefix(mime, "video/"),
+		strings.HasPrefix(mime, "audio/"):
+		return true
+	}
+
+	switch mime {
+	case "application/zip", "application/gzip", "application/x-gzip",
+		"application/x-brotli", "application/pdf", "font/woff", "font/woff2":
+		return true
+	}
+
+	return false
+}
+
+// compressWriter buffers the start of a response, until it knows if the response should be compressed
+type compressWriter struct {
+	http.ResponseWriter
+
+	encoding    string
+	ifNoneMatch string // The request's `If-None-Match`, before [DecodedETags]
+	head        bool   // HEAD requests usually don't write a body, so Content-Length is used instead
+	code        int
+	buf         bytes.Buffer
+	decided     bool
+	encoder     io.WriteCloser // nil when the response isn't compressed
+
+	took    time.Duration // The time spent compressing
+	observe CompressObserver
+}
+
+// encode compresses b, timing it
+func (cw *compressWriter) encode(b []byte) (int, error) {
+	start := time.Now()
+	defer func() { cw.took += time.Since(start) }()
+
+	return cw.encoder.Write(b)
+}
+
+func (cw *compressWriter) WriteHeader(code int) {
+	if cw.code == 0 {
+		cw.code = code
+	}
+}
+
+func (cw *compressWriter) Write(b []byte) (int, error) {
+	if cw.code == 0 {
+		cw.code = http.StatusOK
+	}
+
+	if cw.decided {
+		if cw.encoder != nil {
+			return cw.encode(b)
+		}
+		return cw.ResponseWriter.Write(b)
+	}
+
+	cw.buf.Write(b)
+	if cw.buf.Len() >= CompressMinSize {
+		if err := cw.decide(); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(b), nil
+}
+
+// decide writes the header and starts compressing (if allowed), then flushes the buffer
+func (cw *compressWriter) decide() error {
+	cw.decided = true
+	header := cw.Header()
+
+	compress := cw.shouldCompress()
+
+	// Strong ETags have to differ between encodings, a 304 has the ETag the client has (see [DecodedETags])
+	if eTag := header.Get("ETag"); eTag != "" {
+		encoded := EncodedETag(eTag, cw.encoding)
+		if compress || (cw.code == http.StatusNotModified && ETagMatches(cw.ifNoneMatch, encoded)) {
+			header.Set("ETag", encoded)
+		}
+	}
+
+	// A HEAD without a body only needs the headers, encoding nothing would give it a Content-Length
+	if compress && !(cw.head && cw.buf.Len() == 0) {
+		switch cw.encoding {
+		case EncodingBrotli:
+			bw := brotliPool.Get().(*brotli.Writer)
+			bw.Reset(cw.ResponseWriter)
+			cw.encoder = bw
+		case EncodingGZip:
+			gw := gzipPool.Get().(*gzip.Writer)
+			gw.Reset(cw.ResponseWriter)
+			cw.encoder = gw
+		}
+	}
+
+	if compress {
+		header.Set("Content-Encoding", cw.encoding)
+		header.Del("Content-Length")
+		header.Del("Accept-Ranges") // Ranges are of the uncompressed body
+	}
+
+	cw.ResponseWriter.WriteHeader(cw.code)
+
+	if cw.buf.Len() == 0 {
+		return nil
+	}
+
+	var err error
+	if cw.encoder != nil {
+		_, err = cw.encode(cw.buf.Bytes())
+	} else {
+		_, err = cw.ResponseWriter.Write(cw.buf.Bytes())
+	}
+	cw.buf.Reset()
+
+	return err
+}
+
+func (cw *compressWriter) shouldCompress() bool {
+	header := cw.Header()
+
+	size := cw.buf.Len()
+	if cw.head && size == 0 {
+		size, _ = strconv.Atoi(header.Get("Content-Length"))
+	}
+
+	switch {
+	case cw.encoding == EncodingIdentity,
+		size < CompressMinSize,
+		cw.code < 200, cw.code == http.StatusNoContent,
+		cw.code == http.StatusPartialContent, cw.code == http.StatusNotModified,
+		header.Get("Content-Encoding") != "",
+		header.Get("Content-Range") != "",
+		IsCompressedMime(header.Get("Content-Type")):
+		return false
+	}
+
+	return true
+}
+
+// close finishes the response, the writer can't be used afterwards
+func (cw *compressWriter) close() error {
+	if !cw.decided {
+		if cw.code == 0 { // Nothing was written
+			return nil
+		}
+
+		if err := cw.decide(); err != nil {
+			return err
+		}
+	}
+
+	if cw.encoder == nil {
+		return nil
+	}
+
+	start := time.Now()
+	err := cw.encoder.Close()
+	cw.took += time.Since(start)
+
+	if cw.observe != nil {
+		cw.observe(cw.encoding, cw.took)
+	}
+
+	switch encoder := cw.encoder.(type) {
+	case *brotli.Writer:
+		brotliPool.Put(encoder)
+	case *gzip.Writer:
+		gzipPool.Put(encoder)
+	}
+	cw.encoder = nil
+
+	return err
+}
+
+// Flush sends any buffered data to the client
+func (cw *compressWriter) Flush() {
+	if !cw.decided && cw.code != 0 {
+		cw.decide()
+	}
+
+	if flusher, ok := cw.encoder.(interface{ Flush() error }); ok {
+		flusher.Flush()
+	}
+
+	if flusher, ok := cw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap is used by [http.ResponseController]
+func (cw *compressWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+// CompressObserver is called after a response is compressed, with the time spent compressing
+type CompressObserver func(encoding string, took time.Duration)
+
+// CompressHandler is a middleware that compresses responses using gzip or brotli,
+// based on the request's `Accept-Encoding`.
+//
+// Skips bodies smaller than [CompressMinSize], already compressed media (see [IsCompressedMime])
+// and responses that already have a `Content-Encoding`. Compressed responses have their ETag suffixed
+// with the encoding (see [EncodedETag]), the suffix is removed from `If-None-Match` for the handler.
+// HEAD requests get the same headers as GET.
+// observe (which can be nil) is called after each compressed response
+func CompressHandler(next http.Handler, observe CompressObserver) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+
+		encoding := NegotiateEncoding(r.Header.Get("Accept-Encoding"))
+		if encoding == EncodingIdentity {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		cw := &compressWriter{
+			ResponseWriter: w,
+			encoding:       encoding,
+			ifNoneMatch:    r.Header.Get("If-None-Match"),
+			head:           r.Method == http.MethodHead,
+			observe:        observe,
+		}
+		defer cw.close()
+
+		if cw.ifNoneMatch != "" {
+			r.Header.Set("If-None-Match", DecodedETags(cw.ifNoneMatch, encoding))
+		}
+
+		next.ServeHTTP(cw, r)
+	})
+}
@@ -0,0 +1,286 @@
+package utility
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/andybalholm/brotli"
+)
+
+// compressBody is big and repetitive enough to always be compressed
+var compressBody = strings.Repeat("CoffeeCo compresses text responses. ", 100)
+
+// eTagHandler sends compressBody with an ETag, or a 304 when `If-None-Match` matches it
+func eTagHandler(eTag string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Header().Set("ETag", eTag)
+
+		if ETagMatches(r.Header.Get("If-None-Match"), eTag) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		io.WriteString(w, compressBody)
+	})
+}
+
+func TestNegotiateEncoding(t *testing.T) {
+	tests := []struct {
+		acceptEncoding string
+		want           string
+	}{
+		{"", EncodingIdentity},
+		{"gzip", EncodingGZip},
+		{"gzip, deflate, br", EncodingBrotli},
+		{"br;q=0.5, gzip", EncodingGZip},
+		{"br;q=0.5, gzip;q=0.8", EncodingGZip},
+		{"GZIP;Q=1", EncodingGZip},
+		{"br;q=0, gzip;q=0", EncodingIdentity},
+		{"*", EncodingBrotli},
+		{"*;q=0.5, br;q=0.1", EncodingGZip},
+		{"*;q=0", EncodingIdentity},
+		{"gzip;q=0, *", EncodingBrotli},
+		{"deflate, identity", EncodingIdentity},
+	}
+
+	for _, test := range tests {
+		if got := NegotiateEncoding(test.acceptEncoding); got != test.want {
+			t.Errorf("NegotiateEncoding(%q) = %q, want %q", test.acceptEncoding, got, test.want)
+		}
+	}
+}
+
+func TestEncodedETag(t *testing.T) {
+	tests := []struct {
+		eTag, encoding string
+		want           string
+	}{
+		{`"abc"`, EncodingGZip, `"abc-gzip"`},
+		{`"abc"`, EncodingBrotli, `"abc-br"`},
+		{`W/"abc"`, EncodingGZip, `W/"abc-gzip"`},
+		{`"abc"`, EncodingIdentity, `"abc"`},
+		{`"abc"`, "", `"abc"`},
+	}
+
+	for _, test := range tests {
+		if got := EncodedETag(test.eTag, test.encoding); got != test.want {
+			t.Errorf("EncodedETag(%q, %q) = %q, want %q", test.eTag, test.encoding, got, test.want)
+		}
+	}
+}
+
+func TestDecodedETags(t *testing.T) {
+	tests := []struct {
+		ifNoneMatch, encoding string
+		want                  string
+	}{
+		{`"abc-gzip"`, EncodingGZip, `"abc-gzip", "abc"`},
+		{`"abc-br", "def"`, EncodingBrotli, `"abc-br", "def", "abc"`},
+		{`W/"abc-gzip"`, EncodingGZip, `W/"abc-gzip", W/"abc"`},
+		{`"abc-br"`, EncodingGZip, `"abc-br"`},
+		{`"abc"`, EncodingGZip, `"abc"`},
+		{"*", EncodingGZip, "*"},
+	}
+
+	for _, test := range tests {
+		got := DecodedETags(test.ifNoneMatch, test.encoding)
+		if got != test.want {
+			t.Errorf("DecodedETags(%q, %q) = %q, want %q", test.ifNoneMatch, test.encoding, got, test.want)
+		}
+
+		// Every decoded ETag has to match it's encoded ETag
+		for _, match := range strings.Split(test.ifNoneMatch, ",") {
+			match = strings.TrimSpace(match)
+			if !ETagMatches(got, match) {
+				t.Errorf("DecodedETags(%q, %q) doesn't match %s", test.ifNoneMatch, test.encoding, match)
+			}
+		}
+	}
+}
+
+func TestCompressHandler(t *testing.T) {
+	tests := []struct {
+		acceptEncoding string
+		wantEncoding   string
+		wantETag       string
+		decode         func(io.Reader) (io.Reader, error)
+	}{
+		{"br, gzip", EncodingBrotli, `"abc-br"`, func(r io.Reader) (io.Reader, error) { return brotli.NewReader(r), nil }},
+		{"gzip", EncodingGZip, `"abc-gzip"`, func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) }},
+		{"", "", `"abc"`, func(r io.Reader) (io.Reader, error) { return r, nil }},
+	}
+
+	handler := CompressHandler(eTagHandler(`"abc"`), nil)
+	for _, test := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("Accept-Encoding", test.acceptEncoding)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+
+		if got := w.Header().Get("Content-Encoding"); got != test.wantEncoding {
+			t.Errorf("Accept-Encoding %q: Content-Encoding = %q, want %q", test.acceptEncoding, got, test.wantEncoding)
+		}
+		if got := w.Header().Get("ETag"); got != test.wantETag {
+			t.Errorf("Accept-Encoding %q: ETag = %q, want %q", test.acceptEncoding, got, test.wantETag)
+		}
+
+		reader, err := test.decode(w.Body)
+		if err != nil {
+			t.Fatalf("Accept-Encoding %q: couldn't decode the body: %v", test.acceptEncoding, err)
+		}
+		if body, err := io.ReadAll(reader); err != nil || string(body) != compressBody {
+			t.Errorf("Accept-Encoding %q: the decoded body isn't the same (err %v)", test.acceptEncoding, err)
+		}
+	}
+}
+
+func TestCompressHandlerObserve(t *testing.T) {
+	var observed []string
+	handler := CompressHandler(eTagHandler(`"abc"`), func(encoding string, took time.Duration) {
+		observed = append(observed, encoding)
+	})
+
+	for _, acceptEncoding := range []string{"br", "gzip", ""} {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("Accept-Encoding", acceptEncoding)
+		handler.ServeHTTP(httptest.NewRecorder(), r)
+	}
+
+	// Uncompressed responses aren't observed
+	if strings.Join(observed, ",") != "br,gzip" {
+		t.Fatalf("observed %v, want [br gzip]", observed)
+	}
+}
+
+func TestCompressHandlerSkips(t *testing.T) {
+	tests := map[string]http.HandlerFunc{
+		"small body": func(w http.ResponseWriter, r *http.Request) {
+			io.WriteString(w, "small")
+		},
+		"compressed mime": func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "image/png")
+			io.WriteString(w, compressBody)
+		},
+		"already encoded": func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Encoding", EncodingGZip)
+			io.WriteString(w, compressBody)
+		},
+		"range": func(w http.ResponseWriter, r *http.Request) {
+			http.ServeContent(w, r, "body.txt", time.Time{}, strings.NewReader(compressBody))
+		},
+	}
+
+	for name, next := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("Accept-Encoding", EncodingGZip)
+		if name == "range" {
+			r.Header.Set("Range", "bytes=0-2047")
+		}
+		w := httptest.NewRecorder()
+		CompressHandler(next, nil).ServeHTTP(w, r)
+
+		if got := w.Header().Get("Content-Encoding"); name != "already encoded" && got != "" {
+			t.Errorf("%s: Content-Encoding = %q, want none", name, got)
+		}
+		if got := w.Header().Get("Vary"); got != "Accept-Encoding" {
+			t.Errorf("%s: Vary = %q, want Accept-Encoding", name, got)
+		}
+	}
+}
+
+func TestCompressHandlerNotModified(t *testing.T) {
+	tests := []struct {
+		name           string
+		acceptEncoding string
+		ifNoneMatch    string
+		wantStatus     int
+		wantETag       string
+	}{
+		{"encoded ETag", EncodingGZip, `"abc-gzip"`, http.StatusNotModified, `"abc-gzip"`},
+		{"identity ETag", EncodingGZip, `"abc"`, http.StatusNotModified, `"abc"`},
+		{"other encoding", EncodingGZip, `"abc-br"`, http.StatusOK, `"abc-gzip"`},
+		{"identity request", "", `"abc"`, http.StatusNotModified, `"abc"`},
+		{"changed", EncodingBrotli, `"def-br"`, http.StatusOK, `"abc-br"`},
+	}
+
+	handler := CompressHandler(eTagHandler(`"abc"`), nil)
+	for _, test := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("Accept-Encoding", test.acceptEncoding)
+		r.Header.Set("If-None-Match", test.ifNoneMatch)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+
+		if w.Code != test.wantStatus {
+			t.Errorf("%s: status = %d, want %d", test.name, w.Code, test.wantStatus)
+		}
+		if got := w.Header().Get("ETag"); got != test.wantETag {
+			t.Errorf("%s: ETag = %q, want %q", test.name, got, test.wantETag)
+		}
+		if w.Code == http.StatusNotModified && (w.Body.Len() != 0 || w.Header().Get("Content-Encoding") != "") {
+			t.Errorf("%s: a 304 has a body or a Content-Encoding", test.name)
+		}
+	}
+}
+
+func TestCompressHandlerHead(t *testing.T) {
+	handlers := map[string]http.Handler{
+		// Handlers usually write the body for HEAD, which net/http discards
+		"body": eTagHandler(`"abc"`),
+		// http.ServeContent only sets Content-Length for HEAD
+		"no body": http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("ETag", `"abc"`)
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			http.ServeContent(w, r, "", time.Time{}, strings.NewReader(compressBody))
+		}),
+	}
+
+	client := &http.Client{Transport: &http.Transport{DisableCompression: true}}
+	for name, handler := range handlers {
+		server := httptest.NewServer(CompressHandler(handler, nil))
+
+		responses := map[string]*http.Response{}
+		for _, method := range []string{http.MethodGet, http.MethodHead} {
+			r, _ := http.NewRequest(method, server.URL, nil)
+			r.Header.Set("Accept-Encoding", EncodingGZip)
+
+			resp, err := client.Do(r)
+			if err != nil {
+				t.Fatalf("%s: couldn't send %s: %v", name, method, err)
+			}
+			body, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+
+			if method == http.MethodHead && len(body) != 0 {
+				t.Errorf("%s: HEAD has a body", name)
+			}
+			if method == http.MethodGet && bytes.Equal(body, []byte(compressBody)) {
+				t.Errorf("%s: GET isn't compressed", name)
+			}
+			responses[method] = resp
+		}
+		server.Close()
+
+		headers := []string{"ETag", "Content-Encoding"}
+		if name == "body" {
+			headers = append(headers, "Content-Length")
+		}
+
+		get, head := responses[http.MethodGet], responses[http.MethodHead]
+		for _, header := range headers {
+			if get.Header.Get(header) != head.Header.Get(header) {
+				t.Errorf("%s: HEAD's %s is %q, GET's is %q", name, header, head.Header.Get(header), get.Header.Get(header))
+			}
+		}
+		if get.Header.Get("ETag") != `"abc-gzip"` {
+			t.Errorf("%s: ETag = %q, want %q", name, get.Header.Get("ETag"), `"abc-gzip"`)
+		}
+	}
+}
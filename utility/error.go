@@ -1,8 +1,10 @@
 package utility
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
+	"log/slog"
 	"net/http"
 )
 
@@ -15,27 +17,123 @@ const (
 	PublicNotFoundError = "Nothing was Found"
 )
 
+// Error codes used when an [HTTPError] doesn't have a more specific code, see [StatusCode]
+const (
+	CodeBadRequest       = "bad_request"
+	CodeUnauthorised     = "unauthorised"
+	CodeForbidden        = "forbidden"
+	CodeNotFound         = "not_found"
+	CodeMethodNotAllowed = "method_not_allowed"
+	CodeLengthRequired   = "length_required"
+	CodeTooLarge         = "too_large"
+	CodeUnsupportedMedia = "unsupported_media_type"
+	CodeTooManyRequests  = "too_many_requests"
+	CodeInternal         = "internal_error"
+	CodeUnavailable      = "unavailable"
+	CodeInvalidFields    = "invalid_fields" // More than one field is invalid, see [HTTPError.Details]
+)
+
+// StatusCode is the default error code of an HTTP status
+func StatusCode(status int) string {
+	switch status {
+	case http.StatusBadRequest:
+		return CodeBadRequest
+	case http.StatusUnauthorized:
+		return CodeUnauthorised
+	case http.StatusForbidden:
+		return CodeForbidden
+	case http.StatusNotFound:
+		return CodeNotFound
+	case http.StatusMethodNotAllowed:
+		return CodeMethodNotAllowed
+	case http.StatusLengthRequired:
+		return CodeLengthRequired
+	case http.StatusRequestEntityTooLarge:
+		return CodeTooLarge
+	case http.StatusUnsupportedMediaType:
+		return CodeUnsupportedMedia
+	case http.StatusTooManyRequests:
+		return CodeTooManyRequests
+	case http.StatusServiceUnavailable:
+		return CodeUnavailable
+	}
+
+	if status >= 500 {
+		return CodeInternal
+	}
+	return CodeBadRequest
+}
+
+// FieldError is why a field of a request's body is invalid
+type FieldError struct {
+	Field   string `json:"field"`   // The name of the field (as it's sent in JSON)
+	Code    string `json:"code"`    // e.g.: post_too_long
+	Message string `json:"message"` // Shown to the user
+}
+
 // HTTPError is a special json and more detailed
 type HTTPError struct {
-	Public  string `json:"public"`  // The public error shown in the writer
-	Message string `json:"message"` // The more detailed message
-	Code    int    `json:"-"`       // The HTTP code
+	Code      string       `json:"code"`                // A stable, machine-readable code (e.g. post_too_long), by default see [StatusCode]
+	Public    string       `json:"public"`              // The public error shown in the writer
+	Message   string       `json:"-"`                   // The more detailed message, only logged (it can have internal errors)
+	Details   []FieldError `json:"details,omitempty"`   // The invalid fields, if the body was invalid
+	Status    int          `json:"-"`                   // The HTTP code
+	RequestID string       `json:"requestID,omitempty"` // The request's `X-Request-ID`, so the error can be found in the logs
 }
 
 // IsOk checks if an http code stored by a HTTPError is ok
 func (err HTTPError) IsOk() bool {
-	return 200 > err.Code && err.Code >= 300
+	return 200 <= err.Status && err.Status < 300
 }
 
-// Error writes the HTTPError to the writer
+// InvalidFields creates a `400` error from the invalid fields of a body.
+// A single field uses it's code and message, otherwise the code is [CodeInvalidFields]
+func InvalidFields(details ...FieldError) HTTPError {
+	sentErr := HTTPError{
+		Code:    CodeInvalidFields,
+		Public:  "Some Fields are Invalid",
+		Message: "invalid fields",
+		Details: details,
+		Status:  http.StatusBadRequest,
+	}
+
+	if len(details) == 1 {
+		sentErr.Code = details[0].Code
+		sentErr.Public = details[0].Message
+		sentErr.Message = details[0].Field + ": " + details[0].Code
+	}
+
+	return sentErr
+}
+
+// Error writes the HTTPError to the writer and logs it (server errors are logged as errors).
+// The request ID is read from the response's `X-Request-ID` header
 func Error(w http.ResponseWriter, sentErr HTTPError) {
+	sentErr.RequestID = w.Header().Get("X-Request-ID")
+	if sentErr.Code == "" {
+		sentErr.Code = StatusCode(sentErr.Status)
+	}
+
+	level := slog.LevelInfo
+	if sentErr.Status >= 500 {
+		level = slog.LevelError
+	}
+
+	slog.Log(context.Background(), level, "request failed",
+		"request_id", sentErr.RequestID,
+		"status", sentErr.Status,
+		"code", sentErr.Code,
+		"public", sentErr.Public,
+		"error", sentErr.Message,
+	)
+
 	json, err := json.Marshal(sentErr)
 	if err != nil {
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(sentErr.Code)
+	w.WriteHeader(sentErr.Status)
 	w.Write(json)
 }
 
@@ -52,7 +150,7 @@ func SendScanErr(w http.ResponseWriter, err error, noRow *string) {
 		Error(w, HTTPError{
 			Public:  msg,
 			Message: "no rows found",
-			Code:    404,
+			Status:  404,
 		})
 		return
 	}
@@ -60,6 +158,6 @@ func SendScanErr(w http.ResponseWriter, err error, noRow *string) {
 	Error(w, HTTPError{
 		Public:  PublicServerError,
 		Message: err.Error(),
-		Code:    500,
+		Status:  500,
 	})
 }
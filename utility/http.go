@@ -1,26 +1,60 @@
 package utility
 
 import (
-	"bytes"
-	"crypto/sha1"
+	"crypto/sha256"
 	"fmt"
-	"io"
 	"io/fs"
 	"net/http"
+	"strings"
 )
 
-// GenerateETag generates an ETag from content
-func GenerateETag(content []byte) (string, error) {
-	var b bytes.Buffer
+// ImmutableCacheControl caches for a year and is never revalidated,
+// only use for content that never changes under the same url
+const ImmutableCacheControl string = "public, max-age=31536000, immutable"
 
-	b.Write(content)
+// GenerateETag generates a strong ETag from the SHA-256 hash of content
+func GenerateETag(content []byte) string {
+	return fmt.Sprintf(`"%x"`, sha256.Sum256(content))
+}
+
+// EncodedETag gives an ETag for a Content-Encoding (e.g.: gzip) of the same content,
+// because strong ETags have to differ between encodings
+func EncodedETag(eTag, encoding string) string {
+	if encoding == "" || encoding == EncodingIdentity {
+		return eTag
+	}
+
+	return fmt.Sprintf(`%s-%s"`, strings.TrimSuffix(eTag, `"`), encoding)
+}
+
+// DecodedETags adds the ETags of an `If-None-Match` header given by [EncodedETag] for encoding, without the encoding.
+// So handlers (which don't know the response is compressed later) can match the ETags they sent
+func DecodedETags(ifNoneMatch, encoding string) string {
+	suffix := "-" + encoding + `"`
+
+	decoded := ifNoneMatch
+	for _, match := range strings.Split(ifNoneMatch, ",") {
+		match = strings.TrimSpace(match)
+		if strings.HasSuffix(match, suffix) {
+			decoded += ", " + strings.TrimSuffix(match, suffix) + `"`
+		}
+	}
+
+	return decoded
+}
+
+// ETagMatches checks if an `If-None-Match` header matches an ETag (using weak comparison)
+func ETagMatches(ifNoneMatch, eTag string) bool {
+	eTag = strings.TrimPrefix(eTag, "W/")
 
-	hash := sha1.New()
-	if _, err := io.Copy(hash, &b); err != nil {
-		return "", err
+	for _, match := range strings.Split(ifNoneMatch, ",") {
+		match = strings.TrimSpace(match)
+		if match == "*" || strings.TrimPrefix(match, "W/") == eTag {
+			return true
+		}
 	}
 
-	return fmt.Sprintf(`"%x`, hash.Sum(nil)), nil
+	return false
 }
 
 // GetFileLastModified gets when a file has been last modified
@@ -11,20 +11,21 @@ import (
 	"image/jpeg"
 	"image/png"
 	"net/http"
-	"strconv"
-	"time"
 
+	"github.com/buckket/go-blurhash"
 	"github.com/nfnt/resize"
 )
 
 // ImageSizeLimit is the size limit of all uploaded images
 const ImageSizeLimit = 5000 * 1000
 
-// ImageMaxAge is the cache length (a week)
-const ImageMaxAge = 2 * 7 * 24 * int(time.Hour)
-
 const maxSize = 800
 
+const (
+	blurHashSize       = 32 // The size the image is shrunk to before hashing
+	blurHashComponents = 4  // The amount of components on each axis
+)
+
 // ResizeImage scales up the image if its dimensions are smaller than the desired size while maintaining the aspect ratio.
 func ResizeImage(img image.Image, maxWidth, maxHeight uint) image.Image {
 	width := uint(img.Bounds().Dx())
@@ -64,12 +65,12 @@ type ImageAccept struct {
 	Msg  string
 }
 
-// CanImageBeAccepted checks: the size and content-type; for an image
+// CanImageBeAccepted checks: the size and content-type; for an image.
+// The size is read from the `Content-Length` header, which is required
 func CanImageBeAccepted(r *http.Request, mimetype string) ImageAccept {
-	rawLength, lengthExists := r.Header["Content-Length"]
-	contentLength, lengthErr := strconv.Atoi(rawLength[0])
+	contentLength := r.ContentLength // -1 when unknown (e.g. chunked)
 
-	if !lengthExists || lengthErr != nil {
+	if contentLength <= 0 {
 		return ImageAccept{
 			Ok:   false,
 			Code: http.StatusLengthRequired,
@@ -194,3 +195,88 @@ func AutoCompress(mimetype string, img []byte) ([]byte, error) {
 		return nil, errors.New("No compress found for mimetype")
 	}
 }
+
+// ImageInfo contains the placeholder information of an image:
+//
+//   - Width and Height (in pixels),
+//   - BlurHash,
+//   - Color (the dominant colour as a hex string)
+type ImageInfo struct {
+	Width    int
+	Height   int
+	BlurHash string
+	Color    string
+}
+
+// GetImageInfo gets the dimensions, BlurHash and dominant colour of an image.
+// Should be used on the compressed image, so the dimensions match what is sent.
+func GetImageInfo(b []byte) (ImageInfo, error) {
+	img, _, err := image.Decode(bytes.NewReader(b))
+	if err != nil {
+		return ImageInfo{}, err
+	}
+
+	bounds := img.Bounds()
+	thumb := resize.Thumbnail(blurHashSize, blurHashSize, img, resize.Bilinear)
+
+	hash, err := blurhash.Encode(blurHashComponents, blurHashComponents, thumb)
+	if err != nil {
+		return ImageInfo{}, err
+	}
+
+	return ImageInfo{
+		Width:    bounds.Dx(),
+		Height:   bounds.Dy(),
+		BlurHash: hash,
+		Color:    dominantColor(thumb),
+	}, nil
+}
+
+// dominantColor finds the most common colour of an image,
+// by grouping similar colours together and averaging the largest group
+func dominantColor(img image.Image) string {
+	type bucket struct {
+		r, g, b, count int
+	}
+
+	var (
+		buckets = map[int]*bucket{}
+		largest = &bucket{}
+		bounds  = img.Bounds()
+	)
+
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			if c.A < 128 { // Ignores transparent pixels
+				continue
+			}
+
+			key := int(c.R>>4)<<8 | int(c.G>>4)<<4 | int(c.B>>4)
+			buck, ok := buckets[key]
+			if !ok {
+				buck = &bucket{}
+				buckets[key] = buck
+			}
+
+			buck.r += int(c.R)
+			buck.g += int(c.G)
+			buck.b += int(c.B)
+			buck.count++
+
+			if buck.count > largest.count {
+				largest = buck
+			}
+		}
+	}
+
+	if largest.count == 0 {
+		return "#000000"
+	}
+
+	return fmt.Sprintf("#%02x%02x%02x",
+		largest.r/largest.count,
+		largest.g/largest.count,
+		largest.b/largest.count,
+	)
+}
@@ -0,0 +1,28 @@
+package utility
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// Response is the body of a successful api call, errors are sent as an [HTTPError]
+type Response struct {
+	Data any `json:"data"` // Different for every api call (see SERVER_METHODS.md)
+}
+
+// Send writes data in a JSON [Response] with a status code
+func Send(w http.ResponseWriter, status int, data any) {
+	json, err := json.Marshal(Response{Data: data})
+	if err != nil {
+		Error(w, HTTPError{
+			Public:  PublicServerError,
+			Message: err.Error(),
+			Status:  500,
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(json)
+}
@@ -4,8 +4,11 @@ import (
 	"bytes"
 	"compress/gzip"
 	"errors"
+	"io"
+	"io/fs"
 	"math/rand"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
 	"time"
@@ -41,6 +44,17 @@ func GZipBytes(content []byte) ([]byte, error) {
 	return b.Bytes(), err
 }
 
+// GUnzipBytes decompresses a byte array compressed by [GZipBytes]
+func GUnzipBytes(content []byte) ([]byte, error) {
+	gr, err := gzip.NewReader(bytes.NewReader(content))
+	if err != nil {
+		return nil, err
+	}
+	defer gr.Close()
+
+	return io.ReadAll(gr)
+}
+
 // GetRandFromSlice gets an random element from a slice
 func GetRandFromSlice[t any](slice []t) t {
 	length := len(slice)
@@ -50,15 +64,30 @@ func GetRandFromSlice[t any](slice []t) t {
 	return slice[randomPosition]
 }
 
-// DoesFileExist check if the file (provided by path) exists using [os.Stat]
-func DoesFileExist(path string) bool {
-	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+// DoesFileExist check if the file (provided by path) exists in files using [fs.Stat]
+func DoesFileExist(files fs.FS, path string) bool {
+	if _, err := fs.Stat(files, path); errors.Is(err, fs.ErrNotExist) {
 		return false
 	}
 
 	return true
 }
 
+// FilePath converts a path (e.g. from the .env) to a path usable by [fs.FS], e.g.: `./dist/assets/` to `dist/assets`.
+// Absolute paths stay absolute, which only [DiskFS] can open
+func FilePath(name string) string {
+	return path.Clean(filepath.ToSlash(name))
+}
+
+// DiskFS reads files from the disk, relative to the working directory.
+// Unlike [os.DirFS], absolute paths can be opened, so paths in the .env can be anywhere
+type DiskFS struct{}
+
+// Open opens a file, name uses slashes (see [FilePath])
+func (DiskFS) Open(name string) (fs.File, error) {
+	return os.Open(filepath.FromSlash(name))
+}
+
 // MimeExpection changes the mime based on path extension
 func MimeExpection(mtype *mimetype.MIME, path string) string {
 	extension := filepath.Ext(path)